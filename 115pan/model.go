@@ -1,9 +1,17 @@
 package main
 
+import (
+	"encoding/json"
+	"path"
+	"plugins/util"
+)
+
 // https://www.yuque.com/115yun/open/um8whr91bxb5997o
 
 const (
 	Api115PanAddr = "https://proapi.115.com/"
+	// share api is not in open api
+	Api115WebAddr = "https://webapi.115.com"
 )
 
 type QrResponse struct {
@@ -51,6 +59,83 @@ type FileEntry struct {
 	Fta string `json:"fta"` // 文件状态 0/2 未上传完成，1 已上传完成
 }
 
+// /open/folder/get_info
+type FolderInfo struct {
+	FileId       string      `json:"file_id"`
+	FileName     string      `json:"file_name"`
+	PickCode     string      `json:"pick_code"`
+	FileCategory string      `json:"file_category"` // 0 folder 1 file
+	SizeByte     json.Number `json:"size_byte"`
+	Ptime        json.Number `json:"ptime"` // 上传时间
+	Utime        json.Number `json:"utime"` // 修改时间
+	Paths        []struct {
+		FileId   json.Number `json:"file_id"`
+		FileName string      `json:"file_name"`
+	} `json:"paths"` // parent dirs from root
+}
+
+// Path return full path of folder,paths start with root dir
+func (f *FolderInfo) Path() string {
+	names := []string{"/"}
+	for _, p := range f.Paths {
+		if p.FileId.String() == "0" {
+			continue
+		}
+		names = append(names, p.FileName)
+	}
+	return path.Join(append(names, f.FileName)...)
+}
+
+func (f *FolderInfo) FileEntry() *FileEntry {
+	size, _ := f.SizeByte.Int64()
+	ptime, _ := f.Ptime.Int64()
+	utime, _ := f.Utime.Int64()
+	return &FileEntry{
+		Fid:  f.FileId,
+		Fc:   f.FileCategory,
+		Fn:   f.FileName,
+		Pc:   f.PickCode,
+		Fs:   uint64(size),
+		Uppt: uint64(ptime),
+		Upt:  uint64(utime),
+	}
+}
+
+// /open/ufile/search
+type SearchFile struct {
+	FileId       string      `json:"file_id"`
+	FileName     string      `json:"file_name"`
+	PickCode     string      `json:"pick_code"`
+	ParentId     string      `json:"parent_id"`
+	FileCategory string      `json:"file_category"` // 0 folder 1 file
+	FileSize     json.Number `json:"file_size"`
+	UserPtime    json.Number `json:"user_ptime"` // 上传时间
+	UserUtime    json.Number `json:"user_utime"` // 修改时间
+}
+
+func (f *SearchFile) FileEntry() *FileEntry {
+	size, _ := f.FileSize.Int64()
+	ptime, _ := f.UserPtime.Int64()
+	utime, _ := f.UserUtime.Int64()
+	return &FileEntry{
+		Fid:  f.FileId,
+		Fc:   f.FileCategory,
+		Fn:   f.FileName,
+		Pc:   f.PickCode,
+		Fs:   uint64(size),
+		Uppt: uint64(ptime),
+		Upt:  uint64(utime),
+	}
+}
+
+// type of /open/ufile/search
+var searchTypeMap = map[string]string{
+	util.CategoryDoc:   "1",
+	util.CategoryImage: "2",
+	util.CategoryAudio: "3",
+	util.CategoryVideo: "4",
+}
+
 type FileURL struct {
 	FileName string `json:"file_name"`
 	FileSize uint64 `json:"file_size"`
@@ -82,11 +167,33 @@ type PlayVideoInfo struct {
 		DefinitionN uint64 `json:"definition_n"`
 		Title       string `json:"title"`
 	} `json:"video_url"`
+	MultitrackList []AudioTrack `json:"multitrack_list"`
+}
+
+type AudioTrack struct {
+	Title      string `json:"title"`
+	IsSelected int    `json:"is_selected"` // 1 current play track
+}
+
+// /open/offline/get_task_list
+type OfflineTaskList struct {
+	Page      int            `json:"page"`
+	PageCount int            `json:"page_count"`
+	Count     int            `json:"count"`
+	Tasks     []*OfflineTask `json:"tasks"`
+}
 
-	// TODO add audio
-	// MultitrackList []struct {
-	// 	Title string `json:"title"`
-	// }
+type OfflineTask struct {
+	InfoHash    string  `json:"info_hash"`
+	Name        string  `json:"name"`
+	Size        uint64  `json:"size"`
+	Url         string  `json:"url"`
+	AddTime     uint64  `json:"add_time"`
+	LastUpdate  uint64  `json:"last_update"`
+	PercentDone float64 `json:"percentDone"`
+	Status      int     `json:"status"`     // -1 失败 0 等待 1 下载中 2 完成
+	FileId      string  `json:"file_id"`    // 下载完成后的文件(夹)ID
+	WpPathId    string  `json:"wp_path_id"` // 保存目录ID
 }
 
 type Qrcode115panStatus struct {
@@ -101,3 +208,27 @@ type Qrcode115panResp struct {
 	Message string `json:"message"`
 	Data    any    `json:"data"`
 }
+
+// /share/snap
+type ShareSnapData struct {
+	ShareInfo struct {
+		ShareTitle string `json:"share_title"`
+	} `json:"shareinfo"`
+	Count int              `json:"count"`
+	List  []*ShareSnapFile `json:"list"`
+}
+
+type ShareSnapFile struct {
+	Fid  string      `json:"fid"` // empty if dir
+	Cid  json.Number `json:"cid"`
+	Name string      `json:"n"`
+	Size int64       `json:"s"`
+	Time json.Number `json:"t"`
+}
+
+// ShareFile is raw data of share file entry
+type ShareFile struct {
+	ShareCode   string `json:"share_code"`
+	ReceiveCode string `json:"receive_code"`
+	Cid         string `json:"cid"`
+}
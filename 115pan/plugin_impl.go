@@ -1,502 +1,1035 @@
-package main
-
-import (
-	"encoding/base64"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
-	"log/slog"
-	"net/http"
-	"net/url"
-	"plugins/util"
-	"strconv"
-	"strings"
-	"time"
-
-	"github.com/medianexapp/plugin_api/httpclient"
-	"github.com/medianexapp/plugin_api/plugin"
-	"github.com/medianexapp/plugin_api/ratelimit"
-
-	_ "github.com/labulakalia/wazero_net/wasi/http"
-)
-
-/*
-NOTE: net and http use package
-"github.com/labulakalia/wazero_net/wasi/http"
-"github.com/labulakalia/wazero_net/wasi/net"
-*/
-
-type PluginImpl struct {
-	token    *plugin.Token
-	userInfo *UserInfo
-
-	client    *httpclient.Client
-	ratelimit *ratelimit.RateLimit
-}
-
-const (
-	checkQrcodeStatusURL = "https://qrcodeapi.115.com/get/status/"
-)
-
-func NewPluginImpl() *PluginImpl {
-	slog.SetLogLoggerLevel(slog.LevelDebug)
-	client := httpclient.NewClient()
-	limitConfigMap := map[string]ratelimit.LimitConfig{
-		"/open/ufile/downurl": ratelimit.LimitConfig{
-			Limit:    1,
-			Duration: 3 * time.Second,
-		},
-		"/open/video/subtitle": ratelimit.LimitConfig{
-			Limit:    1,
-			Duration: 3 * time.Second,
-		},
-		"/open/video/play": ratelimit.LimitConfig{
-			Limit:    1,
-			Duration: 3 * time.Second,
-		},
-		"/open/ufile/files": ratelimit.LimitConfig{
-			Limit:    1,
-			Duration: 1 * time.Second,
-		},
-	}
-	return &PluginImpl{
-		client:    client,
-		ratelimit: ratelimit.New(limitConfigMap),
-	}
-}
-
-// Id implements IPlugin.
-func (p *PluginImpl) PluginId() (string, error) {
-	return "115pan", nil
-}
-
-// GetAuthe implements IPlugin.
-// Note: not store var in GetAuth
-func (p *PluginImpl) GetAuth() (*plugin.Auth, error) {
-	qrcodeData, err := util.GetAuthQrcode("115pan")
-	if err != nil {
-		return nil, err
-	}
-	authDeviceCodeData := &AuthDeviceCodeData{}
-	resp := &QrResponse{
-		Data: authDeviceCodeData,
-	}
-	err = json.Unmarshal(qrcodeData, resp)
-	if err != nil {
-		return nil, err
-	}
-	auth := &plugin.Auth{
-		AuthMethods: []*plugin.AuthMethod{},
-	}
-
-	url := util.GetAuthAddr("115pan")
-	authCallbackUrl := &plugin.AuthMethod_Callback{
-		Callback: &plugin.Callback{
-			CallbackUrl: url,
-		},
-	}
-	auth.AuthMethods = append(auth.AuthMethods, &plugin.AuthMethod{
-		Method: authCallbackUrl,
-	})
-	slog.Info("get 115pan auth success")
-	if authDeviceCodeData.Qrcode != "" {
-		p := map[string]string{
-			"uid":  authDeviceCodeData.Uid,
-			"time": fmt.Sprint(authDeviceCodeData.Time),
-			"sign": authDeviceCodeData.Sign,
-		}
-		data, err := json.Marshal(p)
-		if err != nil {
-			return nil, err
-		}
-		scanQrcode := &plugin.AuthMethod_Scanqrcode{
-			Scanqrcode: &plugin.Scanqrcode{
-				QrcodeImageParam:   string(data),
-				QrcodeImageContent: authDeviceCodeData.Qrcode,
-			},
-		}
-		auth.AuthMethods = append(auth.AuthMethods, &plugin.AuthMethod{
-			Method: scanQrcode,
-		})
-	}
-
-	return auth, nil
-}
-
-// CheckAuth implements IPlugin.
-func (p *PluginImpl) CheckAuthMethod(authMethod *plugin.AuthMethod) (*plugin.AuthData, error) {
-	var (
-		token        *plugin.Token
-		err          error
-		RefreshToken string
-		Uid          string
-	)
-	switch v := authMethod.Method.(type) {
-	case *plugin.AuthMethod_Refresh:
-		retoken := &plugin.Token{}
-		err = retoken.UnmarshalVT(v.Refresh.AuthData.AuthDataBytes)
-		if err != nil {
-			return nil, err
-		}
-
-		RefreshToken = retoken.RefreshToken
-	case *plugin.AuthMethod_Scanqrcode:
-		// https://www.yuque.com/115yun/open/shtpzfhewv5nag11#6d33298a
-		// 长轮训接口
-		slog.Info("recv scan qrocde data", "param", v.Scanqrcode.QrcodeImageParam)
-		client := httpclient.NewClient(httpclient.WithTimeout(time.Minute * 5))
-		param := map[string]string{}
-		err := json.Unmarshal([]byte(v.Scanqrcode.QrcodeImageParam), &param)
-		if err != nil {
-			slog.Error("unmarshal failed", "err", err)
-			return nil, err
-		}
-
-		u := url.Values{}
-		for k, v := range param {
-			u.Add(k, fmt.Sprint(v))
-		}
-		checkUrlStatus := fmt.Sprintf("%s?%s", checkQrcodeStatusURL, u.Encode())
-
-		resp, err := client.Get(checkUrlStatus)
-		if err != nil {
-			slog.Error("115pan request failed", "err", err)
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		respBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			slog.Error("115pan read response failed", "err", err)
-			return nil, err
-		}
-		qrStatus := &Qrcode115panStatus{}
-		qrcode115panData := &Qrcode115panResp{
-			Data: qrStatus,
-		}
-		err = json.Unmarshal(respBytes, qrcode115panData)
-		if err != nil {
-			slog.Error("unmarshal failed", "err", err)
-			return nil, err
-		}
-		if qrcode115panData.State == 0 {
-			slog.Error("scan qrcode failed", "err", errors.New(qrcode115panData.Message))
-			return nil, errors.New(qrcode115panData.Message)
-		}
-		if qrStatus.Status != 2 {
-			slog.Warn("qrcode not scan success", "message", qrcode115panData.Message, "status", qrcode115panData.State)
-			return nil, nil
-		}
-		slog.Info("qrcode scan success", "uid", u.Get("uid"))
-		Uid = u.Get("uid")
-	case *plugin.AuthMethod_Callback:
-		slog.Info("recv callback data", "callBackData", v.Callback.CallbackUrlData)
-		token = &plugin.Token{}
-		urlParse, err := url.Parse(v.Callback.CallbackUrlData)
-		if err != nil {
-			return nil, err
-		}
-		data, err := base64.URLEncoding.DecodeString(urlParse.Query().Get("token"))
-		if err != nil {
-			return nil, err
-		}
-		err = token.UnmarshalVT(data)
-		if err != nil {
-			return nil, err
-		}
-	default:
-		return nil, errors.New("unsupported auth method")
-	}
-	if token == nil {
-		req := &util.GetAuthTokenRequest{
-			Id:           "115pan",
-			Uid:          Uid,
-			RefreshToken: RefreshToken,
-		}
-		token, err = util.GetAuthToken(req)
-		if err != nil {
-			slog.Error("get auth token failed", "err", err, "req", req)
-			return nil, err
-		}
-	}
-	tokenBytes, err := token.MarshalVT()
-	if err != nil {
-		slog.Error("marshal token failed", "err", err)
-		return nil, err
-	}
-	expireTime := time.Now().Add(time.Second * time.Duration(token.ExpiresIn-300)).Unix()
-	authData := &plugin.AuthData{
-		AuthDataBytes:       tokenBytes,
-		AuthDataExpiredTime: uint64(expireTime),
-	}
-	slog.Info("get access token success")
-	return authData, nil
-}
-
-// InitAuth implements IPlugin.
-func (p *PluginImpl) CheckAuthData(authDataBytes []byte) error {
-	token := &plugin.Token{}
-	err := token.UnmarshalVT(authDataBytes)
-	if err != nil {
-		slog.Error("unmarshal token failed", "err", err)
-		return err
-	}
-	p.token = token
-
-	resp := &Response{}
-	err = p.send(http.MethodGet, "/open/user/info", nil, resp)
-	if err != nil {
-		slog.Error("get user info failed", "err", err)
-		return err
-	}
-	if resp.State == false {
-		slog.Error("get user info failed", "err", err)
-		return errors.New(resp.Message)
-	}
-	data, err := json.Marshal(resp.Data)
-	if err != nil {
-		slog.Error("marshal user info failed", "err", err)
-		return err
-	}
-	userInfo := &UserInfo{}
-	err = json.Unmarshal(data, &userInfo)
-	if err != nil {
-		slog.Error("unmarshal user info failed", "err", err)
-		return err
-	}
-	p.userInfo = userInfo
-	return nil
-}
-
-// AuthId implements IPlugin.
-func (p *PluginImpl) PluginAuthId() (string, error) {
-	if p.userInfo == nil {
-		return "", errors.New("userInfo is nil")
-	}
-	return fmt.Sprint(p.userInfo.UserId), nil
-}
-
-// GetDirEntry implements IPlugin.
-func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
-	slog.Debug("get dir entry ", "req", req)
-
-	if req.Page == 0 {
-		req.Page = 1
-	}
-
-	fileEntries := []*FileEntry{}
-	resp := &Response{
-		Data: &fileEntries,
-	}
-	fid := ""
-	if req.FileEntry != nil && req.FileEntry.RawData != nil {
-		fileEntry := FileEntry{}
-		err := json.Unmarshal(req.FileEntry.RawData, &fileEntry)
-		if err != nil {
-			return nil, err
-		}
-		fid = fileEntry.Fid
-	}
-	slog.Debug("get dir entry ", "fid", fid)
-
-	u := url.Values{}
-	u.Add("cid", fid)
-	u.Add("show_dir", "1")
-	u.Add("o", "file_name")
-	u.Add("offset", fmt.Sprint((req.Page-1)*req.PageSize))
-	u.Add("limit", fmt.Sprint(req.PageSize))
-	u.Add("order", "file_name")
-	p.ratelimit.Wait("/open/ufile/files")
-	err := p.send(http.MethodGet, "/open/ufile/files?"+u.Encode(), nil, resp)
-	if err != nil {
-		return nil, err
-	}
-	slog.Debug("get send ")
-
-	if resp.State == false {
-		slog.Error("get dir failed", "err", err)
-		return nil, errors.New(resp.Message)
-	}
-	dirEntry := &plugin.DirEntry{
-		FileEntries: []*plugin.FileEntry{},
-	}
-	for _, fileEntry := range fileEntries {
-		entry := &plugin.FileEntry{
-			Name:         fileEntry.Fn,
-			Size:         uint64(fileEntry.Fs),
-			CreatedTime:  uint64(fileEntry.Uppt),
-			ModifiedTime: uint64(fileEntry.Upt),
-			AccessedTime: uint64(fileEntry.Upt),
-		}
-		entryBytes, err := json.Marshal(fileEntry)
-		if err == nil {
-			entry.RawData = entryBytes
-		}
-		if fileEntry.Fc == "0" {
-			entry.FileType = plugin.FileEntry_FileTypeDir
-		} else {
-			entry.FileType = plugin.FileEntry_FileTypeFile
-		}
-		dirEntry.FileEntries = append(dirEntry.FileEntries, entry)
-	}
-	slog.Debug("return")
-
-	return dirEntry, nil
-}
-
-// GetFileResource implements IPlugin.
-func (p *PluginImpl) GetFileResource(req *plugin.GetFileResourceRequest) (*plugin.FileResource, error) {
-	if req.FileEntry == nil || req.FileEntry.RawData == nil {
-		return nil, fmt.Errorf("invalid path %s", req.FilePath)
-	}
-
-	fileResource := &plugin.FileResource{
-		FileResourceData: []*plugin.FileResource_FileResourceData{}}
-	fileEntry := &FileEntry{}
-	err := json.Unmarshal(req.FileEntry.RawData, fileEntry)
-	if err != nil {
-		return nil, err
-	}
-	reqURL := url.Values{}
-	reqURL.Add("pick_code", fileEntry.Pc)
-
-	respData := map[string]FileURL{}
-	resp := Response{
-		Data: &respData,
-	}
-	p.ratelimit.Wait("/open/ufile/downurl")
-	err = p.send(http.MethodPost, "/open/ufile/downurl", reqURL, &resp)
-	if err != nil {
-		return nil, err
-	}
-	if resp.State == true {
-		fileURL, ok := respData[fileEntry.Fid]
-		if ok {
-			uu, err := url.Parse(fileURL.Url.Url)
-			if err != nil {
-				return nil, err
-			}
-			expireTime, err := strconv.ParseUint(uu.Query().Get("t"), 10, 0)
-			if err != nil {
-				return nil, err
-			}
-			fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
-				Url:          fileURL.Url.Url,
-				Resolution:   plugin.FileResource_Original,
-				ResourceType: plugin.FileResource_Video,
-				ExpireTime:   expireTime,
-				Header: map[string]string{
-					"User-Agent": httpclient.GetDefaultUserAgent(),
-				},
-			})
-		}
-	} else {
-		slog.Error("get down file failed", "msg", resp.Message)
-	}
-
-	if req.IsMedia {
-
-		subtitleData := &SubtitleData{
-			List: []Subtitle{},
-		}
-		resp = Response{
-			Data: &subtitleData,
-		}
-		p.ratelimit.Wait("/open/video/subtitle")
-		err = p.send(http.MethodGet, "/open/video/subtitle?"+reqURL.Encode(), nil, &resp)
-		if err != nil {
-			return nil, err
-		}
-		for _, subtitle := range subtitleData.List {
-			fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
-				Url:          subtitle.URL,
-				ResourceType: plugin.FileResource_Subtitle,
-				Title:        subtitle.Title,
-				Header: map[string]string{
-					"User-Agent": httpclient.GetDefaultUserAgent(),
-				},
-			})
-		}
-
-		playVideoInfo := PlayVideoInfo{}
-		resp = Response{
-			Data: &playVideoInfo,
-		}
-		// get video play address
-		p.ratelimit.Wait("/open/video/play")
-		err = p.send(http.MethodGet, "/open/video/play?"+reqURL.Encode(), nil, &resp)
-		if err != nil {
-			return nil, err
-		}
-		if resp.State == true {
-			for _, playVideoInfo := range playVideoInfo.VideoURL {
-				data := &plugin.FileResource_FileResourceData{
-					Url:          playVideoInfo.URL,
-					ResourceType: plugin.FileResource_Video,
-					Title:        playVideoInfo.Title,
-					Header: map[string]string{
-						"User-Agent": httpclient.GetDefaultUserAgent(),
-					},
-				}
-				if playVideoInfo.DefinitionN == 1 {
-					data.Resolution = plugin.FileResource_SD
-				} else if playVideoInfo.DefinitionN == 2 {
-					data.Resolution = plugin.FileResource_LD
-				} else if playVideoInfo.DefinitionN == 3 {
-					data.Resolution = plugin.FileResource_HD
-				} else if playVideoInfo.DefinitionN == 4 {
-					data.Resolution = plugin.FileResource_FHD
-				} else if playVideoInfo.DefinitionN == 4 {
-					data.Resolution = plugin.FileResource_UHD
-				} else if playVideoInfo.DefinitionN == 5 {
-					data.Resolution = plugin.FileResource_Original
-				}
-				fileResource.FileResourceData = append(fileResource.FileResourceData, data)
-			}
-		} else {
-			slog.Error("get play video info failed", "msg", resp.Message)
-		}
-	}
-
-	return fileResource, nil
-}
-
-func (p *PluginImpl) send(method string, uri string, req, resp any) error {
-	var body io.Reader
-	if req != nil {
-		urlValue, ok := req.(url.Values)
-		if !ok {
-			return errors.New("req not is urlValues")
-		}
-		body = strings.NewReader(urlValue.Encode())
-	}
-
-	httpReq, err := http.NewRequest(method, fmt.Sprintf("%s%s", Api115PanAddr, uri), body)
-	if err != nil {
-		return err
-	}
-	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	if p.token == nil {
-		return errors.New("token is nil")
-	}
-	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.token.AccessToken))
-	httpResp, err := p.client.Do(httpReq)
-	if err != nil {
-		return err
-	}
-
-	bodyData, err := io.ReadAll(httpResp.Body)
-	if err != nil {
-		return err
-	}
-	slog.Debug("get request resp", "uri", uri, "req", req, "status_code", httpResp.StatusCode, "header", httpResp.Header, "resp", string(bodyData))
-	defer httpResp.Body.Close()
-
-	err = json.Unmarshal(bodyData, resp)
-	if err != nil {
-		slog.Error("unmarshal body data failed", "err", err)
-		return err
-	}
-	return nil
-}
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"plugins/util"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/medianexapp/plugin_api/httpclient"
+	"github.com/medianexapp/plugin_api/plugin"
+	"github.com/medianexapp/plugin_api/ratelimit"
+
+	_ "github.com/labulakalia/wazero_net/wasi/http"
+)
+
+/*
+NOTE: net and http use package
+"github.com/labulakalia/wazero_net/wasi/http"
+"github.com/labulakalia/wazero_net/wasi/net"
+*/
+
+type PluginImpl struct {
+	token    *plugin.Token
+	userInfo *UserInfo
+
+	client    *httpclient.Client
+	ratelimit *ratelimit.RateLimit
+
+	// path -> file entry,resolve path without raw data
+	pathCache *util.Cache[string, *FileEntry]
+	shares    util.Shares
+	// offline links added in this session,reopen path of link not add it again
+	offlineLinks sync.Map
+}
+
+const (
+	checkQrcodeStatusURL = "https://qrcodeapi.115.com/get/status/"
+	pathCacheTTL         = 10 * time.Minute
+	pathCacheSize        = 10000
+
+	// virtual dir,list offline tasks,open "/离线下载/<link>" to add task
+	offlineDownloadDir = "/离线下载"
+)
+
+func NewPluginImpl() *PluginImpl {
+	slog.SetLogLoggerLevel(slog.LevelDebug)
+	client := httpclient.NewClient()
+	limitConfigMap := map[string]ratelimit.LimitConfig{
+		"/open/ufile/downurl": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: 3 * time.Second,
+		},
+		"/open/video/subtitle": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: 3 * time.Second,
+		},
+		"/open/video/play": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: 3 * time.Second,
+		},
+		"/open/ufile/files": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: 1 * time.Second,
+		},
+		"/open/folder/get_info": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: 1 * time.Second,
+		},
+		"/open/offline/get_task_list": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: 1 * time.Second,
+		},
+		"/open/offline/add_task_urls": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: 3 * time.Second,
+		},
+		"/open/ufile/search": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: 1 * time.Second,
+		},
+		"/share/snap": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: 1 * time.Second,
+		},
+	}
+	return &PluginImpl{
+		client:    client,
+		ratelimit: ratelimit.New(limitConfigMap),
+		pathCache: util.NewCache[string, *FileEntry](pathCacheSize, pathCacheTTL),
+	}
+}
+
+// Id implements IPlugin.
+func (p *PluginImpl) PluginId() (string, error) {
+	return "115pan", nil
+}
+
+// GetAuthe implements IPlugin.
+// Note: not store var in GetAuth
+func (p *PluginImpl) GetAuth() (*plugin.Auth, error) {
+	qrcodeData, err := util.GetAuthQrcode("115pan")
+	if err != nil {
+		return nil, err
+	}
+	authDeviceCodeData := &AuthDeviceCodeData{}
+	resp := &QrResponse{
+		Data: authDeviceCodeData,
+	}
+	err = json.Unmarshal(qrcodeData, resp)
+	if err != nil {
+		return nil, err
+	}
+	auth := &plugin.Auth{
+		AuthMethods: []*plugin.AuthMethod{},
+	}
+
+	url := util.GetAuthAddr("115pan")
+	authCallbackUrl := &plugin.AuthMethod_Callback{
+		Callback: &plugin.Callback{
+			CallbackUrl: url,
+		},
+	}
+	auth.AuthMethods = append(auth.AuthMethods, &plugin.AuthMethod{
+		Method: authCallbackUrl,
+	})
+	slog.Info("get 115pan auth success")
+	if authDeviceCodeData.Qrcode != "" {
+		p := map[string]string{
+			"uid":  authDeviceCodeData.Uid,
+			"time": fmt.Sprint(authDeviceCodeData.Time),
+			"sign": authDeviceCodeData.Sign,
+		}
+		data, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		scanQrcode := &plugin.AuthMethod_Scanqrcode{
+			Scanqrcode: &plugin.Scanqrcode{
+				QrcodeImageParam:   string(data),
+				QrcodeImageContent: authDeviceCodeData.Qrcode,
+			},
+		}
+		auth.AuthMethods = append(auth.AuthMethods, &plugin.AuthMethod{
+			Method: scanQrcode,
+		})
+	}
+
+	return auth, nil
+}
+
+// CheckAuth implements IPlugin.
+func (p *PluginImpl) CheckAuthMethod(authMethod *plugin.AuthMethod) (*plugin.AuthData, error) {
+	var (
+		token        *plugin.Token
+		err          error
+		RefreshToken string
+		Uid          string
+	)
+	switch v := authMethod.Method.(type) {
+	case *plugin.AuthMethod_Refresh:
+		retoken := &plugin.Token{}
+		err = retoken.UnmarshalVT(v.Refresh.AuthData.AuthDataBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		RefreshToken = retoken.RefreshToken
+	case *plugin.AuthMethod_Scanqrcode:
+		// https://www.yuque.com/115yun/open/shtpzfhewv5nag11#6d33298a
+		// 长轮训接口
+		slog.Info("recv scan qrocde data", "param", v.Scanqrcode.QrcodeImageParam)
+		client := httpclient.NewClient(httpclient.WithTimeout(time.Minute * 5))
+		param := map[string]string{}
+		err := json.Unmarshal([]byte(v.Scanqrcode.QrcodeImageParam), &param)
+		if err != nil {
+			slog.Error("unmarshal failed", "err", err)
+			return nil, err
+		}
+
+		u := url.Values{}
+		for k, v := range param {
+			u.Add(k, fmt.Sprint(v))
+		}
+		checkUrlStatus := fmt.Sprintf("%s?%s", checkQrcodeStatusURL, u.Encode())
+
+		resp, err := client.Get(checkUrlStatus)
+		if err != nil {
+			slog.Error("115pan request failed", "err", err)
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		respBytes, err := io.ReadAll(resp.Body)
+		if err != nil {
+			slog.Error("115pan read response failed", "err", err)
+			return nil, err
+		}
+		qrStatus := &Qrcode115panStatus{}
+		qrcode115panData := &Qrcode115panResp{
+			Data: qrStatus,
+		}
+		err = json.Unmarshal(respBytes, qrcode115panData)
+		if err != nil {
+			slog.Error("unmarshal failed", "err", err)
+			return nil, err
+		}
+		if qrcode115panData.State == 0 {
+			slog.Error("scan qrcode failed", "err", errors.New(qrcode115panData.Message))
+			return nil, errors.New(qrcode115panData.Message)
+		}
+		if qrStatus.Status != 2 {
+			slog.Warn("qrcode not scan success", "message", qrcode115panData.Message, "status", qrcode115panData.State)
+			return nil, nil
+		}
+		slog.Info("qrcode scan success", "uid", u.Get("uid"))
+		Uid = u.Get("uid")
+	case *plugin.AuthMethod_Callback:
+		slog.Info("recv callback data", "callBackData", v.Callback.CallbackUrlData)
+		token = &plugin.Token{}
+		urlParse, err := url.Parse(v.Callback.CallbackUrlData)
+		if err != nil {
+			return nil, err
+		}
+		data, err := base64.URLEncoding.DecodeString(urlParse.Query().Get("token"))
+		if err != nil {
+			return nil, err
+		}
+		err = token.UnmarshalVT(data)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unsupported auth method")
+	}
+	if token == nil {
+		req := &util.GetAuthTokenRequest{
+			Id:           "115pan",
+			Uid:          Uid,
+			RefreshToken: RefreshToken,
+		}
+		token, err = util.GetAuthToken(req)
+		if err != nil {
+			slog.Error("get auth token failed", "err", err, "req", req)
+			return nil, err
+		}
+	}
+	tokenBytes, err := token.MarshalVT()
+	if err != nil {
+		slog.Error("marshal token failed", "err", err)
+		return nil, err
+	}
+	expireTime := time.Now().Add(time.Second * time.Duration(token.ExpiresIn-300)).Unix()
+	authData := &plugin.AuthData{
+		AuthDataBytes:       tokenBytes,
+		AuthDataExpiredTime: uint64(expireTime),
+	}
+	slog.Info("get access token success")
+	return authData, nil
+}
+
+// InitAuth implements IPlugin.
+func (p *PluginImpl) CheckAuthData(authDataBytes []byte) error {
+	token := &plugin.Token{}
+	err := token.UnmarshalVT(authDataBytes)
+	if err != nil {
+		slog.Error("unmarshal token failed", "err", err)
+		return err
+	}
+	p.token = token
+
+	resp := &Response{}
+	err = p.send(http.MethodGet, "/open/user/info", nil, resp)
+	if err != nil {
+		slog.Error("get user info failed", "err", err)
+		return err
+	}
+	if resp.State == false {
+		slog.Error("get user info failed", "err", err)
+		return errors.New(resp.Message)
+	}
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		slog.Error("marshal user info failed", "err", err)
+		return err
+	}
+	userInfo := &UserInfo{}
+	err = json.Unmarshal(data, &userInfo)
+	if err != nil {
+		slog.Error("unmarshal user info failed", "err", err)
+		return err
+	}
+	p.userInfo = userInfo
+	return nil
+}
+
+// AuthId implements IPlugin.
+func (p *PluginImpl) PluginAuthId() (string, error) {
+	if p.userInfo == nil {
+		return "", errors.New("userInfo is nil")
+	}
+	return fmt.Sprint(p.userInfo.UserId), nil
+}
+
+// GetDirEntry implements IPlugin.
+func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	slog.Debug("get dir entry ", "req", req)
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if isOfflineDownloadPath(req.Path) && (req.FileEntry == nil || req.FileEntry.RawData == nil) {
+		return p.getOfflineDirEntry(req)
+	}
+	if util.IsShareEntry(req.Path, req.FileEntry, "share_code") {
+		return p.getShareDirEntry(req)
+	}
+	if util.IsSearchPath(req.Path) && (req.FileEntry == nil || req.FileEntry.RawData == nil) {
+		return p.search(req)
+	}
+
+	fileEntries := []*FileEntry{}
+	resp := &Response{
+		Data: &fileEntries,
+	}
+	fid := ""
+	if req.FileEntry != nil && req.FileEntry.RawData != nil {
+		fileEntry := FileEntry{}
+		err := json.Unmarshal(req.FileEntry.RawData, &fileEntry)
+		if err != nil {
+			return nil, err
+		}
+		fid = fileEntry.Fid
+	} else if req.Path != "" && req.Path != "/" {
+		fileEntry, err := p.getFileEntryByPath(req.Path)
+		if err != nil {
+			return nil, err
+		}
+		fid = fileEntry.Fid
+	}
+	slog.Debug("get dir entry ", "fid", fid)
+
+	u := url.Values{}
+	u.Add("cid", fid)
+	u.Add("show_dir", "1")
+	u.Add("o", "file_name")
+	u.Add("offset", fmt.Sprint((req.Page-1)*req.PageSize))
+	u.Add("limit", fmt.Sprint(req.PageSize))
+	u.Add("order", "file_name")
+	p.ratelimit.Wait("/open/ufile/files")
+	err := p.send(http.MethodGet, "/open/ufile/files?"+u.Encode(), nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("get send ")
+
+	if resp.State == false {
+		slog.Error("get dir failed", "err", err)
+		return nil, errors.New(resp.Message)
+	}
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+	}
+	if fid == "" && req.Page == 1 {
+		dirEntry.FileEntries = append(dirEntry.FileEntries, &plugin.FileEntry{
+			Name:     strings.TrimPrefix(offlineDownloadDir, "/"),
+			FileType: plugin.FileEntry_FileTypeDir,
+		}, util.SharesFileEntry(), util.SearchFileEntry())
+	}
+	for _, fileEntry := range fileEntries {
+		if req.Path != "" {
+			p.storePathCache(path.Join(req.Path, fileEntry.Fn), fileEntry)
+		}
+		entry := &plugin.FileEntry{
+			Name:         fileEntry.Fn,
+			Size:         uint64(fileEntry.Fs),
+			CreatedTime:  uint64(fileEntry.Uppt),
+			ModifiedTime: uint64(fileEntry.Upt),
+			AccessedTime: uint64(fileEntry.Upt),
+		}
+		entryBytes, err := json.Marshal(fileEntry)
+		if err == nil {
+			entry.RawData = entryBytes
+		}
+		if fileEntry.Fc == "0" {
+			entry.FileType = plugin.FileEntry_FileTypeDir
+		} else {
+			entry.FileType = plugin.FileEntry_FileTypeFile
+		}
+		dirEntry.FileEntries = append(dirEntry.FileEntries, entry)
+	}
+	slog.Debug("return")
+
+	return dirEntry, nil
+}
+
+// GetFileResource implements IPlugin.
+func (p *PluginImpl) GetFileResource(req *plugin.GetFileResourceRequest) (*plugin.FileResource, error) {
+	if util.IsShareEntry(req.FilePath, req.FileEntry, "share_code") {
+		// download share file need receive it to drive
+		return nil, util.ErrShareNotPlayable
+	}
+	fileResource := &plugin.FileResource{
+		FileResourceData: []*plugin.FileResource_FileResourceData{}}
+	fileEntry := &FileEntry{}
+	var err error
+	if req.FileEntry != nil && req.FileEntry.RawData != nil {
+		err = json.Unmarshal(req.FileEntry.RawData, fileEntry)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		fileEntry, err = p.getFileEntryByPath(req.FilePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if fileEntry.Pc == "" {
+		return nil, fmt.Errorf("invalid path %s", req.FilePath)
+	}
+	reqURL := url.Values{}
+	reqURL.Add("pick_code", fileEntry.Pc)
+
+	var original *plugin.FileResource_FileResourceData
+	respData := map[string]FileURL{}
+	resp := Response{
+		Data: &respData,
+	}
+	p.ratelimit.Wait("/open/ufile/downurl")
+	err = p.send(http.MethodPost, "/open/ufile/downurl", reqURL, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.State == true {
+		fileURL, ok := respData[fileEntry.Fid]
+		if ok {
+			uu, err := url.Parse(fileURL.Url.Url)
+			if err != nil {
+				return nil, err
+			}
+			expireTime, err := strconv.ParseUint(uu.Query().Get("t"), 10, 0)
+			if err != nil {
+				return nil, err
+			}
+			original = &plugin.FileResource_FileResourceData{
+				Url:          fileURL.Url.Url,
+				Resolution:   plugin.FileResource_Original,
+				ResourceType: plugin.FileResource_Video,
+				ExpireTime:   expireTime,
+				Header: map[string]string{
+					"User-Agent": httpclient.GetDefaultUserAgent(),
+				},
+			}
+			fileResource.FileResourceData = append(fileResource.FileResourceData, original)
+		}
+	} else {
+		slog.Error("get down file failed", "msg", resp.Message)
+	}
+
+	if req.IsMedia {
+
+		subtitleData := &SubtitleData{
+			List: []Subtitle{},
+		}
+		resp = Response{
+			Data: &subtitleData,
+		}
+		p.ratelimit.Wait("/open/video/subtitle")
+		err = p.send(http.MethodGet, "/open/video/subtitle?"+reqURL.Encode(), nil, &resp)
+		if err != nil {
+			return nil, err
+		}
+		for _, subtitle := range subtitleData.List {
+			fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
+				Url:          subtitle.URL,
+				ResourceType: plugin.FileResource_Subtitle,
+				Title:        subtitleTitle(subtitle),
+				Header: map[string]string{
+					"User-Agent": httpclient.GetDefaultUserAgent(),
+				},
+			})
+		}
+
+		// get video play address
+		playVideoInfo, err := p.getPlayVideoInfo(reqURL)
+		if err != nil {
+			return nil, err
+		}
+		if playVideoInfo != nil {
+			appendPlayVideo(fileResource, playVideoInfo, original)
+		}
+	}
+
+	return fileResource, nil
+}
+
+func isOfflineLink(link string) bool {
+	for _, prefix := range []string{"magnet:?", "ed2k://", "http://", "https://", "ftp://"} {
+		if strings.HasPrefix(strings.ToLower(link), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isOfflineDownloadPath(dirPath string) bool {
+	return dirPath == offlineDownloadDir || strings.HasPrefix(dirPath, offlineDownloadDir+"/")
+}
+
+// parseOfflineLink return link of "/离线下载/<link>",empty if path is offline dir,
+// "//" of link may be cleaned to "/" by path
+func parseOfflineLink(dirPath string) (string, error) {
+	link := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(dirPath, offlineDownloadDir), "/"))
+	if link == "" {
+		return "", nil
+	}
+	for _, scheme := range []string{"ed2k:", "http:", "https:", "ftp:"} {
+		if strings.HasPrefix(strings.ToLower(link), scheme) && !strings.HasPrefix(link[len(scheme):], "//") {
+			link = link[:len(scheme)] + "/" + link[len(scheme):]
+			break
+		}
+	}
+	if !isOfflineLink(link) {
+		return "", fmt.Errorf("unsupported offline link %s", link)
+	}
+	return link, nil
+}
+
+// getOfflineDirEntry list offline tasks and their progress,
+// if path is "/离线下载/<link>",add link as offline task once before list
+func (p *PluginImpl) getOfflineDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	link, err := parseOfflineLink(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	if link != "" && req.Page == 1 {
+		if _, added := p.offlineLinks.LoadOrStore(link, true); !added {
+			err = p.addOfflineTask(link)
+			if err != nil {
+				p.offlineLinks.Delete(link)
+				return nil, err
+			}
+		}
+	}
+	taskList := &OfflineTaskList{
+		Tasks: []*OfflineTask{},
+	}
+	resp := &Response{
+		Data: taskList,
+	}
+	u := url.Values{}
+	u.Add("page", fmt.Sprint(req.Page))
+	p.ratelimit.Wait("/open/offline/get_task_list")
+	err = p.send(http.MethodGet, "/open/offline/get_task_list?"+u.Encode(), nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.State == false {
+		return nil, errors.New(resp.Message)
+	}
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+	}
+	if taskList.PageCount != 0 && int(req.Page) > taskList.PageCount {
+		return dirEntry, nil
+	}
+	for _, task := range taskList.Tasks {
+		entry := &plugin.FileEntry{
+			Name:         offlineTaskName(task),
+			Size:         task.Size,
+			FileType:     plugin.FileEntry_FileTypeFile,
+			CreatedTime:  task.AddTime,
+			ModifiedTime: task.LastUpdate,
+			AccessedTime: task.LastUpdate,
+		}
+		// completed task link to target folder
+		if task.Status == 2 {
+			folderId := task.FileId
+			if folderId == "" {
+				folderId = task.WpPathId
+			}
+			entryBytes, err := json.Marshal(&FileEntry{Fid: folderId, Fc: "0", Fn: task.Name})
+			if err == nil {
+				entry.RawData = entryBytes
+				entry.FileType = plugin.FileEntry_FileTypeDir
+			}
+		}
+		dirEntry.FileEntries = append(dirEntry.FileEntries, entry)
+	}
+	return dirEntry, nil
+}
+
+// addOfflineTask add links which are separated by "\n"
+func (p *PluginImpl) addOfflineTask(links string) error {
+	u := url.Values{}
+	u.Add("urls", links)
+	resp := &Response{}
+	p.ratelimit.Wait("/open/offline/add_task_urls")
+	err := p.send(http.MethodPost, "/open/offline/add_task_urls", u, resp)
+	if err != nil {
+		return err
+	}
+	if resp.State == false {
+		slog.Error("add offline task failed", "links", links, "msg", resp.Message)
+		return errors.New(resp.Message)
+	}
+	slog.Info("add offline task success", "links", links)
+	return nil
+}
+
+func offlineTaskName(task *OfflineTask) string {
+	name := task.Name
+	if name == "" {
+		name = task.Url
+	}
+	switch task.Status {
+	case -1:
+		return fmt.Sprintf("[失败] %s", name)
+	case 0:
+		return fmt.Sprintf("[等待] %s", name)
+	case 2:
+		return fmt.Sprintf("[完成] %s", name)
+	default:
+		return fmt.Sprintf("[%.1f%%] %s", task.PercentDone, name)
+	}
+}
+
+// getFileEntryByPath resolve slash path to 115 file entry,
+// first use /open/folder/get_info,if failed walk dir by /open/ufile/files
+func (p *PluginImpl) getFileEntryByPath(filePath string) (*FileEntry, error) {
+	filePath = path.Clean("/" + filePath)
+	if filePath == "/" {
+		return &FileEntry{Fid: "0", Fc: "0"}, nil
+	}
+	if fileEntry, ok := p.pathCache.Get(filePath); ok {
+		return fileEntry, nil
+	}
+	fileEntry, err := p.getFolderInfo(filePath)
+	if err != nil {
+		slog.Warn("get folder info failed,walk dir", "path", filePath, "err", err)
+		fileEntry, err = p.walkFileEntry(filePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.storePathCache(filePath, fileEntry)
+	return fileEntry, nil
+}
+
+func (p *PluginImpl) storePathCache(filePath string, fileEntry *FileEntry) {
+	p.pathCache.Set(filePath, fileEntry)
+}
+
+func (p *PluginImpl) getFolderInfo(filePath string) (*FileEntry, error) {
+	u := url.Values{}
+	u.Add("path", filePath)
+	folderInfo := &FolderInfo{}
+	resp := &Response{
+		Data: folderInfo,
+	}
+	p.ratelimit.Wait("/open/folder/get_info")
+	err := p.send(http.MethodGet, "/open/folder/get_info?"+u.Encode(), nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.State == false {
+		return nil, errors.New(resp.Message)
+	}
+	if folderInfo.FileId == "" {
+		return nil, fmt.Errorf("%s not exist", filePath)
+	}
+	return folderInfo.FileEntry(), nil
+}
+
+// getFolderPathById return full path of folder
+func (p *PluginImpl) getFolderPathById(fid string) (string, error) {
+	u := url.Values{}
+	u.Add("file_id", fid)
+	folderInfo := &FolderInfo{}
+	resp := &Response{
+		Data: folderInfo,
+	}
+	p.ratelimit.Wait("/open/folder/get_info")
+	err := p.send(http.MethodGet, "/open/folder/get_info?"+u.Encode(), nil, resp)
+	if err != nil {
+		return "", err
+	}
+	if resp.State == false {
+		return "", errors.New(resp.Message)
+	}
+	return folderInfo.Path(), nil
+}
+
+func (p *PluginImpl) walkFileEntry(filePath string) (*FileEntry, error) {
+	var (
+		fileEntry  = &FileEntry{Fid: "0", Fc: "0"}
+		parentPath = "/"
+		err        error
+	)
+	for _, name := range strings.Split(strings.Trim(filePath, "/"), "/") {
+		if fileEntry.Fc != "0" {
+			return nil, fmt.Errorf("%s is not dir", parentPath)
+		}
+		fileEntry, err = p.findFileEntry(parentPath, fileEntry.Fid, name)
+		if err != nil {
+			return nil, err
+		}
+		parentPath = path.Join(parentPath, name)
+	}
+	return fileEntry, nil
+}
+
+// findFileEntry list dir cid page by page until find name
+func (p *PluginImpl) findFileEntry(parentPath, cid, name string) (*FileEntry, error) {
+	limit := 1000
+	for offset := 0; ; offset += limit {
+		fileEntries := []*FileEntry{}
+		resp := &Response{
+			Data: &fileEntries,
+		}
+		u := url.Values{}
+		u.Add("cid", cid)
+		u.Add("show_dir", "1")
+		u.Add("offset", fmt.Sprint(offset))
+		u.Add("limit", fmt.Sprint(limit))
+		p.ratelimit.Wait("/open/ufile/files")
+		err := p.send(http.MethodGet, "/open/ufile/files?"+u.Encode(), nil, resp)
+		if err != nil {
+			return nil, err
+		}
+		if resp.State == false {
+			return nil, errors.New(resp.Message)
+		}
+		var found *FileEntry
+		for _, fileEntry := range fileEntries {
+			p.storePathCache(path.Join(parentPath, fileEntry.Fn), fileEntry)
+			if fileEntry.Fn == name {
+				found = fileEntry
+			}
+		}
+		if found != nil {
+			return found, nil
+		}
+		if len(fileEntries) < limit {
+			break
+		}
+	}
+	return nil, fmt.Errorf("%s not exist", path.Join(parentPath, name))
+}
+
+func (p *PluginImpl) getPlayVideoInfo(reqURL url.Values) (*PlayVideoInfo, error) {
+	playVideoInfo := &PlayVideoInfo{}
+	resp := Response{
+		Data: playVideoInfo,
+	}
+	p.ratelimit.Wait("/open/video/play")
+	err := p.send(http.MethodGet, "/open/video/play?"+reqURL.Encode(), nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.State != true {
+		slog.Error("get play video info failed", "msg", resp.Message)
+		return nil, nil
+	}
+	return playVideoInfo, nil
+}
+
+// appendPlayVideo append transcode address of selected audio track,
+// transcode only has selected audio track,other tracks are in original file,
+// so every other track is returned as original file titled with track
+func appendPlayVideo(fileResource *plugin.FileResource, playVideoInfo *PlayVideoInfo, original *plugin.FileResource_FileResourceData) {
+	trackTitle := selectedTrackTitle(playVideoInfo.MultitrackList)
+	for _, videoURL := range playVideoInfo.VideoURL {
+		title := videoURL.Title
+		if trackTitle != "" {
+			title = fmt.Sprintf("%s %s", videoURL.Title, trackTitle)
+		}
+		data := &plugin.FileResource_FileResourceData{
+			Url:          videoURL.URL,
+			ResourceType: plugin.FileResource_Video,
+			Title:        title,
+			Header: map[string]string{
+				"User-Agent": httpclient.GetDefaultUserAgent(),
+			},
+		}
+		if videoURL.DefinitionN == 1 {
+			data.Resolution = plugin.FileResource_SD
+		} else if videoURL.DefinitionN == 2 {
+			data.Resolution = plugin.FileResource_LD
+		} else if videoURL.DefinitionN == 3 {
+			data.Resolution = plugin.FileResource_HD
+		} else if videoURL.DefinitionN == 4 {
+			data.Resolution = plugin.FileResource_FHD
+		} else if videoURL.DefinitionN == 5 {
+			data.Resolution = plugin.FileResource_Original
+		}
+		fileResource.FileResourceData = append(fileResource.FileResourceData, data)
+	}
+	if original == nil || len(playVideoInfo.MultitrackList) <= 1 {
+		return
+	}
+	for _, track := range playVideoInfo.MultitrackList {
+		if track.IsSelected == 1 && len(playVideoInfo.VideoURL) > 0 {
+			continue
+		}
+		data := original.CloneVT()
+		data.Title = track.Title
+		fileResource.FileResourceData = append(fileResource.FileResourceData, data)
+	}
+}
+
+// selectedTrackTitle return title of selected audio track,empty if video has one track
+func selectedTrackTitle(tracks []AudioTrack) string {
+	if len(tracks) <= 1 {
+		return ""
+	}
+	for _, track := range tracks {
+		if track.IsSelected == 1 {
+			return track.Title
+		}
+	}
+	return ""
+}
+
+// subtitleTitle keep language in title,player use it to auto select subtitle
+func subtitleTitle(subtitle Subtitle) string {
+	if subtitle.Language == "" {
+		return subtitle.Title
+	}
+	if subtitle.Title == "" || strings.Contains(subtitle.Title, subtitle.Language) {
+		return subtitle.Language
+	}
+	return fmt.Sprintf("%s(%s)", subtitle.Title, subtitle.Language)
+}
+
+// search file by "/search/<keyword>",result name is full path
+func (p *PluginImpl) search(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+	}
+	if req.Path == util.SearchDir {
+		return dirEntry, nil
+	}
+	query, err := util.ParseSearchQuery(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	u := url.Values{}
+	u.Add("search_value", query.Keyword)
+	u.Add("cid", "0")
+	u.Add("offset", fmt.Sprint((req.Page-1)*req.PageSize))
+	u.Add("limit", fmt.Sprint(req.PageSize))
+	if searchType, ok := searchTypeMap[query.Category]; ok {
+		u.Add("type", searchType)
+		u.Add("fc", "2")
+	}
+	searchFiles := []*SearchFile{}
+	resp := &Response{
+		Data: &searchFiles,
+	}
+	p.ratelimit.Wait("/open/ufile/search")
+	err = p.send(http.MethodGet, "/open/ufile/search?"+u.Encode(), nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.State == false {
+		slog.Error("search failed", "keyword", query.Keyword, "err", resp.Message)
+		return nil, errors.New(resp.Message)
+	}
+	// parent dir of results are mostly same
+	parentPaths := map[string]string{"0": "/"}
+	for _, searchFile := range searchFiles {
+		fileEntry := searchFile.FileEntry()
+		parentPath, ok := parentPaths[searchFile.ParentId]
+		if !ok {
+			parentPath, err = p.getFolderPathById(searchFile.ParentId)
+			if err != nil {
+				return nil, err
+			}
+			parentPaths[searchFile.ParentId] = parentPath
+		}
+		p.storePathCache(path.Join(parentPath, fileEntry.Fn), fileEntry)
+		entry := &plugin.FileEntry{
+			Name:         strings.TrimPrefix(path.Join(parentPath, fileEntry.Fn), "/"),
+			Size:         fileEntry.Fs,
+			CreatedTime:  fileEntry.Uppt,
+			ModifiedTime: fileEntry.Upt,
+			AccessedTime: fileEntry.Upt,
+			FileType:     plugin.FileEntry_FileTypeFile,
+		}
+		if fileEntry.Fc == "0" {
+			entry.FileType = plugin.FileEntry_FileTypeDir
+		}
+		entry.RawData, _ = json.Marshal(fileEntry)
+		dirEntry.FileEntries = append(dirEntry.FileEntries, entry)
+	}
+	return dirEntry, nil
+}
+
+// getShareDirEntry list opened shares in "/shares",
+// if path is "/shares/<share link>",list root of share
+func (p *PluginImpl) getShareDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	if req.Path == util.SharesDir {
+		return p.shares.DirEntry(), nil
+	}
+	shareFile := &ShareFile{}
+	isShareRoot := req.FileEntry == nil || req.FileEntry.RawData == nil
+	if isShareRoot {
+		shareLink, err := util.ParseShareLink(req.Path)
+		if err != nil {
+			return nil, err
+		}
+		shareFile.ShareCode = shareLink.Id
+		shareFile.ReceiveCode = shareLink.Pwd
+		shareFile.Cid = "0"
+	} else {
+		err := json.Unmarshal(req.FileEntry.RawData, shareFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	u := url.Values{}
+	u.Add("share_code", shareFile.ShareCode)
+	u.Add("receive_code", shareFile.ReceiveCode)
+	u.Add("cid", shareFile.Cid)
+	u.Add("offset", fmt.Sprint((req.Page-1)*req.PageSize))
+	u.Add("limit", fmt.Sprint(req.PageSize))
+	snapData := &ShareSnapData{
+		List: []*ShareSnapFile{},
+	}
+	resp := &Response{
+		Data: snapData,
+	}
+	p.ratelimit.Wait("/share/snap")
+	err := p.sendURL(http.MethodGet, Api115WebAddr, "/share/snap?"+u.Encode(), nil, nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.State == false {
+		slog.Error("get share failed", "share_code", shareFile.ShareCode, "err", resp.Error)
+		return nil, errors.New(resp.Error)
+	}
+	if isShareRoot {
+		name := snapData.ShareInfo.ShareTitle
+		if name == "" {
+			name = shareFile.ShareCode
+		}
+		rawData, _ := json.Marshal(shareFile)
+		p.shares.Store(&plugin.FileEntry{
+			Name:     name,
+			FileType: plugin.FileEntry_FileTypeDir,
+			RawData:  rawData,
+		})
+	}
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+	}
+	for _, file := range snapData.List {
+		modifiedTime, _ := file.Time.Int64()
+		entry := &plugin.FileEntry{
+			Name:         file.Name,
+			Size:         uint64(file.Size),
+			FileType:     plugin.FileEntry_FileTypeFile,
+			CreatedTime:  uint64(modifiedTime),
+			ModifiedTime: uint64(modifiedTime),
+			AccessedTime: uint64(modifiedTime),
+		}
+		if file.Fid == "" {
+			entry.FileType = plugin.FileEntry_FileTypeDir
+			entry.RawData, _ = json.Marshal(&ShareFile{
+				ShareCode:   shareFile.ShareCode,
+				ReceiveCode: shareFile.ReceiveCode,
+				Cid:         file.Cid.String(),
+			})
+		}
+		dirEntry.FileEntries = append(dirEntry.FileEntries, entry)
+	}
+	return dirEntry, nil
+}
+
+func (p *PluginImpl) send(method string, uri string, req, resp any) error {
+	if p.token == nil {
+		return errors.New("token is nil")
+	}
+	header := http.Header{}
+	header.Set("Authorization", fmt.Sprintf("Bearer %s", p.token.AccessToken))
+	return p.sendURL(method, Api115PanAddr, uri, header, req, resp)
+}
+
+func (p *PluginImpl) sendURL(method string, baseURL string, uri string, header http.Header, req, resp any) error {
+	var body io.Reader
+	if req != nil {
+		urlValue, ok := req.(url.Values)
+		if !ok {
+			return errors.New("req not is urlValues")
+		}
+		body = strings.NewReader(urlValue.Encode())
+	}
+
+	httpReq, err := http.NewRequest(method, fmt.Sprintf("%s%s", baseURL, uri), body)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for key := range header {
+		httpReq.Header.Set(key, header.Get(key))
+	}
+	httpResp, err := p.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+
+	bodyData, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	slog.Debug("get request resp", "uri", uri, "req", req, "status_code", httpResp.StatusCode, "header", httpResp.Header, "resp", string(bodyData))
+	defer httpResp.Body.Close()
+
+	err = json.Unmarshal(bodyData, resp)
+	if err != nil {
+		slog.Error("unmarshal body data failed", "err", err)
+		return err
+	}
+	return nil
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"image/png"
+	"io"
+	"net/http"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/boombuler/barcode"
@@ -59,3 +63,104 @@ func TestAuth(t *testing.T) {
 		}
 	}
 }
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestGetFileEntryByPath(t *testing.T) {
+	files := map[string]string{
+		"0":   `[{"fid":"100","fc":"0","fn":"Movies"}]`,
+		"100": `[{"fid":"200","fc":"1","fn":"test.mkv","pc":"abc"}]`,
+	}
+	requestCount := 0
+	transport := http.DefaultClient.Transport
+	defer func() { http.DefaultClient.Transport = transport }()
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requestCount++
+		body := `{"state":false,"message":"not support"}`
+		if strings.HasSuffix(req.URL.Path, "/open/ufile/files") {
+			body = fmt.Sprintf(`{"state":true,"data":%s}`, files[req.URL.Query().Get("cid")])
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+
+	pluginImpl := NewPluginImpl()
+	pluginImpl.token = &plugin.Token{AccessToken: "token"}
+	fileEntry, err := pluginImpl.getFileEntryByPath("/Movies/test.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileEntry.Fid != "200" || fileEntry.Pc != "abc" {
+		t.Fatalf("unexpected file entry %+v", fileEntry)
+	}
+	count := requestCount
+	fileEntry, err = pluginImpl.getFileEntryByPath("/Movies/test.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileEntry.Fid != "200" || requestCount != count {
+		t.Fatalf("path cache not used %+v", fileEntry)
+	}
+	_, err = pluginImpl.getFileEntryByPath("/Movies/none.mkv")
+	if err == nil {
+		t.Fatal("expect not exist error")
+	}
+}
+
+func TestAppendPlayVideo(t *testing.T) {
+	playVideoInfo := &PlayVideoInfo{}
+	err := json.Unmarshal([]byte(`{
+		"video_url":[{"url":"https://115.com/hd.m3u8","definition_n":3,"title":"HD"},{"url":"https://115.com/fhd.m3u8","definition_n":4,"title":"FHD"}],
+		"multitrack_list":[{"title":"Japanese","is_selected":1},{"title":"Chinese","is_selected":0},{"title":"English","is_selected":0}]
+	}`), playVideoInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := &plugin.FileResource_FileResourceData{
+		Url:          "https://115.com/test.mkv",
+		Resolution:   plugin.FileResource_Original,
+		ResourceType: plugin.FileResource_Video,
+	}
+	fileResource := &plugin.FileResource{
+		FileResourceData: []*plugin.FileResource_FileResourceData{original},
+	}
+	appendPlayVideo(fileResource, playVideoInfo, original)
+	tracks := map[string]int{}
+	for _, data := range fileResource.FileResourceData[1:] {
+		for _, track := range playVideoInfo.MultitrackList {
+			if strings.HasSuffix(data.Title, track.Title) {
+				tracks[track.Title]++
+			}
+		}
+	}
+	if len(fileResource.FileResourceData) != 5 || len(tracks) != len(playVideoInfo.MultitrackList) {
+		t.Fatalf("unexpected tracks %v of %v", tracks, fileResource.FileResourceData)
+	}
+	if tracks["Japanese"] != 2 || fileResource.FileResourceData[3].Url != original.Url || original.Title != "" {
+		t.Fatalf("unexpected resources %v", fileResource.FileResourceData)
+	}
+}
+
+func TestParseOfflineLink(t *testing.T) {
+	for dirPath, want := range map[string]string{
+		"/离线下载": "",
+		"/离线下载/magnet:?xt=urn:btih:abc&dn=a/b": "magnet:?xt=urn:btih:abc&dn=a/b",
+		"/离线下载/ed2k:/|file|a.mkv|1|abc|/":      "ed2k://|file|a.mkv|1|abc|/",
+		"/离线下载/https://example.com/a.mkv":      "https://example.com/a.mkv",
+		"/离线下载/http:/example.com/a.mkv":        "http://example.com/a.mkv",
+	} {
+		link, err := parseOfflineLink(dirPath)
+		if err != nil || link != want {
+			t.Fatalf("parse %s return %s,%v", dirPath, link, err)
+		}
+	}
+	if _, err := parseOfflineLink("/离线下载/test.mkv"); err == nil {
+		t.Fatal("expect unsupported link error")
+	}
+}
@@ -14,11 +14,23 @@ type Response struct {
 type AuthToken struct {
 	ClientId      *plugin.Formdata_FormItem_StringValue `json:"clientID"`
 	ClientSecret  *plugin.Formdata_FormItem_StringValue `json:"clientSecret"`
+	DirectLink    *plugin.Formdata_FormItem_BoolValue   `json:"directLink"`
 	AccessToken   string                                `json:"accessToken"`
 	ExpiredAt     string                                `json:"expiredAt"`
 	ExpiredAtUnix int64                                 `json:"expiredAtUnix"`
 }
 
+func (a *AuthToken) DirectLinkEnabled() bool {
+	return a.DirectLink != nil && a.DirectLink.BoolValue != nil && a.DirectLink.BoolValue.Value
+}
+
+// setDefault fill form item which is not in auth data stored before it is added
+func (a *AuthToken) setDefault() {
+	if a.DirectLink == nil || a.DirectLink.BoolValue == nil {
+		a.DirectLink = plugin.Bool(false)
+	}
+}
+
 type UserInfo struct {
 	UID      int64  `json:"uid"`
 	Nickname string `json:"nickname"`
@@ -47,6 +59,11 @@ type DownloadInfo struct {
 	DownloadUrl string `json:"downloadUrl"`
 }
 
+// /api/v1/direct-link/url
+type DirectLinkInfo struct {
+	Url string `json:"url"`
+}
+
 type userTranscodeVideo struct {
 	ID         int    `json:"Id"`
 	UID        int    `json:"Uid"`
@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"plugins/util"
+	"sync"
 	"time"
 
 	"github.com/medianexapp/plugin_api/httpclient"
@@ -19,8 +22,20 @@ type PluginImpl struct {
 	client    *httpclient.Client
 	userInfo  *UserInfo
 	ratelimit *ratelimit.RateLimit
+
+	// parentFileId/pageSize/page -> lastFileId
+	pageCursor sync.Map
+	// fileId of files which has no direct link,skip direct link request of them
+	noDirectLink *util.Cache[uint64, bool]
 }
 
+var errTokenExpired = errors.New("access token expired")
+
+const (
+	noDirectLinkCacheSize = 10000
+	noDirectLinkCacheTTL  = 30 * time.Minute
+)
+
 // https://123yunpan.yuque.com/org-wiki-123yunpan-muaork/cr6ced/txgcvbfgh0gtuad5
 
 func NewPluginImpl() *PluginImpl {
@@ -30,10 +45,12 @@ func NewPluginImpl() *PluginImpl {
 		authData: &AuthToken{
 			ClientId:     plugin.String(""),
 			ClientSecret: plugin.String(""),
+			DirectLink:   plugin.Bool(false),
 		},
 		ratelimit: ratelimit.New(map[string]ratelimit.LimitConfig{
 			"api/v1/user/info": {Limit: 1, Duration: time.Second},
 		}),
+		noDirectLink: util.NewCache[uint64, bool](noDirectLinkCacheSize, noDirectLinkCacheTTL),
 	}
 }
 
@@ -62,6 +79,11 @@ func (p *PluginImpl) GetAuth() (*plugin.Auth, error) {
 								Name:  "Client Secret",
 								Value: p.authData.ClientSecret,
 							},
+							{
+								// use direct link space,need enable direct link on folder
+								Name:  "Direct Link",
+								Value: p.authData.DirectLink,
+							},
 						},
 					},
 				},
@@ -86,35 +108,75 @@ func (p *PluginImpl) CheckAuthMethod(authMethod *plugin.AuthMethod) (*plugin.Aut
 		}
 		p.authData.ClientId = accessToken.ClientId
 		p.authData.ClientSecret = accessToken.ClientSecret
+		p.authData.DirectLink = accessToken.DirectLink
+		p.authData.setDefault()
 	case *plugin.AuthMethod_Formdata:
 		formItems := v.Formdata.FormItems
 		p.authData.ClientId = formItems[0].Value.(*plugin.Formdata_FormItem_StringValue)
 		p.authData.ClientSecret = formItems[1].Value.(*plugin.Formdata_FormItem_StringValue)
+		if len(formItems) > 2 {
+			p.authData.DirectLink, _ = formItems[2].Value.(*plugin.Formdata_FormItem_BoolValue)
+		}
+		p.authData.setDefault()
+	}
+	err := p.refreshAccessToken()
+	if err != nil {
+		return nil, err
 	}
+	authBytes, err := json.Marshal(p.authData)
+	if err != nil {
+		return nil, err
+	}
+	return &plugin.AuthData{
+		AuthDataBytes:       authBytes,
+		AuthDataExpiredTime: uint64(p.authData.ExpiredAtUnix),
+	}, nil
+}
+
+// refreshAccessToken get new access token by client id and client secret
+func (p *PluginImpl) refreshAccessToken() error {
 	reqData := map[string]string{
 		"clientID":     p.authData.ClientId.StringValue.Value,
 		"clientSecret": p.authData.ClientSecret.StringValue.Value,
 	}
-	respData := AuthToken{
+	respData := &AuthToken{
 		ClientId:     p.authData.ClientId,
 		ClientSecret: p.authData.ClientSecret,
+		DirectLink:   p.authData.DirectLink,
 	}
-	err := p.sendData(http.MethodPost, "/api/v1/access_token", reqData, &respData)
+	err := p.doSendData(http.MethodPost, "/api/v1/access_token", reqData, respData)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	tt, err := time.Parse("2006-01-02T15:04:05+08:00", respData.ExpiredAt)
+	tt, err := time.Parse(time.RFC3339, respData.ExpiredAt)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	authBytes, err := json.Marshal(respData)
-	if err != nil {
-		return nil, err
+	respData.ExpiredAtUnix = tt.Unix()
+	p.authData = respData
+	slog.Info("refresh access token success", "expiredAt", respData.ExpiredAt)
+	return nil
+}
+
+func (p *PluginImpl) canRefreshAccessToken() bool {
+	return p.authData != nil && p.authData.ClientId != nil && p.authData.ClientId.StringValue.Value != "" &&
+		p.authData.ClientSecret != nil && p.authData.ClientSecret.StringValue.Value != ""
+}
+
+// accessTokenExpired check token expired,refresh it 5 minutes early
+func (p *PluginImpl) accessTokenExpired() bool {
+	if p.authData == nil || p.authData.AccessToken == "" {
+		return false
 	}
-	return &plugin.AuthData{
-		AuthDataBytes:       authBytes,
-		AuthDataExpiredTime: uint64(tt.Unix()),
-	}, nil
+	expiredAtUnix := p.authData.ExpiredAtUnix
+	if expiredAtUnix == 0 {
+		tt, err := time.Parse(time.RFC3339, p.authData.ExpiredAt)
+		if err != nil {
+			return false
+		}
+		expiredAtUnix = tt.Unix()
+	}
+	return time.Now().Add(5*time.Minute).Unix() > expiredAtUnix
 }
 
 // CheckAuthData use authDataBytes to uath
@@ -126,6 +188,7 @@ func (p *PluginImpl) CheckAuthData(authDataBytes []byte) error {
 	if err != nil {
 		return err
 	}
+	authData.setDefault()
 	p.authData = &authData
 
 	p.userInfo = &UserInfo{}
@@ -153,9 +216,12 @@ func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEnt
 	if req.PageSize == 0 {
 		req.PageSize = 100
 	}
-	params := map[string]string{
-		"limit":      fmt.Sprintf("%d", req.PageSize),
-		"lastFileId": req.DirPageKey,
+	getDirEntryResp := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+	}
+	// -1 is last page
+	if req.DirPageKey == "-1" {
+		return getDirEntryResp, nil
 	}
 	var parentFileId string
 	if req.Path == "/" {
@@ -171,19 +237,25 @@ func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEnt
 		}
 		parentFileId = fmt.Sprint(fileItem.FileId)
 	}
-	params["parentFileId"] = parentFileId
-	resp := FileListResponse{
-		FileList: []FileItem{},
+	lastFileId := req.DirPageKey
+	if lastFileId == "" && req.Page > 1 {
+		var err error
+		lastFileId, err = p.getPageCursor(parentFileId, req.PageSize, req.Page)
+		if err != nil {
+			return nil, err
+		}
+		if lastFileId == "-1" {
+			return getDirEntryResp, nil
+		}
 	}
-	slog.Info("send request", "params", params)
-	err := p.sendData(http.MethodGet, "/api/v2/file/list", params, &resp)
+	resp, err := p.listFile(parentFileId, req.PageSize, lastFileId)
 	if err != nil {
 		return nil, err
 	}
-	getDirEntryResp := &plugin.DirEntry{
-		FileEntries: []*plugin.FileEntry{},
-		DirPageKey:  fmt.Sprint(resp.FileList),
+	if req.Page > 0 {
+		p.pageCursor.Store(pageCursorKey(parentFileId, req.PageSize, req.Page+1), fmt.Sprint(resp.LastFileId))
 	}
+	getDirEntryResp.DirPageKey = fmt.Sprint(resp.LastFileId)
 	for _, fileItem := range resp.FileList {
 		if fileItem.Trashed == 1 {
 			continue
@@ -217,6 +289,54 @@ func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEnt
 	return getDirEntryResp, nil
 }
 
+func pageCursorKey(parentFileId string, pageSize, page uint64) string {
+	return fmt.Sprintf("%s/%d/%d", parentFileId, pageSize, page)
+}
+
+// getPageCursor translate page number to lastFileId cursor,
+// list from first page if cursor not cached
+func (p *PluginImpl) getPageCursor(parentFileId string, pageSize, page uint64) (string, error) {
+	if v, ok := p.pageCursor.Load(pageCursorKey(parentFileId, pageSize, page)); ok {
+		return v.(string), nil
+	}
+	lastFileId := ""
+	for i := uint64(1); i < page; i++ {
+		if v, ok := p.pageCursor.Load(pageCursorKey(parentFileId, pageSize, i+1)); ok {
+			lastFileId = v.(string)
+		} else {
+			resp, err := p.listFile(parentFileId, pageSize, lastFileId)
+			if err != nil {
+				return "", err
+			}
+			lastFileId = fmt.Sprint(resp.LastFileId)
+			p.pageCursor.Store(pageCursorKey(parentFileId, pageSize, i+1), lastFileId)
+		}
+		if lastFileId == "-1" {
+			break
+		}
+	}
+	return lastFileId, nil
+}
+
+func (p *PluginImpl) listFile(parentFileId string, limit uint64, lastFileId string) (*FileListResponse, error) {
+	params := map[string]string{
+		"parentFileId": parentFileId,
+		"limit":        fmt.Sprintf("%d", limit),
+	}
+	if lastFileId != "" {
+		params["lastFileId"] = lastFileId
+	}
+	resp := &FileListResponse{
+		FileList: []FileItem{},
+	}
+	slog.Info("send request", "params", params)
+	err := p.sendData(http.MethodGet, "/api/v2/file/list", params, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 // GetFileResource implements IPlugin.
 func (p *PluginImpl) GetFileResource(req *plugin.GetFileResourceRequest) (*plugin.FileResource, error) {
 	slog.Debug("GetFileResource", "req", req)
@@ -231,16 +351,34 @@ func (p *PluginImpl) GetFileResource(req *plugin.GetFileResourceRequest) (*plugi
 	if err != nil {
 		return nil, err
 	}
-	downInfo := &DownloadInfo{}
-	err = p.sendData(http.MethodGet, "/api/v1/file/download_info", map[string]string{
-		"fileId": fmt.Sprint(fileItem.FileId),
-	}, downInfo)
-	if err != nil {
-		return nil, err
+	downloadUrl := ""
+	if _, ok := p.noDirectLink.Get(fileItem.FileId); !ok && p.authData.DirectLinkEnabled() {
+		// direct link not limit download quota and speed,
+		// it only work when file in direct link enabled folder
+		directLinkInfo := &DirectLinkInfo{}
+		err = p.sendData(http.MethodGet, "/api/v1/direct-link/url", map[string]string{
+			"fileID": fmt.Sprint(fileItem.FileId),
+		}, directLinkInfo)
+		if err != nil || directLinkInfo.Url == "" {
+			slog.Warn("get direct link failed,use download info", "fileId", fileItem.FileId, "err", err)
+			p.noDirectLink.Set(fileItem.FileId, true)
+		} else {
+			downloadUrl = directLinkInfo.Url
+		}
+	}
+	if downloadUrl == "" {
+		downInfo := &DownloadInfo{}
+		err = p.sendData(http.MethodGet, "/api/v1/file/download_info", map[string]string{
+			"fileId": fmt.Sprint(fileItem.FileId),
+		}, downInfo)
+		if err != nil {
+			return nil, err
+		}
+		downloadUrl = downInfo.DownloadUrl
 	}
 	fileResource.FileResourceData = append(fileResource.FileResourceData,
 		&plugin.FileResource_FileResourceData{
-			Url:          downInfo.DownloadUrl,
+			Url:          downloadUrl,
 			Resolution:   plugin.FileResource_Original,
 			ResourceType: plugin.FileResource_Video,
 		},
@@ -287,7 +425,28 @@ func (p *PluginImpl) GetFileResource(req *plugin.GetFileResourceRequest) (*plugi
 
 }
 
+// sendData send request with access token,
+// refresh token when it is expired or server return 401
 func (p *PluginImpl) sendData(method string, uri string, reqData any, respData any) error {
+	if p.accessTokenExpired() && p.canRefreshAccessToken() {
+		err := p.refreshAccessToken()
+		if err != nil {
+			return err
+		}
+	}
+	err := p.doSendData(method, uri, reqData, respData)
+	if errors.Is(err, errTokenExpired) && p.canRefreshAccessToken() {
+		slog.Warn("access token expired,refresh it", "uri", uri)
+		err = p.refreshAccessToken()
+		if err != nil {
+			return err
+		}
+		err = p.doSendData(method, uri, reqData, respData)
+	}
+	return err
+}
+
+func (p *PluginImpl) doSendData(method string, uri string, reqData any, respData any) error {
 	b := httpclient.NewBuilder().
 		Request(fmt.Sprintf("%s%s", PanURl, uri)).
 		SetMethod(method).
@@ -308,13 +467,28 @@ func (p *PluginImpl) sendData(method string, uri string, reqData any, respData a
 		b = b.SetHeader("Authorization", fmt.Sprintf("Bearer %s", p.authData.AccessToken))
 	}
 
+	httpResp, err := b.RawResponse()
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode == http.StatusUnauthorized {
+		return errTokenExpired
+	}
+	respBytes, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
 	rsp := &Response{
 		Data: respData,
 	}
-	err := b.JSONResponse(rsp)
+	err = json.Unmarshal(respBytes, rsp)
 	if err != nil {
 		return err
 	}
+	if rsp.Code == http.StatusUnauthorized {
+		return errTokenExpired
+	}
 	if rsp.Code != 0 {
 		slog.Error("Request Failed", "code", rsp.Code, "message", rsp.Message)
 		return errors.New(rsp.Message)
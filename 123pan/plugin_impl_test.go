@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/medianexapp/plugin_api/plugin"
 )
@@ -74,3 +77,64 @@ func TestPluginImpl(t *testing.T) {
 	}
 	return
 }
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestDirPageCursor(t *testing.T) {
+	tokenCount := 0
+	transport := http.DefaultClient.Transport
+	defer func() { http.DefaultClient.Transport = transport }()
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var body string
+		switch req.URL.Path {
+		case "/api/v1/access_token":
+			tokenCount++
+			body = fmt.Sprintf(`{"code":0,"data":{"accessToken":"token%d","expiredAt":"%s"}}`, tokenCount, time.Now().Add(time.Hour).Format(time.RFC3339))
+		case "/api/v2/file/list":
+			if req.Header.Get("Authorization") == "Bearer expired" {
+				body = `{"code":401,"message":"token is expired"}`
+				break
+			}
+			switch req.URL.Query().Get("lastFileId") {
+			case "":
+				body = `{"code":0,"data":{"lastFileId":2,"fileList":[{"fileId":1,"fileName":"a.mkv"},{"fileId":2,"fileName":"b.mkv"}]}}`
+			case "2":
+				body = `{"code":0,"data":{"lastFileId":-1,"fileList":[{"fileId":3,"fileName":"c.mkv"}]}}`
+			default:
+				body = `{"code":1,"message":"invalid lastFileId"}`
+			}
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+
+	p := NewPluginImpl()
+	p.authData.ClientId.StringValue.Value = "id"
+	p.authData.ClientSecret.StringValue.Value = "secret"
+	p.authData.AccessToken = "expired"
+	p.authData.ExpiredAtUnix = time.Now().Add(time.Hour).Unix()
+
+	resp, err := p.GetDirEntry(&plugin.GetDirEntryRequest{Path: "/", Page: 2, PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.FileEntries) != 1 || resp.FileEntries[0].Name != "c.mkv" || resp.DirPageKey != "-1" {
+		t.Fatalf("unexpected page 2 %+v", resp)
+	}
+	if tokenCount != 1 || p.authData.AccessToken != "token1" {
+		t.Fatalf("access token not refreshed %d %s", tokenCount, p.authData.AccessToken)
+	}
+	resp, err = p.GetDirEntry(&plugin.GetDirEntryRequest{Path: "/", Page: 3, PageSize: 2, DirPageKey: resp.DirPageKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.FileEntries) != 0 {
+		t.Fatalf("expect empty last page %+v", resp)
+	}
+}
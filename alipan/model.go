@@ -7,6 +7,8 @@ import (
 
 var (
 	AlipanURL = "https://openapi.alipan.com"
+	// share api is not in open api
+	AlipanShareURL = "https://api.aliyundrive.com"
 )
 
 type QrcodeResponse struct {
@@ -69,6 +71,25 @@ type OpenFileListResponse struct {
 	Items      []*FileEntry `json:"items"`
 }
 
+// /adrive/v1.0/openFile/search
+type OpenFileSearchRequest struct {
+	DriveId string `json:"drive_id"`
+	Limit   int    `json:"limit"`
+	Marker  string `json:"marker"`
+	Query   string `json:"query"`    // name match "keyword" and category = "video"
+	OrderBy string `json:"order_by"` // name ASC
+}
+
+// /adrive/v1.0/openFile/get_path
+type OpenFileGetPathRequest struct {
+	DriveId string `json:"drive_id"`
+	FileId  string `json:"file_id"`
+}
+
+type OpenFileGetPathResponse struct {
+	Items []*FileEntry `json:"items"` // file and all parent dirs
+}
+
 // /adrive/v1.0/openFile/get_by_path
 type OpenFilegetbypathRequest struct {
 	DriveId  string `json:"drive_id"`
@@ -130,3 +151,54 @@ type LiveTranscodingSubtitleTask struct {
 	Status   string `json:"status"` // finished running failed
 	Url      string `json:"url"`
 }
+
+// /v2/share_link/get_share_token
+type GetShareTokenRequest struct {
+	ShareId  string `json:"share_id"`
+	SharePwd string `json:"share_pwd"`
+}
+
+type GetShareTokenResponse struct {
+	ShareToken string `json:"share_token"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
+// /adrive/v3/share_link/get_share_by_anonymous
+type GetShareByAnonymousRequest struct {
+	ShareId string `json:"share_id"`
+}
+
+type GetShareByAnonymousResponse struct {
+	ShareName   string `json:"share_name"`
+	CreatorName string `json:"creator_name"`
+}
+
+// /adrive/v2/file/list_by_share
+type ListByShareRequest struct {
+	ShareId        string `json:"share_id"`
+	ParentFileId   string `json:"parent_file_id"`
+	Limit          int    `json:"limit"`
+	Marker         string `json:"marker"`
+	OrderBy        string `json:"order_by"`        // name
+	OrderDirection string `json:"order_direction"` // ASC
+}
+
+// /v2/file/get_share_link_download_url
+type GetShareLinkDownloadUrlRequest struct {
+	ShareId   string `json:"share_id"`
+	FileId    string `json:"file_id"`
+	ExpireSec int    `json:"expire_sec"`
+}
+
+type GetShareLinkDownloadUrlResponse struct {
+	DownloadUrl string `json:"download_url"`
+	Url         string `json:"url"`
+	Expiration  string `json:"expiration"`
+}
+
+// ShareFile is raw data of share file entry
+type ShareFile struct {
+	ShareId  string `json:"share_id"`
+	SharePwd string `json:"share_pwd"`
+	FileId   string `json:"file_id"`
+}
@@ -1,527 +1,885 @@
-//go:build wasip1
-
-package main
-
-import (
-	"bytes"
-	"encoding/base64"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
-	"log/slog"
-	"net/http"
-	"net/url"
-	"os"
-	"path/filepath"
-	"plugins/util"
-	"strings"
-	"sync"
-	"time"
-
-	_ "github.com/labulakalia/wazero_net/wasi/http"
-	"github.com/medianexapp/plugin_api/plugin"
-	"github.com/medianexapp/plugin_api/ratelimit"
-)
-
-/*
-NOTE: net and http use package
-"github.com/labulakalia/wazero_net/wasi/http"
-"github.com/labulakalia/wazero_net/wasi/net"
-*/
-
-type PluginImpl struct {
-	oauthServerURL string
-
-	token                 *plugin.Token
-	userInfo              *UserInfoResponse
-	getDriverInfoResponse *UserGetDriverInfoResponse
-
-	ratelimit *ratelimit.RateLimit
-}
-
-func NewPluginImpl() *PluginImpl {
-	slog.SetLogLoggerLevel(slog.LevelDebug)
-	limitConfigMap := map[string]ratelimit.LimitConfig{
-		"/adrive/v1.0/openFile/list": ratelimit.LimitConfig{
-			Limit:    40,
-			Duration: 10 * time.Second,
-		},
-		"/adrive/v1.0/openFile/getDownloadUrl": ratelimit.LimitConfig{
-			Limit:    1,
-			Duration: time.Second,
-		},
-	}
-	return &PluginImpl{
-		ratelimit: ratelimit.New(limitConfigMap),
-	}
-}
-
-// Id implements IPlugin.
-func (p *PluginImpl) PluginId() (string, error) {
-	return "alipan", nil
-}
-
-func (p *PluginImpl) send(method string, uri string, req, resp any) error {
-	_ = p.ratelimit.Wait(uri)
-	var body io.Reader
-	if req != nil {
-		data, err := json.Marshal(req)
-		if err != nil {
-			return err
-		}
-		body = bytes.NewReader(data)
-	}
-
-	httpReq, err := http.NewRequest(method, fmt.Sprintf("%s%s", AlipanURL, uri), body)
-	if err != nil {
-		return err
-	}
-	httpReq.Header.Add("Content-Type", "application/json")
-	if p.token != nil {
-		httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.token.AccessToken))
-	}
-	httpResp, err := http.DefaultClient.Do(httpReq)
-	if err != nil {
-		return err
-	}
-	bodyData, err := io.ReadAll(httpResp.Body)
-	if err != nil {
-		return err
-	}
-	slog.Debug("get request resp", "uri", uri, "req", req, "status_code", httpResp.StatusCode, "resp", string(bodyData))
-	defer httpResp.Body.Close()
-	if httpResp.StatusCode != http.StatusOK {
-		errResp := &ErrResponse{}
-		err = json.Unmarshal(bodyData, errResp)
-		if err != nil {
-			return err
-		}
-		return errResp
-	}
-	err = json.Unmarshal(bodyData, resp)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (p *PluginImpl) getQrcode() (*plugin.AuthMethod_Scanqrcode, error) {
-	qrResp := &QrcodeResponse{}
-	qrBytes, err := util.GetAuthQrcode("alipan")
-	if err != nil {
-		return nil, err
-	}
-	err = json.Unmarshal(qrBytes, qrResp)
-	if err != nil {
-		return nil, err
-	}
-
-	return &plugin.AuthMethod_Scanqrcode{
-		Scanqrcode: &plugin.Scanqrcode{
-			QrcodeImageParam: qrResp.Sid,
-			QrcodeExpireTime: uint64(time.Now().Add(time.Minute * 3).Unix()),
-			QrcodeImageUrl:   qrResp.QrCodeUrl,
-		},
-	}, nil
-}
-
-// GetAuthe implements IPlugin.
-func (p *PluginImpl) GetAuth() (*plugin.Auth, error) {
-	auth := &plugin.Auth{
-		AuthMethods: []*plugin.AuthMethod{},
-	}
-
-	url := util.GetAuthAddr("alipan")
-	authCallbackUrl := &plugin.AuthMethod_Callback{
-		Callback: &plugin.Callback{
-			CallbackUrl: url,
-		},
-	}
-	auth.AuthMethods = append(auth.AuthMethods, &plugin.AuthMethod{
-		Method: authCallbackUrl,
-	})
-
-	authScanQrcode, err := p.getQrcode()
-	if err != nil {
-		slog.Error("get qrcode failed", "err", err)
-		return nil, err
-	}
-
-	auth.AuthMethods = append(auth.AuthMethods, &plugin.AuthMethod{
-		Method: authScanQrcode,
-	})
-
-	return auth, nil
-}
-
-// CheckAuth implements IPlugin.
-func (p *PluginImpl) CheckAuthMethod(authMethod *plugin.AuthMethod) (authData *plugin.AuthData, err error) {
-	var (
-		token        *plugin.Token
-		authCode     string
-		refreshToken string
-	)
-	switch v := authMethod.Method.(type) {
-	case *plugin.AuthMethod_Scanqrcode:
-		url := fmt.Sprintf("https://openapi.alipan.com/oauth/qrcode/%s/status", v.Scanqrcode.QrcodeImageParam)
-		resp, err := util.HttpClient.Get(url)
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
-		type QrcodeStatus struct {
-			Status   string `json:"status"`
-			AuthCode string `json:"authCode"`
-		}
-		respBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		slog.Debug("check alipan qrcode status", "qrcodeStatus", string(respBytes), "status", resp.StatusCode)
-		qrcodeStatus := &QrcodeStatus{}
-		if err := json.Unmarshal(respBytes, qrcodeStatus); err != nil {
-			return nil, err
-		}
-
-		if qrcodeStatus.Status == "QRCodeExpired" {
-			slog.Error("qrcode expired", "key", v.Scanqrcode.QrcodeImageParam)
-			return nil, fmt.Errorf("QR code expired")
-		}
-		if qrcodeStatus.Status != "LoginSuccess" {
-			slog.Warn("qrcode not login success", "status", qrcodeStatus.Status)
-			return nil, nil
-		}
-		authCode = qrcodeStatus.AuthCode
-	case *plugin.AuthMethod_Refresh:
-		retoken := &plugin.Token{}
-		err = retoken.UnmarshalVT(v.Refresh.AuthData.AuthDataBytes)
-		if err != nil {
-			return nil, err
-		}
-		refreshToken = retoken.RefreshToken
-	case *plugin.AuthMethod_Callback:
-		slog.Info("recv callback data", "callBackData", v.Callback.CallbackUrlData)
-		token = &plugin.Token{}
-		urlParse, err := url.Parse(v.Callback.CallbackUrlData)
-		if err != nil {
-			return nil, err
-		}
-		data, err := base64.URLEncoding.DecodeString(urlParse.Query().Get("token"))
-		if err != nil {
-			return nil, err
-		}
-		err = token.UnmarshalVT(data)
-		if err != nil {
-			return nil, err
-		}
-	default:
-		return nil, fmt.Errorf("unsupport %+v", v)
-	}
-	if token == nil {
-		token, err = util.GetAuthToken(&util.GetAuthTokenRequest{
-			Id:   "alipan",
-			Code: authCode,
-
-			RefreshToken: refreshToken,
-		})
-		if err != nil {
-			slog.Error("authCode to access token failed", "err", err)
-			return nil, err
-		}
-	}
-
-	tokenBytes, err := token.MarshalVT()
-	if err != nil {
-		slog.Error("marshal token failed", "err", err)
-		return nil, err
-	}
-	expireTime := time.Now().Add(time.Second * time.Duration(token.ExpiresIn-300)).Unix()
-	authData = &plugin.AuthData{
-		AuthDataBytes:       tokenBytes,
-		AuthDataExpiredTime: uint64(expireTime),
-	}
-	slog.Info("get access token success")
-	return authData, nil
-}
-
-// InitAuth implements IPlugin.
-func (p *PluginImpl) CheckAuthData(authDataBytes []byte) error {
-	token := &plugin.Token{}
-	err := token.UnmarshalVT(authDataBytes)
-	if err != nil {
-		return err
-	}
-	p.token = token
-	resp := &UserInfoResponse{}
-	err = p.send(http.MethodGet, "/oauth/users/info", nil, resp)
-	if err != nil {
-		return err
-	}
-	p.userInfo = resp
-	p.getDriverInfoResponse = &UserGetDriverInfoResponse{}
-	err = p.send(http.MethodPost, "/adrive/v1.0/user/getDriveInfo", nil, p.getDriverInfoResponse)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// AuthId implements IPlugin.
-func (p *PluginImpl) PluginAuthId() (string, error) {
-	if p.userInfo == nil {
-		return "", fmt.Errorf("can get user info")
-	}
-	return p.userInfo.Id, nil
-}
-
-func (d *PluginImpl) getDriverPath(path string) (string, string, error) {
-	path = filepath.Clean(path)
-	var driverId string
-	if strings.HasPrefix(path, "/资源库") {
-		path, _ = strings.CutPrefix(path, "/资源库")
-		driverId = d.getDriverInfoResponse.ResourceDriverId
-	} else if strings.HasPrefix(path, "/备份盘") {
-		path, _ = strings.CutPrefix(path, "/备份盘")
-		driverId = d.getDriverInfoResponse.BackupDriverId
-	} else {
-		slog.Error("valid path", "path", path)
-		return "", "", os.ErrNotExist
-	}
-	if path == "" {
-		path = "/"
-	}
-	return driverId, path, nil
-}
-
-var (
-	pageMarker sync.Map
-)
-
-// GetDirEntry implements IPlugin.
-func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
-	dirEntry := &plugin.DirEntry{
-		FileEntries: []*plugin.FileEntry{},
-		PageSize:    100,
-	}
-	if req.PageSize == 0 {
-		req.PageSize = dirEntry.PageSize
-	}
-	if req.Path == "/" {
-		if p.getDriverInfoResponse.ResourceDriverId != "" {
-			dirEntry.FileEntries = append(dirEntry.FileEntries, &plugin.FileEntry{
-				Name:     "资源库",
-				FileType: plugin.FileEntry_FileTypeDir,
-			})
-		}
-		if p.getDriverInfoResponse.BackupDriverId != "" {
-			dirEntry.FileEntries = append(dirEntry.FileEntries, &plugin.FileEntry{
-				Name:     "备份盘",
-				FileType: plugin.FileEntry_FileTypeDir,
-			})
-		}
-		return dirEntry, nil
-	}
-	driverId, path, err := p.getDriverPath(req.Path)
-	if err != nil {
-		slog.Error("getDriver failed", "err", err)
-		return nil, err
-	}
-	parentFileId := ""
-	if path == "/" {
-		parentFileId = "root"
-	} else {
-		fileEntry := &FileEntry{}
-		if req.FileEntry != nil && req.FileEntry.RawData != nil {
-			err = json.Unmarshal(req.FileEntry.RawData, fileEntry)
-			if err != nil {
-				slog.Error("unmarshal failed", "rawData", string(req.FileEntry.RawData), "err", err)
-				return nil, err
-			}
-			parentFileId = fileEntry.FileId
-		}
-		if parentFileId == "" {
-			fileEntry, err = p.getFileEntryInfoByPath(driverId, path)
-			if err != nil {
-				return nil, err
-			}
-
-			parentFileId = fileEntry.FileId
-		}
-		if parentFileId == "" {
-			return nil, errors.New("parent file id is empty")
-		}
-		parentFileId = fileEntry.FileId
-	}
-	if req.Page > 1 {
-		// page is empty
-		return dirEntry, nil
-	}
-
-	openFileReq := &OpenFileListRequest{
-		DriveId:      driverId,
-		Limit:        int(req.PageSize),
-		OrderBy:      "name_enhanced",
-		ParentFileId: parentFileId,
-		Category:     "",
-		Marker:       req.DirPageKey,
-	}
-
-	openFileRsp := &OpenFileListResponse{}
-	err = p.send(http.MethodPost, "/adrive/v1.0/openFile/list", openFileReq, openFileRsp)
-	if err != nil {
-		return nil, err
-	}
-	for _, item := range openFileRsp.Items {
-		fileType := plugin.FileEntry_FileTypeFile
-		if item.Type == "folder" {
-			fileType = plugin.FileEntry_FileTypeDir
-		}
-		fileEntry := &plugin.FileEntry{
-			Name:         item.Name,
-			FileType:     fileType,
-			Size:         item.Size,
-			CreatedTime:  uint64(item.CreatedTime.Unix()),
-			ModifiedTime: uint64(item.UpdatedTime.Unix()),
-			AccessedTime: uint64(item.UpdatedTime.Unix()),
-		}
-		itemBytes, err := json.Marshal(item)
-		if err == nil {
-			fileEntry.RawData = itemBytes
-		}
-		dirEntry.FileEntries = append(dirEntry.FileEntries, fileEntry)
-	}
-	dirEntry.DirPageKey = openFileRsp.NextMarker
-	return dirEntry, nil
-}
-
-func (p *PluginImpl) getFileEntryInfoByPath(driverId, path string) (*FileEntry, error) {
-
-	rsp := &OpenFilegetbypathResponse{
-		FileEntry: &FileEntry{},
-	}
-	req := &OpenFilegetbypathRequest{
-		DriveId:  driverId,
-		FilePath: path,
-	}
-
-	err := p.send(http.MethodPost, "/adrive/v1.0/openFile/get_by_path", req, rsp)
-	if err != nil {
-		return nil, err
-	}
-	slog.Info("getFileEntryInfoByPath", "resp", rsp)
-	return rsp.FileEntry, nil
-}
-
-// GetFileResource implements IPlugin.
-func (p *PluginImpl) GetFileResource(req *plugin.GetFileResourceRequest) (*plugin.FileResource, error) {
-	driverId, path, err := p.getDriverPath(req.FilePath)
-	if err != nil {
-		return nil, err
-	}
-	var fileId string
-	if req.FileEntry != nil && req.FileEntry.RawData != nil {
-		fileEntry := FileEntry{}
-		err = json.Unmarshal(req.FileEntry.RawData, &fileEntry)
-		if err != nil {
-			return nil, err
-		}
-		fileId = fileEntry.FileId
-	}
-	if fileId == "" {
-		fileEntry, err := p.getFileEntryInfoByPath(driverId, path)
-		if err != nil {
-			return nil, err
-		}
-		fileId = fileEntry.FileId
-	}
-
-	fileResource := &plugin.FileResource{
-		FileResourceData: []*plugin.FileResource_FileResourceData{},
-	}
-
-	getFileDownloadReq := &OpenFilegetDownloadUrlRequest{
-		DriveId:   driverId,
-		FileId:    fileId,
-		ExpireSec: 900,
-	}
-	getFileDownloadResp := &OpenFilegetDownloadUrlResponse{}
-	err = p.send(http.MethodPost, "/adrive/v1.0/openFile/getDownloadUrl", getFileDownloadReq, getFileDownloadResp)
-	if err != nil {
-		return nil, err
-	}
-	expireTime, err := time.Parse("2006-01-02T15:04:05Z", getFileDownloadResp.Expiration)
-	if err == nil {
-		fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
-			Url:          getFileDownloadResp.Url,
-			ExpireTime:   uint64(expireTime.Unix()),
-			Resolution:   plugin.FileResource_Original,
-			ResourceType: plugin.FileResource_Video,
-		})
-	} else {
-		slog.Error("get download url failed", "err", err)
-	}
-	if req.IsMedia {
-		playReq := &OpenFileGetVideoPreviewPlayInfoRequest{
-			DriveId:         driverId,
-			FileId:          fileId,
-			Category:        "live_transcoding",
-			GetSubtitleInfo: true,
-			TemplateId:      "LD|SD|HD|FHD|QHD",
-			UrlExpireSec:    4 * 60 * 50,
-		}
-		playRsp := &OpenFileGetVideoPreviewPlayInfoResponse{
-			VideoPreViewPlayInfo: &VideoPreViewPlayInfo{
-				LiveTranscodingTaskList:         []*LiveTranscodingTask{},
-				LiveTranscodingSubtitleTaskList: []*LiveTranscodingSubtitleTask{},
-			},
-		}
-		err = p.send(http.MethodPost, "/adrive/v1.0/openFile/getVideoPreviewPlayInfo", playReq, playRsp)
-		if err == nil {
-			for _, task := range playRsp.VideoPreViewPlayInfo.LiveTranscodingTaskList {
-				if task.Status != "finished" {
-					continue
-				}
-				var resolution plugin.FileResource_Resolution
-				switch task.TemplateId {
-				case "LD":
-					resolution = plugin.FileResource_LD
-				case "SD":
-					resolution = plugin.FileResource_SD
-				case "HD":
-					resolution = plugin.FileResource_HD
-				case "FHD":
-					resolution = plugin.FileResource_FHD
-				case "QHD":
-					resolution = plugin.FileResource_QHD
-				default:
-					continue
-				}
-				if task.Url == "" {
-					continue
-				}
-				fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
-					Url:          task.Url,
-					ExpireTime:   uint64(time.Now().Add(time.Second * 4 * 60 * 50).Unix()),
-					ResourceType: plugin.FileResource_Video,
-					Resolution:   resolution,
-				})
-			}
-			for _, task := range playRsp.VideoPreViewPlayInfo.LiveTranscodingSubtitleTaskList {
-				if task.Status != "finished" {
-					continue
-				}
-				fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
-					Url:          task.Url,
-					Title:        task.Language,
-					ResourceType: plugin.FileResource_Subtitle,
-				})
-			}
-		} else {
-			slog.Error("get video preview play info failed", "err", err)
-		}
-	}
-
-	return fileResource, nil
-}
+//go:build wasip1
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"plugins/util"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/labulakalia/wazero_net/wasi/http"
+	"github.com/medianexapp/plugin_api/plugin"
+	"github.com/medianexapp/plugin_api/ratelimit"
+)
+
+/*
+NOTE: net and http use package
+"github.com/labulakalia/wazero_net/wasi/http"
+"github.com/labulakalia/wazero_net/wasi/net"
+*/
+
+type PluginImpl struct {
+	oauthServerURL string
+
+	token                 *plugin.Token
+	userInfo              *UserInfoResponse
+	getDriverInfoResponse *UserGetDriverInfoResponse
+
+	shares util.Shares
+	// share id -> share token
+	shareTokens *util.Cache[string, string]
+	ratelimit   *ratelimit.RateLimit
+}
+
+const (
+	// share token expire in 2 hours
+	shareTokenTTL  = time.Hour
+	shareTokenSize = 100
+)
+
+// authData is auth data of account,opened shares are kept with token,
+// auth data of old version is bytes of token
+type authData struct {
+	Token  *plugin.Token       `json:"token"`
+	Shares []*plugin.FileEntry `json:"shares,omitempty"`
+}
+
+func parseAuthData(authDataBytes []byte) (*authData, error) {
+	data := &authData{}
+	if err := json.Unmarshal(authDataBytes, data); err == nil && data.Token != nil {
+		return data, nil
+	}
+	token := &plugin.Token{}
+	if err := token.UnmarshalVT(authDataBytes); err != nil {
+		return nil, err
+	}
+	return &authData{Token: token}, nil
+}
+
+func NewPluginImpl() *PluginImpl {
+	slog.SetLogLoggerLevel(slog.LevelDebug)
+	limitConfigMap := map[string]ratelimit.LimitConfig{
+		"/adrive/v1.0/openFile/list": ratelimit.LimitConfig{
+			Limit:    40,
+			Duration: 10 * time.Second,
+		},
+		"/adrive/v1.0/openFile/getDownloadUrl": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: time.Second,
+		},
+		"/adrive/v1.0/openFile/search": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: time.Second,
+		},
+		"/adrive/v1.0/openFile/get_path": ratelimit.LimitConfig{
+			Limit:    5,
+			Duration: time.Second,
+		},
+		"/v2/share_link/get_share_token": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: time.Second,
+		},
+		"/adrive/v2/file/list_by_share": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: time.Second,
+		},
+		"/v2/file/get_share_link_download_url": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: time.Second,
+		},
+	}
+	return &PluginImpl{
+		shareTokens: util.NewCache[string, string](shareTokenSize, shareTokenTTL),
+		ratelimit:   ratelimit.New(limitConfigMap),
+	}
+}
+
+// Id implements IPlugin.
+func (p *PluginImpl) PluginId() (string, error) {
+	return "alipan", nil
+}
+
+func (p *PluginImpl) send(method string, uri string, req, resp any) error {
+	header := http.Header{}
+	if p.token != nil {
+		header.Set("Authorization", fmt.Sprintf("Bearer %s", p.token.AccessToken))
+	}
+	return p.sendURL(method, AlipanURL, uri, header, req, resp)
+}
+
+// sendShare send share api request with share token,share api not need access token
+func (p *PluginImpl) sendShare(uri string, shareToken string, req, resp any) error {
+	header := http.Header{}
+	if shareToken != "" {
+		header.Set("X-Share-Token", shareToken)
+	}
+	return p.sendURL(http.MethodPost, AlipanShareURL, uri, header, req, resp)
+}
+
+func (p *PluginImpl) sendURL(method string, baseURL string, uri string, header http.Header, req, resp any) error {
+	_ = p.ratelimit.Wait(uri)
+	var body io.Reader
+	if req != nil {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	httpReq, err := http.NewRequest(method, fmt.Sprintf("%s%s", baseURL, uri), body)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Add("Content-Type", "application/json")
+	for key := range header {
+		httpReq.Header.Set(key, header.Get(key))
+	}
+	httpResp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	bodyData, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	slog.Debug("get request resp", "uri", uri, "req", req, "status_code", httpResp.StatusCode, "resp", string(bodyData))
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		errResp := &ErrResponse{}
+		err = json.Unmarshal(bodyData, errResp)
+		if err != nil {
+			return err
+		}
+		return errResp
+	}
+	err = json.Unmarshal(bodyData, resp)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *PluginImpl) getQrcode() (*plugin.AuthMethod_Scanqrcode, error) {
+	qrResp := &QrcodeResponse{}
+	qrBytes, err := util.GetAuthQrcode("alipan")
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(qrBytes, qrResp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &plugin.AuthMethod_Scanqrcode{
+		Scanqrcode: &plugin.Scanqrcode{
+			QrcodeImageParam: qrResp.Sid,
+			QrcodeExpireTime: uint64(time.Now().Add(time.Minute * 3).Unix()),
+			QrcodeImageUrl:   qrResp.QrCodeUrl,
+		},
+	}, nil
+}
+
+// GetAuthe implements IPlugin.
+func (p *PluginImpl) GetAuth() (*plugin.Auth, error) {
+	auth := &plugin.Auth{
+		AuthMethods: []*plugin.AuthMethod{},
+	}
+
+	url := util.GetAuthAddr("alipan")
+	authCallbackUrl := &plugin.AuthMethod_Callback{
+		Callback: &plugin.Callback{
+			CallbackUrl: url,
+		},
+	}
+	auth.AuthMethods = append(auth.AuthMethods, &plugin.AuthMethod{
+		Method: authCallbackUrl,
+	})
+
+	authScanQrcode, err := p.getQrcode()
+	if err != nil {
+		slog.Error("get qrcode failed", "err", err)
+		return nil, err
+	}
+
+	auth.AuthMethods = append(auth.AuthMethods, &plugin.AuthMethod{
+		Method: authScanQrcode,
+	})
+
+	return auth, nil
+}
+
+// CheckAuth implements IPlugin.
+func (p *PluginImpl) CheckAuthMethod(authMethod *plugin.AuthMethod) (*plugin.AuthData, error) {
+	var (
+		err          error
+		token        *plugin.Token
+		authCode     string
+		refreshToken string
+	)
+	switch v := authMethod.Method.(type) {
+	case *plugin.AuthMethod_Scanqrcode:
+		url := fmt.Sprintf("https://openapi.alipan.com/oauth/qrcode/%s/status", v.Scanqrcode.QrcodeImageParam)
+		resp, err := util.HttpClient.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		type QrcodeStatus struct {
+			Status   string `json:"status"`
+			AuthCode string `json:"authCode"`
+		}
+		respBytes, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		slog.Debug("check alipan qrcode status", "qrcodeStatus", string(respBytes), "status", resp.StatusCode)
+		qrcodeStatus := &QrcodeStatus{}
+		if err := json.Unmarshal(respBytes, qrcodeStatus); err != nil {
+			return nil, err
+		}
+
+		if qrcodeStatus.Status == "QRCodeExpired" {
+			slog.Error("qrcode expired", "key", v.Scanqrcode.QrcodeImageParam)
+			return nil, fmt.Errorf("QR code expired")
+		}
+		if qrcodeStatus.Status != "LoginSuccess" {
+			slog.Warn("qrcode not login success", "status", qrcodeStatus.Status)
+			return nil, nil
+		}
+		authCode = qrcodeStatus.AuthCode
+	case *plugin.AuthMethod_Refresh:
+		data, err := parseAuthData(v.Refresh.AuthData.AuthDataBytes)
+		if err != nil {
+			return nil, err
+		}
+		for _, share := range data.Shares {
+			p.shares.Store(share)
+		}
+		refreshToken = data.Token.RefreshToken
+	case *plugin.AuthMethod_Callback:
+		slog.Info("recv callback data", "callBackData", v.Callback.CallbackUrlData)
+		token = &plugin.Token{}
+		urlParse, err := url.Parse(v.Callback.CallbackUrlData)
+		if err != nil {
+			return nil, err
+		}
+		data, err := base64.URLEncoding.DecodeString(urlParse.Query().Get("token"))
+		if err != nil {
+			return nil, err
+		}
+		err = token.UnmarshalVT(data)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupport %+v", v)
+	}
+	if token == nil {
+		token, err = util.GetAuthToken(&util.GetAuthTokenRequest{
+			Id:   "alipan",
+			Code: authCode,
+
+			RefreshToken: refreshToken,
+		})
+		if err != nil {
+			slog.Error("authCode to access token failed", "err", err)
+			return nil, err
+		}
+	}
+
+	authDataBytes, err := json.Marshal(&authData{
+		Token:  token,
+		Shares: p.shares.DirEntry().FileEntries,
+	})
+	if err != nil {
+		slog.Error("marshal auth data failed", "err", err)
+		return nil, err
+	}
+	expireTime := time.Now().Add(time.Second * time.Duration(token.ExpiresIn-300)).Unix()
+	slog.Info("get access token success")
+	return &plugin.AuthData{
+		AuthDataBytes:       authDataBytes,
+		AuthDataExpiredTime: uint64(expireTime),
+	}, nil
+}
+
+// InitAuth implements IPlugin.
+func (p *PluginImpl) CheckAuthData(authDataBytes []byte) error {
+	data, err := parseAuthData(authDataBytes)
+	if err != nil {
+		return err
+	}
+	p.token = data.Token
+	for _, share := range data.Shares {
+		p.shares.Store(share)
+	}
+	resp := &UserInfoResponse{}
+	err = p.send(http.MethodGet, "/oauth/users/info", nil, resp)
+	if err != nil {
+		return err
+	}
+	p.userInfo = resp
+	p.getDriverInfoResponse = &UserGetDriverInfoResponse{}
+	err = p.send(http.MethodPost, "/adrive/v1.0/user/getDriveInfo", nil, p.getDriverInfoResponse)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AuthId implements IPlugin.
+func (p *PluginImpl) PluginAuthId() (string, error) {
+	if p.userInfo == nil {
+		return "", fmt.Errorf("can get user info")
+	}
+	return p.userInfo.Id, nil
+}
+
+// getDriverPath return driver id and path in driver,
+// file of search result use drive id in raw data
+func (d *PluginImpl) getDriverPath(path string, fileEntry *plugin.FileEntry) (string, string, error) {
+	path = filepath.Clean(path)
+	var driverId string
+	if util.IsSearchPath(path) {
+		if fileEntry == nil || fileEntry.RawData == nil {
+			return "", "", os.ErrNotExist
+		}
+		entry := &FileEntry{}
+		err := json.Unmarshal(fileEntry.RawData, entry)
+		if err != nil {
+			return "", "", err
+		}
+		return entry.DriveId, path, nil
+	} else if strings.HasPrefix(path, "/资源库") {
+		path, _ = strings.CutPrefix(path, "/资源库")
+		driverId = d.getDriverInfoResponse.ResourceDriverId
+	} else if strings.HasPrefix(path, "/备份盘") {
+		path, _ = strings.CutPrefix(path, "/备份盘")
+		driverId = d.getDriverInfoResponse.BackupDriverId
+	} else {
+		slog.Error("valid path", "path", path)
+		return "", "", os.ErrNotExist
+	}
+	if path == "" {
+		path = "/"
+	}
+	return driverId, path, nil
+}
+
+var (
+	pageMarker sync.Map
+)
+
+// GetDirEntry implements IPlugin.
+func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+		PageSize:    100,
+	}
+	if req.PageSize == 0 {
+		req.PageSize = dirEntry.PageSize
+	}
+	if req.Path == "/" {
+		if p.getDriverInfoResponse.ResourceDriverId != "" {
+			dirEntry.FileEntries = append(dirEntry.FileEntries, &plugin.FileEntry{
+				Name:     "资源库",
+				FileType: plugin.FileEntry_FileTypeDir,
+			})
+		}
+		if p.getDriverInfoResponse.BackupDriverId != "" {
+			dirEntry.FileEntries = append(dirEntry.FileEntries, &plugin.FileEntry{
+				Name:     "备份盘",
+				FileType: plugin.FileEntry_FileTypeDir,
+			})
+		}
+		dirEntry.FileEntries = append(dirEntry.FileEntries, util.SharesFileEntry(), util.SearchFileEntry())
+		return dirEntry, nil
+	}
+	if util.IsShareEntry(req.Path, req.FileEntry, "share_id") {
+		return p.getShareDirEntry(req)
+	}
+	if util.IsSearchPath(req.Path) && (req.FileEntry == nil || req.FileEntry.RawData == nil) {
+		return p.search(req)
+	}
+	driverId, path, err := p.getDriverPath(req.Path, req.FileEntry)
+	if err != nil {
+		slog.Error("getDriver failed", "err", err)
+		return nil, err
+	}
+	parentFileId := ""
+	if path == "/" {
+		parentFileId = "root"
+	} else {
+		fileEntry := &FileEntry{}
+		if req.FileEntry != nil && req.FileEntry.RawData != nil {
+			err = json.Unmarshal(req.FileEntry.RawData, fileEntry)
+			if err != nil {
+				slog.Error("unmarshal failed", "rawData", string(req.FileEntry.RawData), "err", err)
+				return nil, err
+			}
+			parentFileId = fileEntry.FileId
+		}
+		if parentFileId == "" {
+			fileEntry, err = p.getFileEntryInfoByPath(driverId, path)
+			if err != nil {
+				return nil, err
+			}
+
+			parentFileId = fileEntry.FileId
+		}
+		if parentFileId == "" {
+			return nil, errors.New("parent file id is empty")
+		}
+		parentFileId = fileEntry.FileId
+	}
+	if req.Page > 1 {
+		// page is empty
+		return dirEntry, nil
+	}
+
+	openFileReq := &OpenFileListRequest{
+		DriveId:      driverId,
+		Limit:        int(req.PageSize),
+		OrderBy:      "name_enhanced",
+		ParentFileId: parentFileId,
+		Category:     "",
+		Marker:       req.DirPageKey,
+	}
+
+	openFileRsp := &OpenFileListResponse{}
+	err = p.send(http.MethodPost, "/adrive/v1.0/openFile/list", openFileReq, openFileRsp)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range openFileRsp.Items {
+		fileType := plugin.FileEntry_FileTypeFile
+		if item.Type == "folder" {
+			fileType = plugin.FileEntry_FileTypeDir
+		}
+		fileEntry := &plugin.FileEntry{
+			Name:         item.Name,
+			FileType:     fileType,
+			Size:         item.Size,
+			CreatedTime:  uint64(item.CreatedTime.Unix()),
+			ModifiedTime: uint64(item.UpdatedTime.Unix()),
+			AccessedTime: uint64(item.UpdatedTime.Unix()),
+		}
+		itemBytes, err := json.Marshal(item)
+		if err == nil {
+			fileEntry.RawData = itemBytes
+		}
+		dirEntry.FileEntries = append(dirEntry.FileEntries, fileEntry)
+	}
+	dirEntry.DirPageKey = openFileRsp.NextMarker
+	return dirEntry, nil
+}
+
+// search file in all drives by "/search/<keyword>",dir page key is "<drive id>|<marker>",
+// result name is full path
+func (p *PluginImpl) search(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+		PageSize:    100,
+	}
+	if req.Path == util.SearchDir {
+		return dirEntry, nil
+	}
+	query, err := util.ParseSearchQuery(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	driverIds := []string{}
+	for _, driverId := range []string{p.getDriverInfoResponse.ResourceDriverId, p.getDriverInfoResponse.BackupDriverId} {
+		if driverId != "" {
+			driverIds = append(driverIds, driverId)
+		}
+	}
+	if len(driverIds) == 0 {
+		return dirEntry, nil
+	}
+	driverId, marker := driverIds[0], ""
+	if req.DirPageKey != "" {
+		driverId, marker, _ = strings.Cut(req.DirPageKey, "|")
+	}
+	searchQuery := fmt.Sprintf("name match %q", query.Keyword)
+	if query.Category != "" {
+		searchQuery += fmt.Sprintf(" and category = %q", query.Category)
+	}
+	searchReq := &OpenFileSearchRequest{
+		DriveId: driverId,
+		Limit:   int(dirEntry.PageSize),
+		Marker:  marker,
+		Query:   searchQuery,
+		OrderBy: "name ASC",
+	}
+	searchResp := &OpenFileListResponse{}
+	err = p.send(http.MethodPost, "/adrive/v1.0/openFile/search", searchReq, searchResp)
+	if err != nil {
+		return nil, err
+	}
+	// parent dir of results are mostly same
+	parentPaths := map[string]string{}
+	for _, item := range searchResp.Items {
+		fileType := plugin.FileEntry_FileTypeFile
+		if item.Type == "folder" {
+			fileType = plugin.FileEntry_FileTypeDir
+		}
+		parentPath, ok := parentPaths[item.ParentFileId]
+		if !ok {
+			parentPath, err = p.getDirPath(driverId, item.ParentFileId)
+			if err != nil {
+				return nil, err
+			}
+			parentPaths[item.ParentFileId] = parentPath
+		}
+		fileEntry := &plugin.FileEntry{
+			Name:         strings.TrimPrefix(filepath.Join(parentPath, item.Name), "/"),
+			FileType:     fileType,
+			Size:         item.Size,
+			CreatedTime:  uint64(item.CreatedTime.Unix()),
+			ModifiedTime: uint64(item.UpdatedTime.Unix()),
+			AccessedTime: uint64(item.UpdatedTime.Unix()),
+		}
+		itemBytes, err := json.Marshal(item)
+		if err == nil {
+			fileEntry.RawData = itemBytes
+		}
+		dirEntry.FileEntries = append(dirEntry.FileEntries, fileEntry)
+	}
+	if searchResp.NextMarker != "" {
+		dirEntry.DirPageKey = driverId + "|" + searchResp.NextMarker
+	} else {
+		// search next drive
+		for i, id := range driverIds[:len(driverIds)-1] {
+			if id == driverId {
+				dirEntry.DirPageKey = driverIds[i+1] + "|"
+			}
+		}
+	}
+	return dirEntry, nil
+}
+
+// getDirPath return full path of dir with prefix of driver
+func (p *PluginImpl) getDirPath(driverId, fileId string) (string, error) {
+	dirPath := "/资源库"
+	if driverId == p.getDriverInfoResponse.BackupDriverId {
+		dirPath = "/备份盘"
+	}
+	if fileId == "root" {
+		return dirPath, nil
+	}
+	rsp := &OpenFileGetPathResponse{}
+	err := p.send(http.MethodPost, "/adrive/v1.0/openFile/get_path", &OpenFileGetPathRequest{
+		DriveId: driverId,
+		FileId:  fileId,
+	}, rsp)
+	if err != nil {
+		return "", err
+	}
+	items := map[string]*FileEntry{}
+	for _, item := range rsp.Items {
+		items[item.FileId] = item
+	}
+	names := []string{}
+	for item := items[fileId]; item != nil; item = items[item.ParentFileId] {
+		names = append([]string{item.Name}, names...)
+		if len(names) > len(rsp.Items) {
+			return "", fmt.Errorf("invalid path of %s", fileId)
+		}
+	}
+	return filepath.Join(append([]string{dirPath}, names...)...), nil
+}
+
+func (p *PluginImpl) getFileEntryInfoByPath(driverId, path string) (*FileEntry, error) {
+
+	rsp := &OpenFilegetbypathResponse{
+		FileEntry: &FileEntry{},
+	}
+	req := &OpenFilegetbypathRequest{
+		DriveId:  driverId,
+		FilePath: path,
+	}
+
+	err := p.send(http.MethodPost, "/adrive/v1.0/openFile/get_by_path", req, rsp)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("getFileEntryInfoByPath", "resp", rsp)
+	return rsp.FileEntry, nil
+}
+
+// getShareDirEntry list opened shares in "/shares",
+// if path is "/shares/<share link>",list root of share
+func (p *PluginImpl) getShareDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	if req.Path == util.SharesDir {
+		return p.shares.DirEntry(), nil
+	}
+	shareFile := &ShareFile{}
+	if req.FileEntry != nil && req.FileEntry.RawData != nil {
+		err := json.Unmarshal(req.FileEntry.RawData, shareFile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		shareLink, err := util.ParseShareLink(req.Path)
+		if err != nil {
+			return nil, err
+		}
+		shareFile.ShareId = shareLink.Id
+		shareFile.SharePwd = shareLink.Pwd
+		shareFile.FileId = "root"
+		shareInfo := &GetShareByAnonymousResponse{}
+		err = p.sendShare("/adrive/v3/share_link/get_share_by_anonymous?share_id="+shareLink.Id, "", &GetShareByAnonymousRequest{ShareId: shareLink.Id}, shareInfo)
+		if err != nil {
+			return nil, err
+		}
+		name := shareInfo.ShareName
+		if name == "" {
+			name = shareLink.Id
+		}
+		rawData, _ := json.Marshal(shareFile)
+		p.shares.Store(&plugin.FileEntry{
+			Name:     name,
+			FileType: plugin.FileEntry_FileTypeDir,
+			RawData:  rawData,
+		})
+	}
+	shareToken, err := p.getShareToken(shareFile)
+	if err != nil {
+		return nil, err
+	}
+	listReq := &ListByShareRequest{
+		ShareId:        shareFile.ShareId,
+		ParentFileId:   shareFile.FileId,
+		Limit:          100,
+		Marker:         req.DirPageKey,
+		OrderBy:        "name",
+		OrderDirection: "ASC",
+	}
+	listResp := &OpenFileListResponse{}
+	err = p.sendShare("/adrive/v2/file/list_by_share", shareToken, listReq, listResp)
+	if err != nil {
+		return nil, err
+	}
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+		PageSize:    100,
+		DirPageKey:  listResp.NextMarker,
+	}
+	for _, item := range listResp.Items {
+		fileType := plugin.FileEntry_FileTypeFile
+		if item.Type == "folder" {
+			fileType = plugin.FileEntry_FileTypeDir
+		}
+		rawData, _ := json.Marshal(&ShareFile{
+			ShareId:  shareFile.ShareId,
+			SharePwd: shareFile.SharePwd,
+			FileId:   item.FileId,
+		})
+		dirEntry.FileEntries = append(dirEntry.FileEntries, &plugin.FileEntry{
+			Name:         item.Name,
+			FileType:     fileType,
+			Size:         item.Size,
+			RawData:      rawData,
+			CreatedTime:  uint64(item.CreatedTime.Unix()),
+			ModifiedTime: uint64(item.UpdatedTime.Unix()),
+			AccessedTime: uint64(item.UpdatedTime.Unix()),
+		})
+	}
+	return dirEntry, nil
+}
+
+// getShareToken return share token of share,it is cached until it expire
+func (p *PluginImpl) getShareToken(shareFile *ShareFile) (string, error) {
+	if shareToken, ok := p.shareTokens.Get(shareFile.ShareId); ok {
+		return shareToken, nil
+	}
+	shareTokenResp := &GetShareTokenResponse{}
+	err := p.sendShare("/v2/share_link/get_share_token", "", &GetShareTokenRequest{
+		ShareId:  shareFile.ShareId,
+		SharePwd: shareFile.SharePwd,
+	}, shareTokenResp)
+	if err != nil {
+		return "", err
+	}
+	p.shareTokens.Set(shareFile.ShareId, shareTokenResp.ShareToken)
+	return shareTokenResp.ShareToken, nil
+}
+
+// getShareFileResource get download url of share file with share token,
+// share file which is not allowed to download need save it to drive
+func (p *PluginImpl) getShareFileResource(req *plugin.GetFileResourceRequest) (*plugin.FileResource, error) {
+	if req.FileEntry == nil || req.FileEntry.RawData == nil {
+		return nil, util.ErrShareNotPlayable
+	}
+	shareFile := &ShareFile{}
+	err := json.Unmarshal(req.FileEntry.RawData, shareFile)
+	if err != nil {
+		return nil, err
+	}
+	shareToken, err := p.getShareToken(shareFile)
+	if err != nil {
+		return nil, err
+	}
+	downloadResp := &GetShareLinkDownloadUrlResponse{}
+	err = p.sendShare("/v2/file/get_share_link_download_url", shareToken, &GetShareLinkDownloadUrlRequest{
+		ShareId:   shareFile.ShareId,
+		FileId:    shareFile.FileId,
+		ExpireSec: 600,
+	}, downloadResp)
+	if err != nil {
+		slog.Error("get share download url failed", "shareId", shareFile.ShareId, "fileId", shareFile.FileId, "err", err)
+		return nil, fmt.Errorf("%w,%v", util.ErrShareNotPlayable, err)
+	}
+	downloadUrl := downloadResp.DownloadUrl
+	if downloadUrl == "" {
+		downloadUrl = downloadResp.Url
+	}
+	if downloadUrl == "" {
+		return nil, util.ErrShareNotPlayable
+	}
+	fileResourceData := &plugin.FileResource_FileResourceData{
+		Url:          downloadUrl,
+		Resolution:   plugin.FileResource_Original,
+		ResourceType: plugin.FileResource_Video,
+		Header: map[string]string{
+			// share download url check referer
+			"Referer": "https://www.aliyundrive.com/",
+		},
+	}
+	if expireTime, err := time.Parse(time.RFC3339, downloadResp.Expiration); err == nil {
+		fileResourceData.ExpireTime = uint64(expireTime.Unix())
+	}
+	return &plugin.FileResource{
+		FileResourceData: []*plugin.FileResource_FileResourceData{fileResourceData},
+	}, nil
+}
+
+// GetFileResource implements IPlugin.
+func (p *PluginImpl) GetFileResource(req *plugin.GetFileResourceRequest) (*plugin.FileResource, error) {
+	if util.IsShareEntry(req.FilePath, req.FileEntry, "share_id") {
+		return p.getShareFileResource(req)
+	}
+	driverId, path, err := p.getDriverPath(req.FilePath, req.FileEntry)
+	if err != nil {
+		return nil, err
+	}
+	var fileId string
+	if req.FileEntry != nil && req.FileEntry.RawData != nil {
+		fileEntry := FileEntry{}
+		err = json.Unmarshal(req.FileEntry.RawData, &fileEntry)
+		if err != nil {
+			return nil, err
+		}
+		fileId = fileEntry.FileId
+	}
+	if fileId == "" {
+		fileEntry, err := p.getFileEntryInfoByPath(driverId, path)
+		if err != nil {
+			return nil, err
+		}
+		fileId = fileEntry.FileId
+	}
+
+	fileResource := &plugin.FileResource{
+		FileResourceData: []*plugin.FileResource_FileResourceData{},
+	}
+
+	getFileDownloadReq := &OpenFilegetDownloadUrlRequest{
+		DriveId:   driverId,
+		FileId:    fileId,
+		ExpireSec: 900,
+	}
+	getFileDownloadResp := &OpenFilegetDownloadUrlResponse{}
+	err = p.send(http.MethodPost, "/adrive/v1.0/openFile/getDownloadUrl", getFileDownloadReq, getFileDownloadResp)
+	if err != nil {
+		return nil, err
+	}
+	expireTime, err := time.Parse("2006-01-02T15:04:05Z", getFileDownloadResp.Expiration)
+	if err == nil {
+		fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
+			Url:          getFileDownloadResp.Url,
+			ExpireTime:   uint64(expireTime.Unix()),
+			Resolution:   plugin.FileResource_Original,
+			ResourceType: plugin.FileResource_Video,
+		})
+	} else {
+		slog.Error("get download url failed", "err", err)
+	}
+	if req.IsMedia {
+		playReq := &OpenFileGetVideoPreviewPlayInfoRequest{
+			DriveId:         driverId,
+			FileId:          fileId,
+			Category:        "live_transcoding",
+			GetSubtitleInfo: true,
+			TemplateId:      "LD|SD|HD|FHD|QHD",
+			UrlExpireSec:    4 * 60 * 50,
+		}
+		playRsp := &OpenFileGetVideoPreviewPlayInfoResponse{
+			VideoPreViewPlayInfo: &VideoPreViewPlayInfo{
+				LiveTranscodingTaskList:         []*LiveTranscodingTask{},
+				LiveTranscodingSubtitleTaskList: []*LiveTranscodingSubtitleTask{},
+			},
+		}
+		err = p.send(http.MethodPost, "/adrive/v1.0/openFile/getVideoPreviewPlayInfo", playReq, playRsp)
+		if err == nil {
+			for _, task := range playRsp.VideoPreViewPlayInfo.LiveTranscodingTaskList {
+				if task.Status != "finished" {
+					continue
+				}
+				var resolution plugin.FileResource_Resolution
+				switch task.TemplateId {
+				case "LD":
+					resolution = plugin.FileResource_LD
+				case "SD":
+					resolution = plugin.FileResource_SD
+				case "HD":
+					resolution = plugin.FileResource_HD
+				case "FHD":
+					resolution = plugin.FileResource_FHD
+				case "QHD":
+					resolution = plugin.FileResource_QHD
+				default:
+					continue
+				}
+				if task.Url == "" {
+					continue
+				}
+				fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
+					Url:          task.Url,
+					ExpireTime:   uint64(time.Now().Add(time.Second * 4 * 60 * 50).Unix()),
+					ResourceType: plugin.FileResource_Video,
+					Resolution:   resolution,
+				})
+			}
+			for _, task := range playRsp.VideoPreViewPlayInfo.LiveTranscodingSubtitleTaskList {
+				if task.Status != "finished" {
+					continue
+				}
+				fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
+					Url:          task.Url,
+					Title:        task.Language,
+					ResourceType: plugin.FileResource_Subtitle,
+				})
+			}
+		} else {
+			slog.Error("get video preview play info failed", "err", err)
+		}
+	}
+
+	return fileResource, nil
+}
@@ -1,10 +1,18 @@
+//go:build wasip1
+
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
 	"net/url"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/medianexapp/plugin_api/plugin"
 )
 
 func TestPluginImpl(t *testing.T) {
@@ -20,3 +28,154 @@ func TestPluginImpl(t *testing.T) {
 	// "2025-04-11T02:45:56.240Z"
 	t.Log(time.Parse("2006-01-02T15:04:05Z", "2025-04-11T02:45:56.240Z"))
 }
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// mockTransport reply body of request path,count request of every path
+func mockTransport(t *testing.T, handle func(req *http.Request) string) map[string]int {
+	counts := map[string]int{}
+	transport := http.DefaultClient.Transport
+	t.Cleanup(func() { http.DefaultClient.Transport = transport })
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		counts[req.URL.Path]++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(handle(req))),
+		}, nil
+	})
+	return counts
+}
+
+func TestShare(t *testing.T) {
+	counts := mockTransport(t, func(req *http.Request) string {
+		if req.URL.Host != "api.aliyundrive.com" || req.Header.Get("Authorization") != "" {
+			t.Fatalf("share api %s is requested with access token", req.URL)
+		}
+		if req.URL.Path != "/v2/share_link/get_share_token" && req.URL.Path != "/adrive/v3/share_link/get_share_by_anonymous" && req.Header.Get("X-Share-Token") != "st" {
+			t.Fatalf("share api %s is requested without share token", req.URL)
+		}
+		switch req.URL.Path {
+		case "/adrive/v3/share_link/get_share_by_anonymous":
+			return `{"share_name":"Movies"}`
+		case "/v2/share_link/get_share_token":
+			tokenReq := &GetShareTokenRequest{}
+			json.NewDecoder(req.Body).Decode(tokenReq)
+			if tokenReq.ShareId != "abc" || tokenReq.SharePwd != "1234" {
+				t.Fatalf("unexpected share token request %+v", tokenReq)
+			}
+			return `{"share_token":"st","expires_in":7200}`
+		case "/adrive/v2/file/list_by_share":
+			return `{"items":[{"file_id":"d1","name":"S01","type":"folder","updated_at":"2025-04-11T02:45:56.240Z"},{"file_id":"f1","name":"a.mkv","type":"file","size":10}],"next_marker":"m"}`
+		case "/v2/file/get_share_link_download_url":
+			return `{"download_url":"https://cdn.example.com/a.mkv","expiration":"2025-04-11T03:45:56Z"}`
+		}
+		t.Fatalf("unexpected url %s", req.URL)
+		return ""
+	})
+	p := NewPluginImpl()
+	p.token = &plugin.Token{AccessToken: "at", RefreshToken: "rt"}
+	dirEntry, err := p.GetDirEntry(&plugin.GetDirEntryRequest{Path: "/shares/https://www.alipan.com/s/abc?pwd=1234", Page: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirEntry.FileEntries) != 2 || dirEntry.DirPageKey != "m" {
+		t.Fatalf("unexpected dir entry %v", dirEntry)
+	}
+	dir, file := dirEntry.FileEntries[0], dirEntry.FileEntries[1]
+	shareFile := &ShareFile{}
+	if err := json.Unmarshal(dir.RawData, shareFile); err != nil {
+		t.Fatal(err)
+	}
+	if dir.FileType != plugin.FileEntry_FileTypeDir || dir.ModifiedTime != 1744339556 || shareFile.ShareId != "abc" || shareFile.SharePwd != "1234" || shareFile.FileId != "d1" {
+		t.Fatalf("unexpected share dir %v", dir)
+	}
+	if file.FileType != plugin.FileEntry_FileTypeFile || file.Size != 10 {
+		t.Fatalf("unexpected share file %v", file)
+	}
+	if _, err := p.GetDirEntry(&plugin.GetDirEntryRequest{Path: "/shares/Movies/S01", Page: 1, FileEntry: dir}); err != nil {
+		t.Fatal(err)
+	}
+	fileResource, err := p.GetFileResource(&plugin.GetFileResourceRequest{FilePath: "/shares/Movies/a.mkv", FileEntry: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileResource.FileResourceData[0].Url != "https://cdn.example.com/a.mkv" || fileResource.FileResourceData[0].ExpireTime != 1744343156 {
+		t.Fatalf("unexpected resource %v", fileResource.FileResourceData[0])
+	}
+	if counts["/v2/share_link/get_share_token"] != 1 {
+		t.Fatalf("share token is requested %d times", counts["/v2/share_link/get_share_token"])
+	}
+
+	// opened share is kept in auth data
+	authDataBytes, err := json.Marshal(&authData{Token: p.token, Shares: p.shares.DirEntry().FileEntries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := parseAuthData(authDataBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Token.RefreshToken != "rt" || len(data.Shares) != 1 || data.Shares[0].Name != "Movies" {
+		t.Fatalf("unexpected auth data %+v", data)
+	}
+	tokenBytes, err := p.token.MarshalVT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = parseAuthData(tokenBytes)
+	if err != nil || data.Token.RefreshToken != "rt" || len(data.Shares) != 0 {
+		t.Fatalf("parse auth data of old version return %+v,%v", data, err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	counts := mockTransport(t, func(req *http.Request) string {
+		if req.Header.Get("Authorization") != "Bearer at" {
+			t.Fatalf("unexpected header %v", req.Header)
+		}
+		switch req.URL.Path {
+		case "/adrive/v1.0/openFile/search":
+			searchReq := &OpenFileSearchRequest{}
+			json.NewDecoder(req.Body).Decode(searchReq)
+			if searchReq.DriveId != "r" || searchReq.Query != `name match "a" and category = "video"` {
+				t.Fatalf("unexpected search request %+v", searchReq)
+			}
+			return `{"items":[{"drive_id":"r","file_id":"f1","parent_file_id":"p1","name":"a.mkv","type":"file"},{"drive_id":"r","file_id":"f2","parent_file_id":"p1","name":"b.mkv","type":"file"}]}`
+		case "/adrive/v1.0/openFile/get_path":
+			return `{"items":[{"file_id":"p1","parent_file_id":"p0","name":"TV"},{"file_id":"p0","parent_file_id":"root","name":"Shows"}]}`
+		}
+		t.Fatalf("unexpected url %s", req.URL)
+		return ""
+	})
+	p := NewPluginImpl()
+	p.token = &plugin.Token{AccessToken: "at"}
+	p.getDriverInfoResponse = &UserGetDriverInfoResponse{ResourceDriverId: "r", BackupDriverId: "b"}
+	dirEntry, err := p.GetDirEntry(&plugin.GetDirEntryRequest{Path: "/search/a?category=video", Page: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, fileEntry := range dirEntry.FileEntries {
+		names = append(names, fileEntry.Name)
+	}
+	if fmt.Sprint(names) != "[资源库/Shows/TV/a.mkv 资源库/Shows/TV/b.mkv]" || dirEntry.DirPageKey != "b|" {
+		t.Fatalf("unexpected search result %v,%s", names, dirEntry.DirPageKey)
+	}
+	if counts["/adrive/v1.0/openFile/get_path"] != 1 {
+		t.Fatalf("path of same dir is requested %d times", counts["/adrive/v1.0/openFile/get_path"])
+	}
+	driverId, filePath, err := p.getDriverPath("/search/a?category=video/"+dirEntry.FileEntries[0].Name, dirEntry.FileEntries[0])
+	if err != nil || driverId != "r" {
+		t.Fatalf("unexpected driver of search result %s,%s,%v", driverId, filePath, err)
+	}
+	for fileId, want := range map[string]string{"root": "/备份盘", "p1": "/备份盘/Shows/TV"} {
+		dirPath, err := p.getDirPath("b", fileId)
+		if err != nil || dirPath != want {
+			t.Fatalf("get path of %s return %s,%v", fileId, dirPath, err)
+		}
+	}
+}
@@ -1,5 +1,15 @@
 package main
 
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"plugins/util"
+	"time"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
 const (
 	BaiduPanURL = "https://pan.baidu.com"
 )
@@ -28,19 +38,29 @@ type UserInfo struct {
 }
 
 type FileListItem struct {
-	FsId           uint64 `json:"fs_id"`
-	Path           string `json:"path"`
-	ServerFilename string `json:"server_filename"`
-	Size           uint64 `json:"size"`
-	ServerMtime    uint64 `json:"server_mtime"`
-	ServerAtime    uint64 `json:"server_atime"`
-	ServerCtime    uint64 `json:"server_ctime"`
-	IsDir          uint64 `json:"isdir"`
-	Category       uint64 `json:"category"`
+	FsId           uint64  `json:"fs_id"`
+	Path           string  `json:"path"`
+	ServerFilename string  `json:"server_filename"`
+	Size           uint64  `json:"size"`
+	ServerMtime    uint64  `json:"server_mtime"`
+	ServerAtime    uint64  `json:"server_atime"`
+	ServerCtime    uint64  `json:"server_ctime"`
+	IsDir          uint64  `json:"isdir"`
+	Category       uint64  `json:"category"`
+	Thumbs         *Thumbs `json:"thumbs,omitempty"` // return when list with web=1
+}
+
+// Thumbs url of image and video,url1 is smallest
+type Thumbs struct {
+	Icon string `json:"icon"`
+	URL1 string `json:"url1"`
+	URL2 string `json:"url2"`
+	URL3 string `json:"url3"`
 }
 
 type FileListResponse struct {
-	List []*FileListItem `json:"list"`
+	List  []*FileListItem `json:"list"`
+	Title string          `json:"title"` // share title of /share/list
 }
 
 type FileMetasRequest struct {
@@ -51,6 +71,18 @@ type FileMetasRequest struct {
 	Detail    int      `query:"detail"`    // 1
 }
 
+func (r *FileMetasRequest) Values() url.Values {
+	fsIds, _ := json.Marshal(r.FsIds)
+	u := url.Values{}
+	u.Add("method", "filemetas")
+	u.Add("fsids", string(fsIds))
+	u.Add("dlink", fmt.Sprint(r.Dlink))
+	u.Add("thumb", fmt.Sprint(r.Thumb))
+	u.Add("needmedia", fmt.Sprint(r.NeedMedia))
+	u.Add("detail", fmt.Sprint(r.Detail))
+	return u
+}
+
 type FileMetaItem struct {
 	Category    uint64 `json:"category"`
 	DateTaken   uint64 `json:"date_taken"`
@@ -65,15 +97,95 @@ type FileMetaItem struct {
 	ServerCtime uint64 `json:"server_ctime"`
 	ServerMtime uint64 `json:"server_mtime"`
 	Size        uint64 `json:"size"`
-	Thumbs      struct {
-		Icon string `json:"icon"`
-		URL1 string `json:"url1"`
-		URL2 string `json:"url2"`
-		URL3 string `json:"url3"`
-	} `json:"thumbs"`
-	Width uint64 `json:"width"`
+	Thumbs      Thumbs `json:"thumbs"`
+	Width       uint64 `json:"width"`
+	Duration    uint64 `json:"duration"` // second,return when needmedia=1
+}
+
+// MediaTitle return dimensions and duration of video,like 1920x1080 01:02:03
+func (item *FileMetaItem) MediaTitle() string {
+	title := ""
+	if item.Width > 0 && item.Height > 0 {
+		title = fmt.Sprintf("%dx%d", item.Width, item.Height)
+	}
+	if item.Duration > 0 {
+		duration := time.Duration(item.Duration) * time.Second
+		if title != "" {
+			title += " "
+		}
+		title += fmt.Sprintf("%02d:%02d:%02d", int(duration.Hours()), int(duration.Minutes())%60, int(duration.Seconds())%60)
+	}
+	return title
 }
 
 type FileMetasResponse struct {
 	List []*FileMetaItem `json:"list"`
 }
+
+// StreamingResponse is json response of method=streaming,success response is m3u8 content
+type StreamingResponse struct {
+	Errno   int    `json:"errno"` // 133 need play ad before streaming
+	AdTime  uint64 `json:"adTime"`
+	AdToken string `json:"adToken"`
+	LTime   uint64 `json:"ltime"` // seconds ad token is valid
+}
+
+// StreamingAdToken return ad token which can be used after ad time
+func (r *StreamingResponse) StreamingAdToken(now time.Time) *StreamingAdToken {
+	adToken := &StreamingAdToken{
+		Token:     r.AdToken,
+		ReadyTime: uint64(now.Unix()) + r.AdTime,
+	}
+	if r.LTime != 0 {
+		adToken.ExpireTime = uint64(now.Unix()) + r.LTime
+	}
+	return adToken
+}
+
+// StreamingAdToken is token of streaming request,empty token means no ad
+type StreamingAdToken struct {
+	Token      string
+	ReadyTime  uint64
+	ExpireTime uint64 // zero if unknown
+}
+
+func (t *StreamingAdToken) Ready() bool {
+	return uint64(time.Now().Unix()) >= t.ReadyTime
+}
+
+func (t *StreamingAdToken) Expired() bool {
+	return t.ExpireTime != 0 && uint64(time.Now().Unix()) >= t.ExpireTime
+}
+
+type StreamingType struct {
+	Type       string
+	Resolution plugin.FileResource_Resolution
+	Svip       bool
+}
+
+// M3U8_AUTO_1080 only for svip
+var streamingTypes = []StreamingType{
+	{Type: "M3U8_AUTO_480", Resolution: plugin.FileResource_SD},
+	{Type: "M3U8_AUTO_720", Resolution: plugin.FileResource_HD},
+	{Type: "M3U8_AUTO_1080", Resolution: plugin.FileResource_FHD, Svip: true},
+}
+
+// category of method=search
+var searchCategoryMap = map[string]string{
+	util.CategoryVideo: "1",
+	util.CategoryAudio: "2",
+	util.CategoryImage: "3",
+	util.CategoryDoc:   "4",
+}
+
+// /share/verify
+type ShareVerifyResponse struct {
+	Randsk string `json:"randsk"` // cookie BDCLND
+}
+
+// ShareFile is raw data of share file entry
+type ShareFile struct {
+	ShareId string `json:"share_id"` // surl with prefix 1
+	Pwd     string `json:"pwd"`
+	Dir     string `json:"dir"` // empty is share root
+}
@@ -1,289 +1,645 @@
-//go:build wasip1
-
-package main
-
-import (
-	"crypto/md5"
-	"encoding/base64"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
-	"log/slog"
-	"net/url"
-	"plugins/util"
-	"time"
-
-	_ "github.com/labulakalia/wazero_net/wasi/http"
-	"github.com/medianexapp/plugin_api/httpclient"
-	"github.com/medianexapp/plugin_api/plugin"
-	"github.com/medianexapp/plugin_api/ratelimit"
-)
-
-/*
-NOTE: net and http use package
-"github.com/labulakalia/wazero_net/wasi/http"
-"github.com/labulakalia/wazero_net/wasi/net"
-*/
-
-type PluginImpl struct {
-	client    *httpclient.Client
-	token     *plugin.Token
-	userInfo  *UserInfo
-	ratelimit *ratelimit.RateLimit
-}
-
-func NewPluginImpl() *PluginImpl {
-	return &PluginImpl{
-		client:    httpclient.NewClient(),
-		ratelimit: ratelimit.New(map[string]ratelimit.LimitConfig{}),
-	}
-}
-
-// Id implements IPlugin.
-func (p *PluginImpl) PluginId() (string, error) {
-	return "baidupan", nil
-}
-
-// GetAuthe implements IPlugin.
-// Note: not store var in GetAuth
-func (p *PluginImpl) GetAuth() (*plugin.Auth, error) {
-	auth := &plugin.Auth{
-		AuthMethods: []*plugin.AuthMethod{},
-	}
-	authUrl := util.GetAuthAddr("baidupan")
-	callback := &plugin.AuthMethod_Callback{
-		Callback: &plugin.Callback{
-			CallbackUrl: authUrl,
-		},
-	}
-
-	auth.AuthMethods = append(auth.AuthMethods, &plugin.AuthMethod{
-		Method: callback,
-	})
-
-	res, err := util.GetAuthQrcode("baidupan")
-	if err != nil {
-		slog.Error("get auth qrcode failed", "err", err)
-		return nil, err
-	}
-	qrCode := QrcodeData{}
-	err = json.Unmarshal(res, &qrCode)
-	if err != nil {
-		slog.Error("unmarshal auth qrcode failed", "err", err)
-		return nil, err
-	}
-	authQrcode := &plugin.AuthMethod_Scanqrcode{
-		Scanqrcode: &plugin.Scanqrcode{
-			QrcodeImageParam: qrCode.DeviceCode,
-			QrcodeExpireTime: uint64(time.Now().Unix()) + uint64(qrCode.ExpiresIn),
-			QrcodeImageUrl:   qrCode.QrcodeURL,
-		},
-	}
-
-	auth.AuthMethods = append(auth.AuthMethods, &plugin.AuthMethod{
-		Method: authQrcode,
-	})
-	return auth, nil
-}
-
-// CheckAuth implements IPlugin.
-func (p *PluginImpl) CheckAuthMethod(authMethod *plugin.AuthMethod) (authData *plugin.AuthData, err error) {
-	var (
-		token        *plugin.Token
-		refreshToken string
-	)
-	switch v := authMethod.Method.(type) {
-	case *plugin.AuthMethod_Scanqrcode:
-		// qrcode请求间隔最少5秒 https://pan.baidu.com/union/doc/fl1x114ti
-		time.Sleep(3 * time.Second)
-		token, err = util.CheckAuthQrcode("baidupan", v.Scanqrcode.QrcodeImageParam)
-		if err != nil {
-			return nil, err
-		}
-		if token == nil {
-			return nil, nil
-		}
-	case *plugin.AuthMethod_Refresh:
-		token = &plugin.Token{}
-		err = token.UnmarshalVT(v.Refresh.AuthData.AuthDataBytes)
-		if err != nil {
-			return nil, err
-		}
-		refreshToken = token.RefreshToken
-		token, err = util.GetAuthToken(&util.GetAuthTokenRequest{
-			Id:           "baidupan",
-			RefreshToken: refreshToken,
-		})
-		if err != nil {
-			slog.Error("authCode to access token failed", "err", err)
-			return nil, err
-		}
-	case *plugin.AuthMethod_Callback:
-		slog.Info("recv callback data", "callBackData", v.Callback.CallbackUrlData)
-		token = &plugin.Token{}
-		urlParse, err := url.Parse(v.Callback.CallbackUrlData)
-		if err != nil {
-			return nil, err
-		}
-		data, err := base64.URLEncoding.DecodeString(urlParse.Query().Get("token"))
-		if err != nil {
-			return nil, err
-		}
-		err = token.UnmarshalVT(data)
-		if err != nil {
-			return nil, err
-		}
-	default:
-		return nil, fmt.Errorf("unsupport %+v", v)
-	}
-
-	tokenBytes, err := token.MarshalVT()
-	if err != nil {
-		slog.Error("marshal token failed", "err", err)
-		return nil, err
-	}
-	expireTime := time.Now().Add(time.Second * time.Duration(token.ExpiresIn-300)).Unix()
-	authData = &plugin.AuthData{
-		AuthDataBytes:       tokenBytes,
-		AuthDataExpiredTime: uint64(expireTime),
-	}
-	slog.Info("get access token success")
-	return authData, nil
-}
-
-func (p *PluginImpl) sendData(uri string, u url.Values, resp any) error {
-	u.Add("access_token", p.token.AccessToken)
-	reqUrl := fmt.Sprintf("%s%s?%s", BaiduPanURL, uri, u.Encode())
-	slog.Info("send request data", "url", reqUrl)
-	reqResp, err := p.client.Get(reqUrl)
-	if err != nil {
-		slog.Error("request url failed", "req", reqUrl)
-		return err
-	}
-	defer reqResp.Body.Close()
-	body, err := io.ReadAll(reqResp.Body)
-	if err != nil {
-		slog.Error("read response body failed", "err", err)
-		return err
-	}
-	respData := &Response{}
-	err = json.Unmarshal(body, respData)
-	if err != nil {
-		slog.Error("unmarshal response failed", "err", err)
-		return err
-	}
-	if respData.Errno != 0 {
-		slog.Error("request failed", "errno", respData.Errno, "errmsg", respData.ErrMsg)
-		return errors.New(respData.ErrMsg)
-	}
-	err = json.Unmarshal(body, resp)
-	if err != nil {
-		slog.Error("unmarshal response failed", "err", err)
-		return err
-	}
-	return nil
-}
-
-// InitAuth implements IPlugin.
-func (p *PluginImpl) CheckAuthData(authDataBytes []byte) error {
-	token := &plugin.Token{}
-	err := token.UnmarshalVT(authDataBytes)
-	if err != nil {
-		return err
-	}
-	p.token = token
-	userInfo := &UserInfo{}
-	u := url.Values{}
-	u.Add("method", "uinfo")
-	err = p.sendData("/rest/2.0/xpan/nas", u, userInfo)
-	if err != nil {
-		return err
-	}
-	p.userInfo = userInfo
-	return nil
-}
-
-// AuthId implements IPlugin.
-func (p *PluginImpl) PluginAuthId() (string, error) {
-	return fmt.Sprintf("%x", md5.Sum([]byte(p.userInfo.NetdiskName))), nil
-}
-
-// GetDirEntry implements IPlugin.
-func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
-	u := url.Values{}
-	u.Add("method", "list")
-	u.Add("dir", req.Path)
-	u.Add("order", "name")
-	u.Add("desc", "1")
-	u.Add("start", fmt.Sprint((req.Page-1)*req.PageSize))
-	u.Add("limit", fmt.Sprint(req.PageSize))
-	resp := &FileListResponse{
-		List: []*FileListItem{},
-	}
-	err := p.sendData("/rest/2.0/xpan/file", u, resp)
-	if err != nil {
-		slog.Error("list file failed", "err", err)
-		return nil, err
-	}
-	dirEntry := plugin.DirEntry{
-		FileEntries: []*plugin.FileEntry{},
-	}
-	for _, fileItem := range resp.List {
-		entry := &plugin.FileEntry{
-			Name:         fileItem.ServerFilename,
-			Size:         fileItem.Size,
-			CreatedTime:  fileItem.ServerCtime,
-			ModifiedTime: fileItem.ServerMtime,
-			AccessedTime: fileItem.ServerAtime,
-			FileType:     plugin.FileEntry_FileTypeFile,
-		}
-		itemBytes, err := json.Marshal(fileItem)
-		if err == nil {
-			entry.RawData = itemBytes
-		}
-		if fileItem.IsDir == 1 {
-			entry.FileType = plugin.FileEntry_FileTypeDir
-		}
-		dirEntry.FileEntries = append(dirEntry.FileEntries, entry)
-	}
-	return &dirEntry, nil
-}
-
-// GetFileResource implements IPlugin.
-func (p *PluginImpl) GetFileResource(req *plugin.GetFileResourceRequest) (*plugin.FileResource, error) {
-	fileItem := &FileListItem{}
-	err := json.Unmarshal(req.FileEntry.RawData, fileItem)
-	if err != nil {
-		return nil, err
-	}
-
-	fileMetaResp := &FileMetasResponse{
-		List: []*FileMetaItem{},
-	}
-	u := url.Values{}
-	u.Add("method", "filemetas")
-	u.Add("fsids", fmt.Sprintf("[%d]", fileItem.FsId))
-	u.Add("dlink", "1")
-	err = p.sendData("/rest/2.0/xpan/multimedia", u, fileMetaResp)
-	if err != nil {
-		return nil, err
-	}
-	if len(fileMetaResp.List) == 0 {
-		return nil, fmt.Errorf("file %s not found", req.FilePath)
-	}
-	fileResource := &plugin.FileResource{
-		FileResourceData: []*plugin.FileResource_FileResourceData{
-			{
-				Url:        fmt.Sprintf("%s&access_token=%s", fileMetaResp.List[0].Dlink, p.token.AccessToken),
-				ExpireTime: uint64(time.Now().Add(time.Hour * 8).Unix()),
-				Resolution: plugin.FileResource_Original,
-				Header: map[string]string{
-					"Host":       "d.pcs.baidu.com",
-					"User-Agent": "pan.baidu.com",
-				},
-			},
-		},
-	}
-	return fileResource, nil
-}
+//go:build wasip1
+
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"plugins/util"
+	"strings"
+	"time"
+
+	_ "github.com/labulakalia/wazero_net/wasi/http"
+	"github.com/medianexapp/plugin_api/httpclient"
+	"github.com/medianexapp/plugin_api/plugin"
+	"github.com/medianexapp/plugin_api/ratelimit"
+)
+
+/*
+NOTE: net and http use package
+"github.com/labulakalia/wazero_net/wasi/http"
+"github.com/labulakalia/wazero_net/wasi/net"
+*/
+
+const (
+	// dlink expire 8H
+	dlinkExpireDuration = 8 * time.Hour
+	adTokenCacheSize    = 1000
+	// streaming request must use this user agent,format xpanvideo;$appName;$appVersion;$sysName;$sysVersion;ts
+	streamingUserAgent = "xpanvideo;medianex;1.0.0;wasip1;1.0.0;ts"
+
+	vipTypeSvip = 2
+)
+
+type PluginImpl struct {
+	client    *httpclient.Client
+	token     *plugin.Token
+	userInfo  *UserInfo
+	shares    util.Shares
+	ratelimit *ratelimit.RateLimit
+	// path -> ad token of streaming,non svip user can use it after ad time
+	adTokens *util.Cache[string, *StreamingAdToken]
+}
+
+func NewPluginImpl() *PluginImpl {
+	// too frequent request return errno 31034
+	limitConfigMap := map[string]ratelimit.LimitConfig{
+		"uinfo": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: time.Second,
+		},
+		"list": ratelimit.LimitConfig{
+			Limit:    2,
+			Duration: time.Second,
+		},
+		"filemetas": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: time.Second,
+		},
+		"streaming": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: time.Second,
+		},
+		"search": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: time.Second,
+		},
+		"/share/verify": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: time.Second,
+		},
+		"/share/list": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: time.Second,
+		},
+	}
+	return &PluginImpl{
+		client:    httpclient.NewClient(),
+		ratelimit: ratelimit.New(limitConfigMap),
+		adTokens:  util.NewCache[string, *StreamingAdToken](adTokenCacheSize, 0),
+	}
+}
+
+// Id implements IPlugin.
+func (p *PluginImpl) PluginId() (string, error) {
+	return "baidupan", nil
+}
+
+// GetAuthe implements IPlugin.
+// Note: not store var in GetAuth
+func (p *PluginImpl) GetAuth() (*plugin.Auth, error) {
+	auth := &plugin.Auth{
+		AuthMethods: []*plugin.AuthMethod{},
+	}
+	authUrl := util.GetAuthAddr("baidupan")
+	callback := &plugin.AuthMethod_Callback{
+		Callback: &plugin.Callback{
+			CallbackUrl: authUrl,
+		},
+	}
+
+	auth.AuthMethods = append(auth.AuthMethods, &plugin.AuthMethod{
+		Method: callback,
+	})
+
+	res, err := util.GetAuthQrcode("baidupan")
+	if err != nil {
+		slog.Error("get auth qrcode failed", "err", err)
+		return nil, err
+	}
+	qrCode := QrcodeData{}
+	err = json.Unmarshal(res, &qrCode)
+	if err != nil {
+		slog.Error("unmarshal auth qrcode failed", "err", err)
+		return nil, err
+	}
+	authQrcode := &plugin.AuthMethod_Scanqrcode{
+		Scanqrcode: &plugin.Scanqrcode{
+			QrcodeImageParam: qrCode.DeviceCode,
+			QrcodeExpireTime: uint64(time.Now().Unix()) + uint64(qrCode.ExpiresIn),
+			QrcodeImageUrl:   qrCode.QrcodeURL,
+		},
+	}
+
+	auth.AuthMethods = append(auth.AuthMethods, &plugin.AuthMethod{
+		Method: authQrcode,
+	})
+	return auth, nil
+}
+
+// CheckAuth implements IPlugin.
+func (p *PluginImpl) CheckAuthMethod(authMethod *plugin.AuthMethod) (authData *plugin.AuthData, err error) {
+	var (
+		token        *plugin.Token
+		refreshToken string
+	)
+	switch v := authMethod.Method.(type) {
+	case *plugin.AuthMethod_Scanqrcode:
+		// qrcode请求间隔最少5秒 https://pan.baidu.com/union/doc/fl1x114ti
+		time.Sleep(3 * time.Second)
+		token, err = util.CheckAuthQrcode("baidupan", v.Scanqrcode.QrcodeImageParam)
+		if err != nil {
+			return nil, err
+		}
+		if token == nil {
+			return nil, nil
+		}
+	case *plugin.AuthMethod_Refresh:
+		token = &plugin.Token{}
+		err = token.UnmarshalVT(v.Refresh.AuthData.AuthDataBytes)
+		if err != nil {
+			return nil, err
+		}
+		refreshToken = token.RefreshToken
+		token, err = util.GetAuthToken(&util.GetAuthTokenRequest{
+			Id:           "baidupan",
+			RefreshToken: refreshToken,
+		})
+		if err != nil {
+			slog.Error("authCode to access token failed", "err", err)
+			return nil, err
+		}
+	case *plugin.AuthMethod_Callback:
+		slog.Info("recv callback data", "callBackData", v.Callback.CallbackUrlData)
+		token = &plugin.Token{}
+		urlParse, err := url.Parse(v.Callback.CallbackUrlData)
+		if err != nil {
+			return nil, err
+		}
+		data, err := base64.URLEncoding.DecodeString(urlParse.Query().Get("token"))
+		if err != nil {
+			return nil, err
+		}
+		err = token.UnmarshalVT(data)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupport %+v", v)
+	}
+
+	tokenBytes, err := token.MarshalVT()
+	if err != nil {
+		slog.Error("marshal token failed", "err", err)
+		return nil, err
+	}
+	expireTime := time.Now().Add(time.Second * time.Duration(token.ExpiresIn-300)).Unix()
+	authData = &plugin.AuthData{
+		AuthDataBytes:       tokenBytes,
+		AuthDataExpiredTime: uint64(expireTime),
+	}
+	slog.Info("get access token success")
+	return authData, nil
+}
+
+func (p *PluginImpl) sendData(uri string, u url.Values, resp any) error {
+	p.ratelimit.Wait(u.Get("method"))
+	u.Add("access_token", p.token.AccessToken)
+	reqUrl := fmt.Sprintf("%s%s?%s", BaiduPanURL, uri, u.Encode())
+	slog.Info("send request data", "url", reqUrl)
+	reqResp, err := p.client.Get(reqUrl)
+	if err != nil {
+		slog.Error("request url failed", "req", reqUrl)
+		return err
+	}
+	defer reqResp.Body.Close()
+	body, err := io.ReadAll(reqResp.Body)
+	if err != nil {
+		slog.Error("read response body failed", "err", err)
+		return err
+	}
+	return parseResponse(body, resp)
+}
+
+// sendShare send share web api,randsk is verified cookie of share with pwd
+func (p *PluginImpl) sendShare(method string, uri string, u url.Values, form url.Values, randsk string, resp any) error {
+	p.ratelimit.Wait(uri)
+	u.Add("channel", "chunlei")
+	u.Add("clienttype", "0")
+	u.Add("web", "1")
+	reqUrl := fmt.Sprintf("%s%s?%s", BaiduPanURL, uri, u.Encode())
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, reqUrl, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Referer", BaiduPanURL)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if randsk != "" {
+		req.Header.Set("Cookie", fmt.Sprintf("BDCLND=%s", randsk))
+	}
+	reqResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Error("request url failed", "req", reqUrl)
+		return err
+	}
+	defer reqResp.Body.Close()
+	respBody, err := io.ReadAll(reqResp.Body)
+	if err != nil {
+		slog.Error("read response body failed", "err", err)
+		return err
+	}
+	return parseResponse(respBody, resp)
+}
+
+func parseResponse(body []byte, resp any) error {
+	respData := &Response{}
+	err := json.Unmarshal(body, respData)
+	if err != nil {
+		slog.Error("unmarshal response failed", "err", err)
+		return err
+	}
+	if respData.Errno != 0 {
+		slog.Error("request failed", "errno", respData.Errno, "errmsg", respData.ErrMsg)
+		if respData.ErrMsg == "" {
+			return fmt.Errorf("request failed,errno %d", respData.Errno)
+		}
+		return errors.New(respData.ErrMsg)
+	}
+	err = json.Unmarshal(body, resp)
+	if err != nil {
+		slog.Error("unmarshal response failed", "err", err)
+		return err
+	}
+	return nil
+}
+
+// InitAuth implements IPlugin.
+func (p *PluginImpl) CheckAuthData(authDataBytes []byte) error {
+	token := &plugin.Token{}
+	err := token.UnmarshalVT(authDataBytes)
+	if err != nil {
+		return err
+	}
+	p.token = token
+	userInfo := &UserInfo{}
+	u := url.Values{}
+	u.Add("method", "uinfo")
+	err = p.sendData("/rest/2.0/xpan/nas", u, userInfo)
+	if err != nil {
+		return err
+	}
+	p.userInfo = userInfo
+	return nil
+}
+
+// AuthId implements IPlugin.
+func (p *PluginImpl) PluginAuthId() (string, error) {
+	return fmt.Sprintf("%x", md5.Sum([]byte(p.userInfo.NetdiskName))), nil
+}
+
+// GetDirEntry implements IPlugin.
+func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	if util.IsShareEntry(req.Path, req.FileEntry, "share_id") {
+		return p.getShareDirEntry(req)
+	}
+	dir := req.Path
+	if util.IsSearchPath(req.Path) {
+		if req.FileEntry == nil || req.FileEntry.RawData == nil {
+			return p.search(req)
+		}
+		// dir of search result
+		fileItem := &FileListItem{}
+		err := json.Unmarshal(req.FileEntry.RawData, fileItem)
+		if err != nil {
+			return nil, err
+		}
+		dir = fileItem.Path
+	}
+	u := url.Values{}
+	u.Add("method", "list")
+	u.Add("dir", dir)
+	u.Add("order", "name")
+	u.Add("desc", "1")
+	u.Add("start", fmt.Sprint((req.Page-1)*req.PageSize))
+	u.Add("limit", fmt.Sprint(req.PageSize))
+	// return thumbs of image and video
+	u.Add("web", "1")
+	resp := &FileListResponse{
+		List: []*FileListItem{},
+	}
+	err := p.sendData("/rest/2.0/xpan/file", u, resp)
+	if err != nil {
+		slog.Error("list file failed", "err", err)
+		return nil, err
+	}
+	dirEntry := plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+	}
+	for _, fileItem := range resp.List {
+		entry := &plugin.FileEntry{
+			Name:         fileItem.ServerFilename,
+			Size:         fileItem.Size,
+			CreatedTime:  fileItem.ServerCtime,
+			ModifiedTime: fileItem.ServerMtime,
+			AccessedTime: fileItem.ServerAtime,
+			FileType:     plugin.FileEntry_FileTypeFile,
+		}
+		itemBytes, err := json.Marshal(fileItem)
+		if err == nil {
+			entry.RawData = itemBytes
+		}
+		if fileItem.IsDir == 1 {
+			entry.FileType = plugin.FileEntry_FileTypeDir
+		}
+		dirEntry.FileEntries = append(dirEntry.FileEntries, entry)
+	}
+	if req.Path == "/" && req.Page == 1 {
+		dirEntry.FileEntries = append(dirEntry.FileEntries, util.SharesFileEntry(), util.SearchFileEntry())
+	}
+	return &dirEntry, nil
+}
+
+// search file by "/search/<keyword>",result name is full path
+func (p *PluginImpl) search(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+	}
+	if req.Path == util.SearchDir {
+		return dirEntry, nil
+	}
+	query, err := util.ParseSearchQuery(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	u := url.Values{}
+	u.Add("method", "search")
+	u.Add("key", query.Keyword)
+	u.Add("dir", "/")
+	u.Add("recursion", "1")
+	u.Add("page", fmt.Sprint(req.Page))
+	u.Add("num", fmt.Sprint(req.PageSize))
+	if category, ok := searchCategoryMap[query.Category]; ok {
+		u.Add("category", category)
+	}
+	resp := &FileListResponse{
+		List: []*FileListItem{},
+	}
+	err = p.sendData("/rest/2.0/xpan/file", u, resp)
+	if err != nil {
+		slog.Error("search file failed", "err", err)
+		return nil, err
+	}
+	for _, fileItem := range resp.List {
+		entry := &plugin.FileEntry{
+			Name:         strings.TrimPrefix(fileItem.Path, "/"),
+			Size:         fileItem.Size,
+			CreatedTime:  fileItem.ServerCtime,
+			ModifiedTime: fileItem.ServerMtime,
+			AccessedTime: fileItem.ServerAtime,
+			FileType:     plugin.FileEntry_FileTypeFile,
+		}
+		itemBytes, err := json.Marshal(fileItem)
+		if err == nil {
+			entry.RawData = itemBytes
+		}
+		if fileItem.IsDir == 1 {
+			entry.FileType = plugin.FileEntry_FileTypeDir
+		}
+		dirEntry.FileEntries = append(dirEntry.FileEntries, entry)
+	}
+	return dirEntry, nil
+}
+
+// getShareDirEntry list opened shares in "/shares",
+// if path is "/shares/<share link>",list root of share
+func (p *PluginImpl) getShareDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	if req.Path == util.SharesDir {
+		return p.shares.DirEntry(), nil
+	}
+	shareFile := &ShareFile{}
+	isShareRoot := req.FileEntry == nil || req.FileEntry.RawData == nil
+	if isShareRoot {
+		shareLink, err := util.ParseShareLink(req.Path)
+		if err != nil {
+			return nil, err
+		}
+		shareFile.ShareId = shareLink.Id
+		shareFile.Pwd = shareLink.Pwd
+	} else {
+		err := json.Unmarshal(req.FileEntry.RawData, shareFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// surl is share id without prefix 1
+	surl := strings.TrimPrefix(shareFile.ShareId, "1")
+	randsk := ""
+	if shareFile.Pwd != "" {
+		u := url.Values{}
+		u.Add("surl", surl)
+		u.Add("t", fmt.Sprint(time.Now().UnixMilli()))
+		form := url.Values{}
+		form.Add("pwd", shareFile.Pwd)
+		form.Add("vcode", "")
+		form.Add("vcode_str", "")
+		verifyResp := &ShareVerifyResponse{}
+		err := p.sendShare(http.MethodPost, "/share/verify", u, form, "", verifyResp)
+		if err != nil {
+			return nil, err
+		}
+		randsk = verifyResp.Randsk
+	}
+	u := url.Values{}
+	u.Add("shorturl", surl)
+	u.Add("page", fmt.Sprint(req.Page))
+	u.Add("num", fmt.Sprint(req.PageSize))
+	u.Add("order", "name")
+	if shareFile.Dir == "" {
+		u.Add("root", "1")
+	} else {
+		u.Add("dir", shareFile.Dir)
+	}
+	resp := &FileListResponse{
+		List: []*FileListItem{},
+	}
+	err := p.sendShare(http.MethodGet, "/share/list", u, nil, randsk, resp)
+	if err != nil {
+		return nil, err
+	}
+	if isShareRoot {
+		name := resp.Title
+		if name == "" {
+			name = shareFile.ShareId
+		}
+		rawData, _ := json.Marshal(shareFile)
+		p.shares.Store(&plugin.FileEntry{
+			Name:     path.Base(name),
+			FileType: plugin.FileEntry_FileTypeDir,
+			RawData:  rawData,
+		})
+	}
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+	}
+	for _, fileItem := range resp.List {
+		entry := &plugin.FileEntry{
+			Name:         fileItem.ServerFilename,
+			Size:         fileItem.Size,
+			CreatedTime:  fileItem.ServerCtime,
+			ModifiedTime: fileItem.ServerMtime,
+			AccessedTime: fileItem.ServerMtime,
+			FileType:     plugin.FileEntry_FileTypeFile,
+		}
+		if fileItem.IsDir == 1 {
+			entry.FileType = plugin.FileEntry_FileTypeDir
+			entry.RawData, _ = json.Marshal(&ShareFile{
+				ShareId: shareFile.ShareId,
+				Pwd:     shareFile.Pwd,
+				Dir:     fileItem.Path,
+			})
+		}
+		dirEntry.FileEntries = append(dirEntry.FileEntries, entry)
+	}
+	return dirEntry, nil
+}
+
+// GetFileResource implements IPlugin.
+func (p *PluginImpl) GetFileResource(req *plugin.GetFileResourceRequest) (*plugin.FileResource, error) {
+	if util.IsShareEntry(req.FilePath, req.FileEntry, "share_id") {
+		// dlink of share file need transfer it to drive
+		return nil, util.ErrShareNotPlayable
+	}
+	fileItem := &FileListItem{}
+	err := json.Unmarshal(req.FileEntry.RawData, fileItem)
+	if err != nil {
+		return nil, err
+	}
+
+	fileMetaResp := &FileMetasResponse{
+		List: []*FileMetaItem{},
+	}
+	fileMetasReq := &FileMetasRequest{
+		FsIds:     []uint64{fileItem.FsId},
+		Dlink:     1,
+		Thumb:     1,
+		NeedMedia: 1,
+		Detail:    1,
+	}
+	err = p.sendData("/rest/2.0/xpan/multimedia", fileMetasReq.Values(), fileMetaResp)
+	if err != nil {
+		return nil, err
+	}
+	if len(fileMetaResp.List) == 0 {
+		return nil, fmt.Errorf("file %s not found", req.FilePath)
+	}
+	fileResource := &plugin.FileResource{
+		FileResourceData: []*plugin.FileResource_FileResourceData{
+			{
+				Url:          fmt.Sprintf("%s&access_token=%s", fileMetaResp.List[0].Dlink, p.token.AccessToken),
+				ExpireTime:   uint64(time.Now().Add(dlinkExpireDuration).Unix()),
+				Resolution:   plugin.FileResource_Original,
+				ResourceType: plugin.FileResource_Video,
+				Title:        fileMetaResp.List[0].MediaTitle(),
+				Size:         fileMetaResp.List[0].Size,
+				Header: map[string]string{
+					"Host":       "d.pcs.baidu.com",
+					"User-Agent": "pan.baidu.com",
+				},
+			},
+		},
+	}
+	if req.IsMedia {
+		streamingData, err := p.getStreamingResource(fileItem.Path)
+		if err != nil {
+			// raw dlink is still playable
+			slog.Error("get streaming resource failed", "path", fileItem.Path, "err", err)
+		} else {
+			fileResource.FileResourceData = append(fileResource.FileResourceData, streamingData...)
+		}
+	}
+	return fileResource, nil
+}
+
+// getStreamingResource return m3u8 transcode resource of video,
+// non svip user get it after ad time of the first request is passed
+func (p *PluginImpl) getStreamingResource(path string) ([]*plugin.FileResource_FileResourceData, error) {
+	adToken, ok := p.adTokens.Get(path)
+	if !ok || adToken.Expired() {
+		var err error
+		adToken, err = p.getStreamingAdToken(path)
+		if err != nil {
+			return nil, err
+		}
+		if adToken.Token != "" {
+			p.adTokens.Set(path, adToken)
+		}
+	}
+	if !adToken.Ready() {
+		slog.Info("streaming is ready after ad time", "path", path, "readyTime", adToken.ReadyTime)
+		return nil, nil
+	}
+	resourceDatas := []*plugin.FileResource_FileResourceData{}
+	for _, streamingType := range streamingTypes {
+		if streamingType.Svip && p.userInfo.VipType != vipTypeSvip {
+			continue
+		}
+		resourceDatas = append(resourceDatas, &plugin.FileResource_FileResourceData{
+			Url:          p.streamingURL(path, streamingType.Type, adToken.Token),
+			ExpireTime:   adToken.ExpireTime,
+			Resolution:   streamingType.Resolution,
+			ResourceType: plugin.FileResource_Video,
+			Header: map[string]string{
+				"User-Agent": streamingUserAgent,
+			},
+		})
+	}
+	return resourceDatas, nil
+}
+
+func (p *PluginImpl) streamingURL(path, streamingType, adToken string) string {
+	u := url.Values{}
+	u.Add("method", "streaming")
+	u.Add("access_token", p.token.AccessToken)
+	u.Add("path", path)
+	u.Add("type", streamingType)
+	if adToken != "" {
+		u.Add("adToken", adToken)
+	}
+	return fmt.Sprintf("%s/rest/2.0/xpan/file?%s", BaiduPanURL, u.Encode())
+}
+
+// getStreamingAdToken request streaming once,return empty token if user need not play ad
+func (p *PluginImpl) getStreamingAdToken(path string) (*StreamingAdToken, error) {
+	p.ratelimit.Wait("streaming")
+	req, err := http.NewRequest(http.MethodGet, p.streamingURL(path, streamingTypes[0].Type, ""), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", streamingUserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(string(body), "#EXTM3U") {
+		return &StreamingAdToken{}, nil
+	}
+	streamingResp := &StreamingResponse{}
+	err = json.Unmarshal(body, streamingResp)
+	if err != nil {
+		slog.Error("unmarshal streaming response failed", "err", err)
+		return nil, err
+	}
+	if streamingResp.Errno != 133 {
+		return nil, fmt.Errorf("get streaming failed,errno %d", streamingResp.Errno)
+	}
+	return streamingResp.StreamingAdToken(time.Now()), nil
+}
@@ -1,8 +1,18 @@
+//go:build wasip1
+
 package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/medianexapp/plugin_api/plugin"
 )
 
 func TestResponse(t *testing.T) {
@@ -25,3 +35,107 @@ func TestResponse(t *testing.T) {
 	t.Log(json.Unmarshal([]byte(dd), &resp))
 	t.Logf("%+v", uinfo)
 }
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestGetStreamingResource(t *testing.T) {
+	adTime := 0
+	streamingCount := 0
+	transport := http.DefaultClient.Transport
+	defer func() {
+		http.DefaultClient.Transport = transport
+	}()
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := ""
+		switch req.URL.Query().Get("method") {
+		case "filemetas":
+			query := req.URL.Query()
+			if query.Get("fsids") != "[1]" || query.Get("thumb") != "1" || query.Get("needmedia") != "1" || query.Get("detail") != "1" {
+				t.Errorf("unexpected filemetas query %s", req.URL.RawQuery)
+			}
+			body = `{"errno":0,"list":[{"fs_id":1,"path":"/video.mp4","size":1024,"width":1920,"height":1080,"duration":3723,"dlink":"https://d.pcs.baidu.com/file/abc?fid=1"}]}`
+		case "streaming":
+			if req.Header.Get("User-Agent") != streamingUserAgent {
+				t.Errorf("unexpected user agent %s", req.Header.Get("User-Agent"))
+			}
+			streamingCount++
+			body = fmt.Sprintf(`{"errno":133,"adTime":%d,"adToken":"ad-token","ltime":3600}`, adTime)
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+
+	p := NewPluginImpl()
+	p.token = &plugin.Token{AccessToken: "token"}
+	p.userInfo = &UserInfo{VipType: 1}
+	rawData, _ := json.Marshal(&FileListItem{FsId: 1, Path: "/video.mp4"})
+	resource, err := p.GetFileResource(&plugin.GetFileResourceRequest{
+		FilePath:  "/video.mp4",
+		FileEntry: &plugin.FileEntry{RawData: rawData},
+		IsMedia:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// dlink,480p,720p
+	if len(resource.FileResourceData) != 3 {
+		t.Fatalf("unexpected resource count %d", len(resource.FileResourceData))
+	}
+	if resource.FileResourceData[0].ResourceType != plugin.FileResource_Video || resource.FileResourceData[0].Size != 1024 || resource.FileResourceData[0].Title != "1920x1080 01:02:03" {
+		t.Fatalf("unexpected dlink resource %v", resource.FileResourceData[0])
+	}
+	streaming := resource.FileResourceData[2]
+	u, err := url.Parse(streaming.Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if streaming.Resolution != plugin.FileResource_HD || u.Query().Get("type") != "M3U8_AUTO_720" || u.Query().Get("adToken") != "ad-token" {
+		t.Fatalf("unexpected streaming resource %v", streaming)
+	}
+	if streaming.Header["User-Agent"] != streamingUserAgent {
+		t.Fatalf("unexpected streaming header %v", streaming.Header)
+	}
+	if expireTime := uint64(time.Now().Unix()) + 3600; streaming.ExpireTime < expireTime-5 || streaming.ExpireTime > expireTime {
+		t.Fatalf("unexpected streaming expire time %d", streaming.ExpireTime)
+	}
+
+	// streaming is not returned until ad time is passed,and ad token is requested once
+	adTime = 30
+	streamingCount = 0
+	rawData, _ = json.Marshal(&FileListItem{FsId: 1, Path: "/ad.mp4"})
+	for range 2 {
+		resource, err = p.GetFileResource(&plugin.GetFileResourceRequest{
+			FilePath:  "/ad.mp4",
+			FileEntry: &plugin.FileEntry{RawData: rawData},
+			IsMedia:   true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resource.FileResourceData) != 1 {
+			t.Fatalf("streaming should wait ad time,got %d resource", len(resource.FileResourceData))
+		}
+	}
+	adToken, _ := p.adTokens.Get("/ad.mp4")
+	adToken.ReadyTime = uint64(time.Now().Unix())
+	resource, err = p.GetFileResource(&plugin.GetFileResourceRequest{
+		FilePath:  "/ad.mp4",
+		FileEntry: &plugin.FileEntry{RawData: rawData},
+		IsMedia:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resource.FileResourceData) != 3 || streamingCount != 1 {
+		t.Fatalf("unexpected resource count %d,streaming request %d", len(resource.FileResourceData), streamingCount)
+	}
+}
@@ -1,15 +1,15 @@
-// DO NOT EDIT.
-//go:build wasip1
-
-package main
-
-import (
-	"github.com/medianexapp/plugin_api"
-)
-
-func init() {
-	plugin_api.RegistryPlugin(NewPluginImpl())
-}
-
-func main() {
-}
+// DO NOT EDIT.
+//go:build wasip1
+
+package main
+
+import (
+	"github.com/medianexapp/plugin_api"
+)
+
+func init() {
+	plugin_api.RegistryPlugin(NewPluginImpl())
+}
+
+func main() {
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"plugins/util"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrArchiveMemberCompressed = errors.New("compressed archive member can not stream,extract it first")
+
+	archiveExts = []string{".zip", ".tar", ".7z"}
+)
+
+// archiveMember is file or dir in archive
+type archiveMember struct {
+	name    string // path in archive without leading "/"
+	isDir   bool
+	size    int64
+	modTime time.Time
+	offset  int64 // offset of data in archive,-1 if member is compressed
+}
+
+func isArchive(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, archiveExt := range archiveExts {
+		if ext == archiveExt {
+			return true
+		}
+	}
+	return false
+}
+
+// sliceURL is url of byte range of member data in archive,like bluray:// and dvd:// of iso,
+// player read it by mpv slice protocol "slice://start-end@url",range is [start,end) and seekable
+func sliceURL(archiveURL string, member *archiveMember) string {
+	return fmt.Sprintf("slice://%d-%d@%s", member.offset, member.offset+member.size, archiveURL)
+}
+
+type archiveCacheItem struct {
+	modTime time.Time
+	size    int64
+	members []*archiveMember
+}
+
+// archiveCacheSize is max count of cached archive
+const archiveCacheSize = 100
+
+// archive members are cached until archive is modified
+var archiveCache = util.NewCache[string, *archiveCacheItem](archiveCacheSize, 0)
+
+func readArchive(archivePath string) ([]*archiveMember, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if item, ok := archiveCache.Get(archivePath); ok {
+		if item.modTime.Equal(info.ModTime()) && item.size == info.Size() {
+			return item.members, nil
+		}
+	}
+	var members []*archiveMember
+	switch strings.ToLower(path.Ext(archivePath)) {
+	case ".zip":
+		members, err = readZip(f, info.Size())
+	case ".tar":
+		members, err = readTar(f)
+	case ".7z":
+		members, err = readSevenZip(f)
+	default:
+		err = fmt.Errorf("unsupported archive %s", archivePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	archiveCache.Set(archivePath, &archiveCacheItem{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		members: members,
+	})
+	return members, nil
+}
+
+// cleanMemberName clean name in archive,return empty if name is invalid
+func cleanMemberName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, `\`, "/")), "/")
+}
+
+func readZip(f *os.File, size int64) ([]*archiveMember, error) {
+	zipReader, err := zip.NewReader(f, size)
+	if err != nil {
+		return nil, err
+	}
+	members := []*archiveMember{}
+	for _, file := range zipReader.File {
+		name := cleanMemberName(file.Name)
+		if name == "" {
+			continue
+		}
+		member := &archiveMember{
+			name:    name,
+			isDir:   file.FileInfo().IsDir(),
+			size:    int64(file.UncompressedSize64),
+			modTime: file.Modified,
+			offset:  -1,
+		}
+		// encrypted member can not stream too
+		if !member.isDir && file.Method == zip.Store && file.Flags&0x1 == 0 {
+			member.offset, err = file.DataOffset()
+			if err != nil {
+				return nil, err
+			}
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func readTar(f *os.File) ([]*archiveMember, error) {
+	// tar reader seek over file data,so only headers are read
+	tarReader := tar.NewReader(f)
+	members := []*archiveMember{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := cleanMemberName(header.Name)
+		if name == "" {
+			continue
+		}
+		member := &archiveMember{
+			name:    name,
+			size:    header.Size,
+			modTime: header.ModTime,
+			offset:  -1,
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			member.isDir = true
+			member.size = 0
+		case tar.TypeReg, tar.TypeRegA:
+			member.offset, err = f.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+		case tar.TypeGNUSparse:
+		default:
+			continue
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// listArchiveDir return members in dir of archive,dir which has no member entry is added too
+func listArchiveDir(members []*archiveMember, dirPath string) []*archiveMember {
+	prefix := strings.TrimPrefix(path.Clean("/"+dirPath), "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	children := map[string]*archiveMember{}
+	for _, member := range members {
+		if !strings.HasPrefix(member.name, prefix) || member.name == strings.TrimSuffix(prefix, "/") {
+			continue
+		}
+		rel := strings.TrimPrefix(member.name, prefix)
+		name, _, isSub := strings.Cut(rel, "/")
+		if isSub {
+			if _, ok := children[name]; !ok {
+				children[name] = &archiveMember{name: prefix + name, isDir: true, offset: -1}
+			}
+			continue
+		}
+		children[name] = member
+	}
+	entries := make([]*archiveMember, 0, len(children))
+	for _, member := range children {
+		entries = append(entries, member)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+	return entries
+}
+
+// findArchiveMember find member of path in archive
+func findArchiveMember(members []*archiveMember, memberPath string) (*archiveMember, error) {
+	name := cleanMemberName(memberPath)
+	for _, member := range members {
+		if member.name == name {
+			return member, nil
+		}
+	}
+	// dir without member entry
+	if name != "" && len(listArchiveDir(members, name)) > 0 {
+		return &archiveMember{name: name, isDir: true, offset: -1}, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// splitArchive split path in archive to archive path and member path,like
+// "/Show.S01.zip/E01.mkv" to "/Show.S01.zip" and "/E01.mkv"
+func (r *localRoot) splitArchive(cleanedPath string) (string, string, bool) {
+	elems := strings.Split(strings.TrimPrefix(cleanedPath, "/"), "/")
+	for i, elem := range elems {
+		if !isArchive(elem) {
+			continue
+		}
+		archivePath := "/" + strings.Join(elems[:i+1], "/")
+		realPath, err := r.resolve(archivePath)
+		if err != nil {
+			return "", "", false
+		}
+		info, err := os.Stat(realPath)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		return archivePath, "/" + strings.Join(elems[i+1:], "/"), true
+	}
+	return "", "", false
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var archiveTestFiles = []struct {
+	name string
+	data string
+}{
+	{"Show/E01.mkv", "episode one"},
+	{"Show/E02.mkv", "episode two!"},
+	{"Show/Extras/making.mp4", "extras"},
+}
+
+func writeTestZip(t *testing.T, archivePath string) {
+	buf := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(buf)
+	for i, file := range archiveTestFiles {
+		method := zip.Store
+		// the last file is compressed
+		if i == len(archiveTestFiles)-1 {
+			method = zip.Deflate
+		}
+		w, err := zipWriter.CreateHeader(&zip.FileHeader{Name: file.name, Method: method, Modified: time.Unix(1700000000, 0)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(file.data))
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(archivePath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestTar(t *testing.T, archivePath string) {
+	buf := &bytes.Buffer{}
+	tarWriter := tar.NewWriter(buf)
+	tarWriter.WriteHeader(&tar.Header{Name: "./Show/", Typeflag: tar.TypeDir, Mode: 0o755, ModTime: time.Unix(1700000000, 0)})
+	for _, file := range archiveTestFiles {
+		err := tarWriter.WriteHeader(&tar.Header{Name: "./" + file.name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(file.data)), ModTime: time.Unix(1700000000, 0)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tarWriter.Write([]byte(file.data))
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(archivePath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestSevenZip copy stored 7z archive in testdata,it is created by libarchive with
+// bsdtar --format 7zip --options 7zip:compression=store -cf Show.S01.7z Show,
+// header of it is not compressed like 7z a -mx0 -mhc=off
+func writeTestSevenZip(t *testing.T, archivePath string) {
+	data, err := os.ReadFile(filepath.Join("testdata", "Show.S01.7z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(archivePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadArchive(t *testing.T) {
+	dir := t.TempDir()
+	for name, write := range map[string]func(*testing.T, string){
+		"Show.S01.zip": writeTestZip,
+		"Show.S01.tar": writeTestTar,
+		"Show.S01.7z":  writeTestSevenZip,
+	} {
+		archivePath := filepath.Join(dir, name)
+		write(t, archivePath)
+		archive, err := os.ReadFile(archivePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		members, err := readArchive(archivePath)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		entries := listArchiveDir(members, "/")
+		if len(entries) != 1 || entries[0].name != "Show" || !entries[0].isDir {
+			t.Fatalf("%s unexpected root entries %+v", name, entries)
+		}
+		entries = listArchiveDir(members, "/Show")
+		if len(entries) != 3 || entries[0].name != "Show/E01.mkv" || entries[1].name != "Show/E02.mkv" || entries[2].name != "Show/Extras" || !entries[2].isDir {
+			t.Fatalf("%s unexpected show entries %+v", name, entries)
+		}
+		for i, file := range archiveTestFiles {
+			member, err := findArchiveMember(members, "/"+file.name)
+			if err != nil {
+				t.Fatal(name, err)
+			}
+			if member.size != int64(len(file.data)) {
+				t.Fatalf("%s %s unexpected size %d", name, file.name, member.size)
+			}
+			if name == "Show.S01.zip" && i == len(archiveTestFiles)-1 {
+				if member.offset >= 0 {
+					t.Fatalf("compressed member should not stream")
+				}
+				continue
+			}
+			if got := string(archive[member.offset : member.offset+member.size]); got != file.data {
+				t.Fatalf("%s %s unexpected data %s", name, file.name, got)
+			}
+		}
+		_, err = findArchiveMember(members, "/Show/E03.mkv")
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("%s unexpected err %v", name, err)
+		}
+	}
+}
+
+func TestSevenZipSubStreamsSize(t *testing.T) {
+	for sizes, wantErr := range map[string]bool{
+		"\x04\x06": false,
+		"\x05\x06": true,
+		"\x0b\x00": true,
+	} {
+		folder := &sevenZipFolderInfo{unpackSize: 10}
+		r := &sevenZipReader{buf: []byte{sevenZipNumUnpackStream, 3, sevenZipSize, sizes[0], sizes[1], sevenZipEnd}}
+		r.subStreamsInfo(&sevenZipArchive{folders: []*sevenZipFolderInfo{folder}})
+		if (r.err != nil) != wantErr {
+			t.Fatalf("sizes %v got %v", []byte(sizes), r.err)
+		}
+		if !wantErr && folder.subStreamSize[2] != 0 {
+			t.Fatalf("unexpected sizes %v", folder.subStreamSize)
+		}
+	}
+}
+
+func TestSplitArchive(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "packs", "dir.zip"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestZip(t, filepath.Join(dir, "packs", "Show.S01.zip"))
+	root := &localRoot{path: dir, symlink: SymlinkWithinRoot}
+	for reqPath, want := range map[string][2]string{
+		"/packs/Show.S01.zip":              {"/packs/Show.S01.zip", "/"},
+		"/packs/Show.S01.zip/Show/E01.mkv": {"/packs/Show.S01.zip", "/Show/E01.mkv"},
+	} {
+		archivePath, memberPath, ok := root.splitArchive(reqPath)
+		if !ok || archivePath != want[0] || memberPath != want[1] {
+			t.Fatalf("split %s got %s %s %v", reqPath, archivePath, memberPath, ok)
+		}
+	}
+	for _, reqPath := range []string{"/packs", "/packs/dir.zip/a.mkv", "/packs/Other.zip/a.mkv"} {
+		if _, _, ok := root.splitArchive(reqPath); ok {
+			t.Fatalf("%s should not be archive", reqPath)
+		}
+	}
+	member := &archiveMember{offset: 100, size: 50}
+	if got := sliceURL("file:///mnt/Show.zip", member); got != "slice://100-150@file:///mnt/Show.zip" {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// symlink policy of local dir
+const (
+	SymlinkWithinRoot = "within_root" // follow symlink which target is in root dir
+	SymlinkFollowAll  = "follow_all"
+	SymlinkHide       = "hide"
+)
+
+var (
+	ErrOutsideRoot = errors.New("path is outside of root dir")
+
+	volumeRegexp = regexp.MustCompile(`^[A-Za-z]:`)
+)
+
+func parseSymlinkPolicy(policy string) (string, error) {
+	policy = strings.TrimSpace(policy)
+	switch policy {
+	case "":
+		return SymlinkWithinRoot, nil
+	case SymlinkWithinRoot, SymlinkFollowAll, SymlinkHide:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unsupported symlink policy %s", policy)
+}
+
+// cleanPath clean request path to "/a/b" which never walk out of root,
+// windows style path like C:\a is rejected
+func cleanPath(reqPath string) (string, error) {
+	reqPath = strings.ReplaceAll(reqPath, `\`, "/")
+	if volumeRegexp.MatchString(strings.TrimLeft(reqPath, "/")) {
+		return "", ErrOutsideRoot
+	}
+	return path.Clean("/" + reqPath), nil
+}
+
+// localRoot is root dir which confine all access
+type localRoot struct {
+	name     string // display name of top-level dir
+	hostPath string // dir path selected in host
+	path     string // root path in wasi fs
+	symlink  string // symlink policy
+}
+
+// resolve return path in wasi fs of request path,symlink is checked by policy
+func (r *localRoot) resolve(reqPath string) (string, error) {
+	cleanedPath, err := cleanPath(reqPath)
+	if err != nil {
+		return "", err
+	}
+	fullPath := filepath.Join(r.path, filepath.FromSlash(cleanedPath))
+	switch r.symlink {
+	case SymlinkFollowAll:
+		return fullPath, nil
+	case SymlinkHide:
+		// every element of path must not be symlink
+		elemPath := r.path
+		for _, elem := range strings.Split(strings.TrimPrefix(cleanedPath, "/"), "/") {
+			if elem == "" {
+				continue
+			}
+			elemPath = filepath.Join(elemPath, elem)
+			info, err := os.Lstat(elemPath)
+			if err != nil {
+				return "", err
+			}
+			if info.Mode()&fs.ModeSymlink != 0 {
+				return "", fs.ErrNotExist
+			}
+		}
+		return fullPath, nil
+	}
+	realRoot, err := filepath.EvalSymlinks(r.path)
+	if err != nil {
+		return "", err
+	}
+	realPath, err := filepath.EvalSymlinks(fullPath)
+	if err != nil {
+		return "", err
+	}
+	if !isSubPath(realRoot, realPath) {
+		return "", ErrOutsideRoot
+	}
+	return fullPath, nil
+}
+
+// stat return file info of entry in dir,symlink is followed by policy,
+// return false if entry should be hidden
+func (r *localRoot) stat(dirPath string, entry fs.DirEntry) (fs.FileInfo, bool) {
+	if entry.Type()&fs.ModeSymlink == 0 {
+		info, err := entry.Info()
+		return info, err == nil
+	}
+	if r.symlink == SymlinkHide {
+		return nil, false
+	}
+	entryPath, err := r.resolve(path.Join(dirPath, entry.Name()))
+	if err != nil {
+		return nil, false
+	}
+	info, err := os.Stat(entryPath)
+	return info, err == nil
+}
+
+func isSubPath(root, filePath string) bool {
+	rel, err := filepath.Rel(root, filePath)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanPath(t *testing.T) {
+	for reqPath, want := range map[string]string{
+		"":                 "/",
+		"/":                "/",
+		"/movies/a.mkv":    "/movies/a.mkv",
+		"/../../etc":       "/etc",
+		"../etc/passwd":    "/etc/passwd",
+		"/movies/../../..": "/",
+		`\movies\a.mkv`:    "/movies/a.mkv",
+		`\..\..\etc`:       "/etc",
+	} {
+		got, err := cleanPath(reqPath)
+		if err != nil {
+			t.Fatal(reqPath, err)
+		}
+		if got != want {
+			t.Fatalf("clean %s got %s,want %s", reqPath, got, want)
+		}
+	}
+	for _, reqPath := range []string{`C:\Windows`, "/c:/Windows", `D:`} {
+		_, err := cleanPath(reqPath)
+		if !errors.Is(err, ErrOutsideRoot) {
+			t.Fatalf("clean %s got err %v", reqPath, err)
+		}
+	}
+}
+
+func TestLocalRootSymlink(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{filepath.Join(root, "movies"), outside} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{filepath.Join(root, "movies", "a.mkv"), filepath.Join(outside, "secret.mkv")} {
+		if err := os.WriteFile(f, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlinks := map[string]string{
+		"inside":     filepath.Join(root, "movies"),
+		"escape":     outside,
+		"chain":      filepath.Join(root, "escape"),
+		"relescape":  "../outside",
+		"insidefile": filepath.Join("movies", "a.mkv"),
+	}
+	for name, target := range symlinks {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skip("symlink is not supported", err)
+		}
+	}
+
+	tests := []struct {
+		symlink string
+		reqPath string
+		err     error
+	}{
+		{SymlinkWithinRoot, "/movies/a.mkv", nil},
+		{SymlinkWithinRoot, "/../outside/secret.mkv", fs.ErrNotExist},
+		{SymlinkWithinRoot, "/inside/a.mkv", nil},
+		{SymlinkWithinRoot, "/insidefile", nil},
+		{SymlinkWithinRoot, "/escape/secret.mkv", ErrOutsideRoot},
+		{SymlinkWithinRoot, "/chain/secret.mkv", ErrOutsideRoot},
+		{SymlinkWithinRoot, "/relescape", ErrOutsideRoot},
+		{SymlinkFollowAll, "/chain/secret.mkv", nil},
+		{SymlinkFollowAll, "/relescape/secret.mkv", nil},
+		{SymlinkHide, "/movies/a.mkv", nil},
+		{SymlinkHide, "/inside/a.mkv", fs.ErrNotExist},
+		{SymlinkHide, "/escape", fs.ErrNotExist},
+	}
+	for _, test := range tests {
+		r := &localRoot{path: root, symlink: test.symlink}
+		realPath, err := r.resolve(test.reqPath)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s resolve %s got err %v,want %v", test.symlink, test.reqPath, err, test.err)
+		}
+		if err == nil {
+			if _, err := os.Stat(realPath); err != nil {
+				t.Fatalf("%s resolve %s got %s: %v", test.symlink, test.reqPath, realPath, err)
+			}
+		}
+	}
+
+	for symlink, want := range map[string]int{
+		SymlinkWithinRoot: 3, // movies inside insidefile
+		SymlinkFollowAll:  6,
+		SymlinkHide:       1,
+	} {
+		r := &localRoot{path: root, symlink: symlink}
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for _, entry := range entries {
+			if _, ok := r.stat("/", entry); ok {
+				count++
+			}
+		}
+		if count != want {
+			t.Fatalf("%s got %d entries,want %d", symlink, count, want)
+		}
+	}
+}
+
+func TestParseSymlinkPolicy(t *testing.T) {
+	policy, err := parseSymlinkPolicy("")
+	if err != nil || policy != SymlinkWithinRoot {
+		t.Fatal(policy, err)
+	}
+	_, err = parseSymlinkPolicy("always")
+	if err == nil {
+		t.Fatal("expect error")
+	}
+}
@@ -1,165 +1,435 @@
-//go:build wasip1
-
-package main
-
-import (
-	"crypto/md5"
-	"fmt"
-	"log/slog"
-	"os"
-	"path/filepath"
-	"strings"
-	"syscall"
-
-	"github.com/labulakalia/wazero_net/util"
-	"github.com/medianexapp/plugin_api/plugin"
-)
-
-/*
-NOTE: net and http use package
-"github.com/labulakalia/wazero_net/wasi/http"
-"github.com/labulakalia/wazero_net/wasi/net"
-*/
-
-type PluginImpl struct {
-	localpath *plugin.Formdata_FormItem_DirPathValue
-	uPath     string
-}
-
-func NewPluginImpl() *PluginImpl {
-	return &PluginImpl{
-		localpath: plugin.DirPath(""),
-	}
-}
-
-// Id implements IPlugin.
-func (p *PluginImpl) PluginId() (string, error) {
-	return "local", nil
-}
-
-// GetAuthType implements IPlugin.
-func (p *PluginImpl) GetAuth() (*plugin.Auth, error) {
-
-	formData := &plugin.AuthMethod_Formdata{
-		Formdata: &plugin.Formdata{
-			FormItems: []*plugin.Formdata_FormItem{
-				{
-					Name:  "Directory",
-					Value: p.localpath,
-				},
-			},
-		},
-	}
-
-	return &plugin.Auth{
-		AuthMethods: []*plugin.AuthMethod{&plugin.AuthMethod{Method: formData}},
-	}, nil
-}
-
-// CheckAuth implements IPlugin.
-func (p *PluginImpl) CheckAuthMethod(authMethod *plugin.AuthMethod) (authData *plugin.AuthData, err error) {
-	authDataBytes, err := authMethod.MarshalVT()
-	if err != nil {
-		return nil, err
-	}
-	authData = &plugin.AuthData{
-		AuthDataBytes: authDataBytes,
-	}
-	return authData, nil
-}
-
-// InitAuth implements IPlugin.
-func (p *PluginImpl) CheckAuthData(authData []byte) error {
-	authMethod := &plugin.AuthMethod{}
-	err := authMethod.UnmarshalVT(authData)
-	if err != nil {
-		return err
-	}
-	fmt.Println("check auth data", authMethod.Method.(*plugin.AuthMethod_Formdata))
-	dirPath := authMethod.Method.(*plugin.AuthMethod_Formdata).Formdata.FormItems[0].Value.(*plugin.Formdata_FormItem_DirPathValue)
-	p.localpath.DirPathValue = dirPath.DirPathValue
-	p.uPath = dirPath.DirPathValue.Value
-	if strings.Contains(p.uPath, ":") {
-		p.uPath = `/` + strings.ReplaceAll(strings.ReplaceAll(dirPath.DirPathValue.Value, ":", ""), `\`, "/")
-	}
-	_, err = os.Stat(p.uPath)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// AuthId implements IPlugin.
-func (p *PluginImpl) PluginAuthId() (string, error) {
-	return fmt.Sprintf("%x", md5.Sum(util.StringToBytes(&p.localpath.DirPathValue.Value))), nil
-}
-
-// GetDirEntry implements IPlugin.
-func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
-	dirPath := req.Path
-	page := req.Page
-	pageSize := req.PageSize
-
-	entries, err := os.ReadDir(filepath.Join(p.uPath, dirPath))
-	if err != nil {
-		return nil, err
-	}
-	dirEntry := &plugin.DirEntry{
-		FileEntries: []*plugin.FileEntry{},
-	}
-	start := int((page - 1) * pageSize)
-	end := start + int(pageSize)
-
-	if len(entries) <= start {
-		return dirEntry, nil
-	} else if len(entries) >= end {
-		entries = entries[start:end]
-	} else {
-		entries = entries[start:]
-	}
-	for _, entry := range entries {
-		fileEntry := &plugin.FileEntry{
-			Name: entry.Name(),
-		}
-		if entry.IsDir() {
-			fileEntry.FileType = plugin.FileEntry_FileTypeDir
-		} else {
-			fileEntry.FileType = plugin.FileEntry_FileTypeFile
-		}
-		fileInfo, err := entry.Info()
-		if err != nil {
-			slog.Error("Failed to get file info", "error", err)
-			continue
-		}
-		fileEntry.Size = uint64(fileInfo.Size())
-		stat, ok := fileInfo.Sys().(*syscall.Stat_t)
-		if ok {
-			fileEntry.AccessedTime = uint64(stat.Atim.Sec)
-			fileEntry.ModifiedTime = uint64(stat.Mtim.Sec)
-			fileEntry.CreatedTime = uint64(stat.Ctim.Sec)
-		}
-		dirEntry.FileEntries = append(dirEntry.FileEntries, fileEntry)
-	}
-	return dirEntry, nil
-}
-
-// GetFileResource implements IPlugin.
-func (p *PluginImpl) GetFileResource(req *plugin.GetFileResourceRequest) (*plugin.FileResource, error) {
-	statPath := filepath.Join(p.uPath, req.FilePath)
-	if strings.Contains(statPath, `\`) {
-		statPath = strings.ReplaceAll(statPath, `\`, `/`)
-	}
-	_, err := os.Stat(statPath)
-	if err != nil {
-		return nil, err
-	}
-	return &plugin.FileResource{
-		FileResourceData: []*plugin.FileResource_FileResourceData{
-			{
-				Url:          fmt.Sprintf("file://%s", filepath.Join(p.localpath.DirPathValue.Value, req.FilePath)),
-				ResourceType: plugin.FileResource_Video,
-				Resolution:   plugin.FileResource_Original,
-			},
-		},
-	}, nil
-}
+//go:build wasip1
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"plugins/util"
+	"strings"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+/*
+NOTE: net and http use package
+"github.com/labulakalia/wazero_net/wasi/http"
+"github.com/labulakalia/wazero_net/wasi/net"
+*/
+
+type PluginImpl struct {
+	localpath *plugin.Formdata_FormItem_DirPathValue
+	symlink   *plugin.Formdata_FormItem_StringValue
+	name      *plugin.Formdata_FormItem_StringValue
+	showDisc  *plugin.Formdata_FormItem_BoolValue
+	// dir picker of more roots,host grant access of selected dir
+	dirs     []*plugin.Formdata_FormItem_DirPathValue
+	dirNames []*plugin.Formdata_FormItem_StringValue
+	roots    []*localRoot
+	changes  util.ChangeFeed
+}
+
+// moreDirPickers is count of dir picker after first directory
+const moreDirPickers = 3
+
+func NewPluginImpl() *PluginImpl {
+	p := &PluginImpl{
+		localpath: plugin.DirPath(""),
+		symlink:   plugin.String(SymlinkWithinRoot),
+		name:      plugin.String(""),
+		showDisc:  plugin.Bool(false),
+	}
+	for range moreDirPickers {
+		p.dirs = append(p.dirs, plugin.DirPath(""))
+		p.dirNames = append(p.dirNames, plugin.String(""))
+	}
+	return p
+}
+
+// Id implements IPlugin.
+func (p *PluginImpl) PluginId() (string, error) {
+	return "local", nil
+}
+
+// dirPickerName is name of form item of more dir picker
+func dirPickerName(i int) string {
+	return fmt.Sprintf("Directory %d(optional)", i+2)
+}
+
+// dirNameName is name of form item of name of more dir picker
+func dirNameName(i int) string {
+	return fmt.Sprintf("Directory %d Name(optional)", i+2)
+}
+
+// GetAuthType implements IPlugin.
+func (p *PluginImpl) GetAuth() (*plugin.Auth, error) {
+
+	formData := &plugin.AuthMethod_Formdata{
+		Formdata: &plugin.Formdata{
+			FormItems: []*plugin.Formdata_FormItem{
+				{
+					Name:  "Directory",
+					Value: p.localpath,
+				},
+				{
+					Name:  "Symlink(within_root/follow_all/hide)",
+					Value: p.symlink,
+				},
+				{
+					Name:  "Directory Name(optional)",
+					Value: p.name,
+				},
+				{
+					Name:  "Show Disc Folder(BDMV/VIDEO_TS)",
+					Value: p.showDisc,
+				},
+			},
+		},
+	}
+	for i := range moreDirPickers {
+		formData.Formdata.FormItems = append(formData.Formdata.FormItems, &plugin.Formdata_FormItem{
+			Name:  dirPickerName(i),
+			Value: p.dirs[i],
+		}, &plugin.Formdata_FormItem{
+			Name:  dirNameName(i),
+			Value: p.dirNames[i],
+		})
+	}
+
+	return &plugin.Auth{
+		AuthMethods: []*plugin.AuthMethod{&plugin.AuthMethod{Method: formData}},
+	}, nil
+}
+
+// CheckAuth implements IPlugin.
+func (p *PluginImpl) CheckAuthMethod(authMethod *plugin.AuthMethod) (authData *plugin.AuthData, err error) {
+	authDataBytes, err := authMethod.MarshalVT()
+	if err != nil {
+		return nil, err
+	}
+	authData = &plugin.AuthData{
+		AuthDataBytes: authDataBytes,
+	}
+	return authData, nil
+}
+
+// InitAuth implements IPlugin.
+func (p *PluginImpl) CheckAuthData(authData []byte) error {
+	authMethod := &plugin.AuthMethod{}
+	err := authMethod.UnmarshalVT(authData)
+	if err != nil {
+		return err
+	}
+	fmt.Println("check auth data", authMethod.Method.(*plugin.AuthMethod_Formdata))
+	formItems := authMethod.Method.(*plugin.AuthMethod_Formdata).Formdata.FormItems
+	dirPath := formItems[0].Value.(*plugin.Formdata_FormItem_DirPathValue)
+	p.localpath.DirPathValue = dirPath.DirPathValue
+	// item is found by name,so auth data of old version with other items is loaded
+	legacyDirs := ""
+	for _, item := range formItems[1:] {
+		switch value := item.Value.(type) {
+		case *plugin.Formdata_FormItem_StringValue:
+			switch {
+			case strings.HasPrefix(item.Name, "Symlink"):
+				p.symlink.StringValue = value.StringValue
+			case item.Name == "Directory Name(optional)":
+				p.name.StringValue = value.StringValue
+			case strings.HasPrefix(item.Name, "More Directories"):
+				// text of more directories of old version,directory is added by dir picker now
+				legacyDirs = value.StringValue.GetValue()
+			}
+			for i := range moreDirPickers {
+				if item.Name == dirNameName(i) {
+					p.dirNames[i].StringValue = value.StringValue
+				}
+			}
+		case *plugin.Formdata_FormItem_DirPathValue:
+			for i := range moreDirPickers {
+				if item.Name == dirPickerName(i) {
+					p.dirs[i].DirPathValue = value.DirPathValue
+				}
+			}
+		case *plugin.Formdata_FormItem_BoolValue:
+			p.showDisc.BoolValue = value.BoolValue
+		}
+	}
+	symlink, err := parseSymlinkPolicy(p.symlink.StringValue.GetValue())
+	if err != nil {
+		return err
+	}
+	roots := []*localRoot{newLocalRoot(p.name.StringValue.GetValue(), dirPath.DirPathValue.GetValue(), symlink)}
+	for i, dir := range p.dirs {
+		if dir.DirPathValue.GetValue() != "" {
+			roots = append(roots, newLocalRoot(p.dirNames[i].StringValue.GetValue(), dir.DirPathValue.GetValue(), symlink))
+		}
+	}
+	roots = append(roots, parseRoots(legacyDirs, symlink)...)
+	p.roots = uniqueRootNames(roots)
+	for _, root := range p.roots {
+		_, err = os.Stat(root.path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AuthId implements IPlugin.
+func (p *PluginImpl) PluginAuthId() (string, error) {
+	return rootsAuthId(p.roots), nil
+}
+
+// GetDirEntry implements IPlugin.
+func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	dirPath := req.Path
+	page := req.Page
+	pageSize := req.PageSize
+	if util.IsChangesPath(req) {
+		return p.changes.DirEntry(req, util.ListDir(p.GetDirEntry), nil)
+	}
+	if dirEntry, ok, err := util.PlaylistDirEntry(dirPath, page, pageSize, p.readFile, p.isFile); ok {
+		return dirEntry, err
+	}
+
+	root, dirPath, err := locateRoot(p.roots, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+	}
+	if root == nil {
+		// list roots as top-level dir
+		for _, root := range p.roots {
+			fileEntry := &plugin.FileEntry{
+				Name:     root.name,
+				FileType: plugin.FileEntry_FileTypeDir,
+			}
+			fileInfo, err := os.Stat(root.path)
+			if err != nil {
+				slog.Error("stat root failed", "path", root.path, "err", err)
+				continue
+			}
+			setFileTime(fileEntry, fileInfo)
+			dirEntry.FileEntries = append(dirEntry.FileEntries, fileEntry)
+		}
+		return dirEntry, nil
+	}
+	if archivePath, memberPath, ok := root.splitArchive(dirPath); ok {
+		return getArchiveDirEntry(root, archivePath, memberPath, page, pageSize)
+	}
+	realPath, err := root.resolve(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(realPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range util.PageSlice(entries, page, pageSize) {
+		fileInfo, ok := root.stat(dirPath, entry)
+		if !ok {
+			slog.Debug("skip file", "dir", dirPath, "name", entry.Name())
+			continue
+		}
+		fileEntry := &plugin.FileEntry{
+			Name: entry.Name(),
+		}
+		// archive is list as dir
+		if fileInfo.IsDir() || (fileInfo.Mode().IsRegular() && isArchive(entry.Name())) {
+			fileEntry.FileType = plugin.FileEntry_FileTypeDir
+		} else {
+			fileEntry.FileType = plugin.FileEntry_FileTypeFile
+		}
+		fileEntry.Size = uint64(fileInfo.Size())
+		setFileTime(fileEntry, fileInfo)
+		fileEntry.FileType = util.LinkFileEntryType(fileEntry.Name, fileEntry.FileType)
+		dirEntry.FileEntries = append(dirEntry.FileEntries, fileEntry)
+	}
+	if !p.showDisc.BoolValue.GetValue() {
+		dirEntry.FileEntries = util.DiscEntries(req.Path, dirEntry.FileEntries)
+	}
+	return dirEntry, nil
+}
+
+// GetFileResource implements IPlugin.
+func (p *PluginImpl) GetFileResource(req *plugin.GetFileResourceRequest) (*plugin.FileResource, error) {
+	if target, isPath, ok, err := util.ResolveLinkFile(req.FilePath, p.readFile, p.isFile); ok {
+		if err != nil {
+			return nil, err
+		}
+		if isPath {
+			return p.GetFileResource(&plugin.GetFileResourceRequest{FilePath: target})
+		}
+		return util.URLFileResource(target), nil
+	}
+	files, ok, err := util.DiscMainFeature(req.FilePath, util.ListDir(p.GetDirEntry), p.readFile)
+	if ok {
+		if err != nil {
+			return nil, err
+		}
+		urls := make([]string, 0, len(files))
+		for _, file := range files {
+			root, filePath, err := locateRoot(p.roots, file)
+			if err != nil {
+				return nil, err
+			}
+			urls = append(urls, root.hostURL(filePath))
+		}
+		return &plugin.FileResource{
+			FileResourceData: []*plugin.FileResource_FileResourceData{
+				{
+					Url:          util.DiscURL(urls),
+					ResourceType: plugin.FileResource_Video,
+					Resolution:   plugin.FileResource_Original,
+				},
+			},
+		}, nil
+	}
+	root, filePath, err := locateRoot(p.roots, req.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, fmt.Errorf("%s is not file", req.FilePath)
+	}
+	if archivePath, memberPath, ok := root.splitArchive(filePath); ok {
+		return getArchiveFileResource(root, archivePath, memberPath)
+	}
+	statPath, err := root.resolve(filePath)
+	if err != nil {
+		return nil, err
+	}
+	_, err = os.Stat(statPath)
+	if err != nil {
+		return nil, err
+	}
+	url := root.hostURL(filePath)
+	if util.IsIso(filePath) {
+		url, err = util.IsoDiscURL(url, root.hostFilePath(filePath), func() (io.ReadCloser, error) {
+			return os.Open(statPath)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &plugin.FileResource{
+		FileResourceData: []*plugin.FileResource_FileResourceData{
+			{
+				Url:          url,
+				ResourceType: plugin.FileResource_Video,
+				Resolution:   plugin.FileResource_Original,
+			},
+		},
+	}, nil
+}
+
+func getArchiveDirEntry(root *localRoot, archivePath, memberPath string, page, pageSize uint64) (*plugin.DirEntry, error) {
+	realPath, err := root.resolve(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	members, err := readArchive(realPath)
+	if err != nil {
+		return nil, err
+	}
+	if memberPath != "/" {
+		member, err := findArchiveMember(members, memberPath)
+		if err != nil {
+			return nil, err
+		}
+		if !member.isDir {
+			return nil, fmt.Errorf("%s is not dir", memberPath)
+		}
+	}
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+	}
+	for _, member := range util.PageSlice(listArchiveDir(members, memberPath), page, pageSize) {
+		fileEntry := &plugin.FileEntry{
+			Name:         path.Base(member.name),
+			FileType:     plugin.FileEntry_FileTypeFile,
+			Size:         uint64(member.size),
+			ModifiedTime: uint64(member.modTime.Unix()),
+			AccessedTime: uint64(member.modTime.Unix()),
+			CreatedTime:  uint64(member.modTime.Unix()),
+		}
+		if member.isDir {
+			fileEntry.FileType = plugin.FileEntry_FileTypeDir
+		}
+		if member.modTime.IsZero() {
+			fileEntry.ModifiedTime, fileEntry.AccessedTime, fileEntry.CreatedTime = 0, 0, 0
+		}
+		dirEntry.FileEntries = append(dirEntry.FileEntries, fileEntry)
+	}
+	return dirEntry, nil
+}
+
+func getArchiveFileResource(root *localRoot, archivePath, memberPath string) (*plugin.FileResource, error) {
+	realPath, err := root.resolve(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	members, err := readArchive(realPath)
+	if err != nil {
+		return nil, err
+	}
+	member, err := findArchiveMember(members, memberPath)
+	if err != nil {
+		return nil, err
+	}
+	if member.isDir {
+		return nil, fmt.Errorf("%s is dir", memberPath)
+	}
+	if member.offset < 0 {
+		return nil, ErrArchiveMemberCompressed
+	}
+	return &plugin.FileResource{
+		FileResourceData: []*plugin.FileResource_FileResourceData{
+			{
+				Url:          sliceURL(root.hostURL(archivePath), member),
+				ResourceType: plugin.FileResource_Video,
+				Resolution:   plugin.FileResource_Original,
+				Size:         uint64(member.size),
+			},
+		},
+	}, nil
+}
+
+// isFile check path is regular file
+func (p *PluginImpl) isFile(filePath string) bool {
+	root, filePath, err := locateRoot(p.roots, filePath)
+	if err != nil || root == nil {
+		return false
+	}
+	realPath, err := root.resolve(filePath)
+	if err != nil {
+		return false
+	}
+	fileInfo, err := os.Stat(realPath)
+	return err == nil && fileInfo.Mode().IsRegular()
+}
+
+// readFile read small file like .strm and playlist
+func (p *PluginImpl) readFile(filePath string, maxSize int64) ([]byte, error) {
+	root, filePath, err := locateRoot(p.roots, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, fmt.Errorf("%s is not file", filePath)
+	}
+	realPath, err := root.resolve(filePath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(realPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return util.ReadLimit(f, maxSize)
+}
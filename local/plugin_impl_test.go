@@ -0,0 +1,65 @@
+//go:build wasip1
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+func TestCheckAuthData(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"movies", "tv", "music"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := NewPluginImpl()
+	auth, err := p.GetAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	formItems := auth.AuthMethods[0].Method.(*plugin.AuthMethod_Formdata).Formdata.FormItems
+	formItems[0].Value = plugin.DirPath(filepath.Join(dir, "movies"))
+	for _, item := range formItems {
+		switch item.Name {
+		case dirPickerName(1):
+			item.Value = plugin.DirPath(filepath.Join(dir, "tv"))
+		case dirNameName(1):
+			item.Value = plugin.String("TV")
+		}
+	}
+	checkRoots(t, formItems, "movies", "TV")
+
+	// auth data of old version has text of more directories
+	checkRoots(t, []*plugin.Formdata_FormItem{
+		{Name: "Directory", Value: plugin.DirPath(filepath.Join(dir, "movies"))},
+		{Name: "Symlink(within_root/follow_all/hide)", Value: plugin.String(SymlinkWithinRoot)},
+		{Name: "Directory Name(optional)", Value: plugin.String("Movies")},
+		{Name: "More Directories(name=path or path,one per line)", Value: plugin.String("Music=" + filepath.Join(dir, "music"))},
+		{Name: "Show Disc Folder(BDMV/VIDEO_TS)", Value: plugin.Bool(true)},
+	}, "Movies", "Music")
+}
+
+func checkRoots(t *testing.T, formItems []*plugin.Formdata_FormItem, names ...string) {
+	t.Helper()
+	authData, err := (&plugin.AuthMethod{Method: &plugin.AuthMethod_Formdata{Formdata: &plugin.Formdata{FormItems: formItems}}}).MarshalVT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPluginImpl()
+	if err = p.CheckAuthData(authData); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.roots) != len(names) {
+		t.Fatalf("unexpected roots %+v", p.roots)
+	}
+	for i, root := range p.roots {
+		if root.name != names[i] {
+			t.Fatalf("unexpected root name %s,want %s", root.name, names[i])
+		}
+	}
+}
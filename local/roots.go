@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// newLocalRoot create root of dir path which is selected in host,
+// windows path C:\a is mounted as /C/a in wasi fs
+func newLocalRoot(name, hostPath, symlink string) *localRoot {
+	rootPath := hostPath
+	if strings.Contains(rootPath, ":") {
+		rootPath = `/` + strings.ReplaceAll(strings.ReplaceAll(hostPath, ":", ""), `\`, "/")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = path.Base(strings.ReplaceAll(rootPath, `\`, "/"))
+	}
+	return &localRoot{
+		name:     strings.ReplaceAll(name, "/", "_"),
+		hostPath: hostPath,
+		path:     rootPath,
+		symlink:  symlink,
+	}
+}
+
+// parseRoots parse text of more directories stored by old version,one per line,like
+// Movies=/mnt/movies
+// /mnt/tv
+// text before "=" is name only if it is not a path,so path like /mnt/a=b is kept
+func parseRoots(more string, symlink string) []*localRoot {
+	roots := []*localRoot{}
+	for _, line := range strings.Split(more, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name := ""
+		// windows path like C:\a has no "=" before path
+		if i := strings.Index(line, "="); i >= 0 && !strings.ContainsAny(line[:i], `/\`) {
+			name, line = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		roots = append(roots, newLocalRoot(name, line, symlink))
+	}
+	return roots
+}
+
+// uniqueRootNames remove root of same host path and add suffix to same name,
+// suffix is parent dir name or hash of host path,so it not depend on order of roots
+func uniqueRootNames(roots []*localRoot) []*localRoot {
+	uniqueRoots := []*localRoot{}
+	hostPaths := map[string]bool{}
+	for _, root := range roots {
+		if hostPaths[root.hostPath] {
+			continue
+		}
+		hostPaths[root.hostPath] = true
+		uniqueRoots = append(uniqueRoots, root)
+	}
+	suffixes := []func(root *localRoot) string{
+		func(root *localRoot) string {
+			return path.Base(path.Dir(strings.ReplaceAll(root.path, `\`, "/")))
+		},
+		func(root *localRoot) string {
+			return fmt.Sprintf("%x", md5.Sum([]byte(root.hostPath)))[:8]
+		},
+	}
+	for _, suffix := range suffixes {
+		names := map[string]int{}
+		for _, root := range uniqueRoots {
+			names[root.name]++
+		}
+		for _, root := range uniqueRoots {
+			if names[root.name] > 1 {
+				root.name = fmt.Sprintf("%s (%s)", root.name, suffix(root))
+			}
+		}
+	}
+	return uniqueRoots
+}
+
+// rootsAuthId generate auth id by sorted dir paths,so reorder dirs not change it,
+// auth id of one dir is same as old version
+func rootsAuthId(roots []*localRoot) string {
+	hostPaths := make([]string, 0, len(roots))
+	for _, root := range roots {
+		hostPaths = append(hostPaths, root.hostPath)
+	}
+	sort.Strings(hostPaths)
+	return fmt.Sprintf("%x", md5.Sum([]byte(strings.Join(hostPaths, "\n"))))
+}
+
+// locateRoot find root of request path,one root is mounted at "/",
+// multiple roots are mounted at "/<name>",root is nil for "/" of multiple roots
+func locateRoot(roots []*localRoot, reqPath string) (*localRoot, string, error) {
+	cleanedPath, err := cleanPath(reqPath)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(roots) == 1 {
+		return roots[0], cleanedPath, nil
+	}
+	if cleanedPath == "/" {
+		return nil, cleanedPath, nil
+	}
+	name, rel, _ := strings.Cut(strings.TrimPrefix(cleanedPath, "/"), "/")
+	for _, root := range roots {
+		if root.name == name {
+			return root, "/" + rel, nil
+		}
+	}
+	return nil, "", fmt.Errorf("%s not exist", reqPath)
+}
+
+// hostFilePath return path in host of path in root
+func (r *localRoot) hostFilePath(filePath string) string {
+	return filepath.Join(r.hostPath, filePath)
+}
+
+// hostURL return file url of path in root
+func (r *localRoot) hostURL(filePath string) string {
+	return fmt.Sprintf("file://%s", r.hostFilePath(filePath))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"testing"
+)
+
+func TestParseRoots(t *testing.T) {
+	roots := append([]*localRoot{newLocalRoot("", "/mnt/movies", SymlinkWithinRoot)},
+		parseRoots("TV=/mnt/tv\n\n /media/disk \nMovies=/media/movies\nWin=C:\\Videos\n/mnt/a=b\n/mnt/tv", SymlinkHide)...)
+	roots = uniqueRootNames(roots)
+	want := []localRoot{
+		{name: "movies", hostPath: "/mnt/movies", path: "/mnt/movies", symlink: SymlinkWithinRoot},
+		{name: "TV", hostPath: "/mnt/tv", path: "/mnt/tv", symlink: SymlinkHide},
+		{name: "disk", hostPath: "/media/disk", path: "/media/disk", symlink: SymlinkHide},
+		{name: "Movies", hostPath: "/media/movies", path: "/media/movies", symlink: SymlinkHide},
+		{name: "Win", hostPath: `C:\Videos`, path: "/C/Videos", symlink: SymlinkHide},
+		{name: "a=b", hostPath: "/mnt/a=b", path: "/mnt/a=b", symlink: SymlinkHide},
+	}
+	if len(roots) != len(want) {
+		t.Fatalf("unexpected roots %+v", roots)
+	}
+	for i, root := range roots {
+		if *root != want[i] {
+			t.Fatalf("unexpected root %+v,want %+v", root, want[i])
+		}
+	}
+
+	roots = uniqueRootNames(parseRoots("/a/movies\n/b/movies\n/c/movies", SymlinkWithinRoot))
+	reordered := uniqueRootNames(parseRoots("/c/movies\n/a/movies\n/b/movies", SymlinkWithinRoot))
+	for i, name := range []string{"movies (a)", "movies (b)", "movies (c)"} {
+		if roots[i].name != name || reordered[(i+1)%3].name != name {
+			t.Fatalf("unexpected root name %s,%s,want %s", roots[i].name, reordered[(i+1)%3].name, name)
+		}
+	}
+	roots = uniqueRootNames(parseRoots("/a/x/movies\n/b/x/movies", SymlinkWithinRoot))
+	if roots[0].name == roots[1].name {
+		t.Fatalf("unexpected same root name %s", roots[0].name)
+	}
+}
+
+func TestRootsAuthId(t *testing.T) {
+	roots := parseRoots("/mnt/movies", SymlinkWithinRoot)
+	if rootsAuthId(roots) != fmt.Sprintf("%x", md5.Sum([]byte("/mnt/movies"))) {
+		t.Fatal("auth id of one dir changed")
+	}
+	a := rootsAuthId(parseRoots("/mnt/movies\nTV=/mnt/tv", SymlinkWithinRoot))
+	b := rootsAuthId(parseRoots("Shows=/mnt/tv\n/mnt/movies", SymlinkHide))
+	if a != b {
+		t.Fatal("auth id changed after reorder")
+	}
+}
+
+func TestLocateRoot(t *testing.T) {
+	one := parseRoots("/mnt/movies", SymlinkWithinRoot)
+	root, rel, err := locateRoot(one, "/movies/a.mkv")
+	if err != nil || root != one[0] || rel != "/movies/a.mkv" {
+		t.Fatal(root, rel, err)
+	}
+
+	multi := parseRoots("/mnt/movies\nTV=/mnt/tv", SymlinkWithinRoot)
+	root, rel, err = locateRoot(multi, "/")
+	if err != nil || root != nil || rel != "/" {
+		t.Fatal(root, rel, err)
+	}
+	root, rel, err = locateRoot(multi, "/TV/Show/S01E01.mkv")
+	if err != nil || root != multi[1] || rel != "/Show/S01E01.mkv" {
+		t.Fatal(root, rel, err)
+	}
+	root, rel, err = locateRoot(multi, "/../movies/../TV")
+	if err != nil || root != multi[1] || rel != "/" {
+		t.Fatal(root, rel, err)
+	}
+	_, _, err = locateRoot(multi, "/other/a.mkv")
+	if err == nil {
+		t.Fatal("expect error of unknown root")
+	}
+	if multi[1].hostURL("/Show/S01E01.mkv") != "file:///mnt/tv/Show/S01E01.mkv" {
+		t.Fatal(multi[1].hostURL("/Show/S01E01.mkv"))
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"unicode/utf16"
+)
+
+// 7z property id
+const (
+	sevenZipEnd                   = 0x00
+	sevenZipHeader                = 0x01
+	sevenZipArchiveProperties     = 0x02
+	sevenZipAdditionalStreamsInfo = 0x03
+	sevenZipMainStreamsInfo       = 0x04
+	sevenZipFilesInfo             = 0x05
+	sevenZipPackInfo              = 0x06
+	sevenZipUnpackInfo            = 0x07
+	sevenZipSubStreamsInfo        = 0x08
+	sevenZipSize                  = 0x09
+	sevenZipCRC                   = 0x0A
+	sevenZipFolder                = 0x0B
+	sevenZipCodersUnpackSize      = 0x0C
+	sevenZipNumUnpackStream       = 0x0D
+	sevenZipEmptyStream           = 0x0E
+	sevenZipEmptyFile             = 0x0F
+	sevenZipName                  = 0x11
+	sevenZipMTime                 = 0x14
+	sevenZipEncodedHeader         = 0x17
+
+	sevenZipStartHeaderSize = 32
+	sevenZipMaxHeaderSize   = 64 << 20
+)
+
+var (
+	sevenZipSignature = []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}
+	// coder id of copy method
+	sevenZipCopyCoder = []byte{0x00}
+
+	ErrSevenZipEncodedHeader = errors.New("7z archive with compressed header(default of 7-Zip) is not supported,create it by 7z a -mx0 -mhc=off")
+)
+
+type sevenZipFolderInfo struct {
+	copy          bool
+	numPacked     int
+	mainOut       int
+	unpackSize    uint64
+	crcDefined    bool
+	subStreams    int
+	subStreamSize []uint64
+}
+
+type sevenZipArchive struct {
+	packPos   uint64
+	packSizes []uint64
+	folders   []*sevenZipFolderInfo
+}
+
+// sevenZipReader read 7z header,error is kept and all read return zero after error
+type sevenZipReader struct {
+	buf []byte
+	err error
+}
+
+func (r *sevenZipReader) bytes(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.buf)) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *sevenZipReader) byte() byte {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+// number read 7z variable length number
+func (r *sevenZipReader) number() uint64 {
+	first := r.byte()
+	mask := byte(0x80)
+	value := uint64(0)
+	for i := 0; i < 8; i++ {
+		if first&mask == 0 {
+			return value | uint64(first&(mask-1))<<(8*i)
+		}
+		value |= uint64(r.byte()) << (8 * i)
+		mask >>= 1
+	}
+	return value
+}
+
+func (r *sevenZipReader) int(max int) int {
+	n := r.number()
+	if r.err == nil && n > uint64(max) {
+		r.err = fmt.Errorf("invalid 7z number %d", n)
+	}
+	return int(n)
+}
+
+func (r *sevenZipReader) expect(id byte) {
+	if got := r.byte(); r.err == nil && got != id {
+		r.err = fmt.Errorf("unexpected 7z property %#x,want %#x", got, id)
+	}
+}
+
+// bits read bit vector,first item is the highest bit
+func (r *sevenZipReader) bits(n int) []bool {
+	bits := make([]bool, n)
+	b := r.bytes(uint64((n + 7) / 8))
+	if b == nil {
+		return bits
+	}
+	for i := range bits {
+		bits[i] = b[i/8]&(0x80>>(i%8)) != 0
+	}
+	return bits
+}
+
+func (r *sevenZipReader) definedBits(n int) []bool {
+	if r.byte() != 0 {
+		bits := make([]bool, n)
+		for i := range bits {
+			bits[i] = true
+		}
+		return bits
+	}
+	return r.bits(n)
+}
+
+func (r *sevenZipReader) digests(n int) []bool {
+	defined := r.definedBits(n)
+	for _, d := range defined {
+		if d {
+			r.bytes(4)
+		}
+	}
+	return defined
+}
+
+func (r *sevenZipReader) packInfo(archive *sevenZipArchive) {
+	archive.packPos = r.number()
+	numPackStreams := r.int(len(r.buf))
+	for r.err == nil {
+		switch id := r.byte(); id {
+		case sevenZipEnd:
+			return
+		case sevenZipSize:
+			archive.packSizes = make([]uint64, numPackStreams)
+			for i := range archive.packSizes {
+				archive.packSizes[i] = r.number()
+			}
+		case sevenZipCRC:
+			r.digests(numPackStreams)
+		default:
+			r.err = fmt.Errorf("unexpected 7z pack info property %#x", id)
+		}
+	}
+}
+
+func (r *sevenZipReader) folder() *sevenZipFolderInfo {
+	folder := &sevenZipFolderInfo{subStreams: 1}
+	numCoders := r.int(64)
+	totalIn, totalOut := 0, 0
+	for i := 0; i < numCoders && r.err == nil; i++ {
+		flag := r.byte()
+		coderId := r.bytes(uint64(flag & 0x0F))
+		numIn, numOut := 1, 1
+		if flag&0x10 != 0 {
+			numIn, numOut = r.int(64), r.int(64)
+		}
+		if flag&0x20 != 0 {
+			r.bytes(r.number())
+		}
+		totalIn += numIn
+		totalOut += numOut
+		folder.copy = numCoders == 1 && bytes.Equal(coderId, sevenZipCopyCoder)
+	}
+	numBindPairs := totalOut - 1
+	boundOut := map[uint64]bool{}
+	for i := 0; i < numBindPairs; i++ {
+		r.number()
+		boundOut[r.number()] = true
+	}
+	folder.numPacked = totalIn - numBindPairs
+	if folder.numPacked > 1 {
+		for i := 0; i < folder.numPacked; i++ {
+			r.number()
+		}
+	}
+	// out stream which is not bound is the final unpack stream
+	for i := 0; i < totalOut; i++ {
+		if !boundOut[uint64(i)] {
+			folder.mainOut = i
+			break
+		}
+	}
+	folder.subStreamSize = make([]uint64, totalOut)
+	return folder
+}
+
+func (r *sevenZipReader) unpackInfo(archive *sevenZipArchive) {
+	r.expect(sevenZipFolder)
+	numFolders := r.int(len(r.buf))
+	if r.byte() != 0 {
+		r.err = errors.New("external 7z folders is not supported")
+	}
+	for i := 0; i < numFolders && r.err == nil; i++ {
+		archive.folders = append(archive.folders, r.folder())
+	}
+	r.expect(sevenZipCodersUnpackSize)
+	for _, folder := range archive.folders {
+		for i := range folder.subStreamSize {
+			size := r.number()
+			if i == folder.mainOut {
+				folder.unpackSize = size
+			}
+		}
+	}
+	for r.err == nil {
+		switch id := r.byte(); id {
+		case sevenZipEnd:
+			return
+		case sevenZipCRC:
+			for i, defined := range r.digests(len(archive.folders)) {
+				archive.folders[i].crcDefined = defined
+			}
+		default:
+			r.err = fmt.Errorf("unexpected 7z unpack info property %#x", id)
+		}
+	}
+}
+
+func (r *sevenZipReader) subStreamsInfo(archive *sevenZipArchive) {
+	for r.err == nil {
+		switch id := r.byte(); id {
+		case sevenZipEnd:
+			return
+		case sevenZipNumUnpackStream:
+			for _, folder := range archive.folders {
+				folder.subStreams = r.int(len(r.buf))
+				folder.subStreamSize = make([]uint64, folder.subStreams)
+				if folder.subStreams > 0 {
+					folder.subStreamSize[0] = folder.unpackSize
+				}
+			}
+		case sevenZipSize:
+			for _, folder := range archive.folders {
+				if folder.subStreams == 0 {
+					continue
+				}
+				sum := uint64(0)
+				for i := 0; i < folder.subStreams-1; i++ {
+					folder.subStreamSize[i] = r.number()
+					// sum of sub streams can not be larger than folder,size of the last one would be negative
+					if folder.subStreamSize[i] > folder.unpackSize-sum {
+						r.err = fmt.Errorf("7z sub streams size is larger than folder size %d", folder.unpackSize)
+						return
+					}
+					sum += folder.subStreamSize[i]
+				}
+				folder.subStreamSize[folder.subStreams-1] = folder.unpackSize - sum
+			}
+		case sevenZipCRC:
+			numDigests := 0
+			for _, folder := range archive.folders {
+				if folder.subStreams != 1 || !folder.crcDefined {
+					numDigests += folder.subStreams
+				}
+			}
+			r.digests(numDigests)
+		default:
+			r.err = fmt.Errorf("unexpected 7z sub streams info property %#x", id)
+		}
+	}
+}
+
+func (r *sevenZipReader) streamsInfo(archive *sevenZipArchive) {
+	for r.err == nil {
+		switch id := r.byte(); id {
+		case sevenZipEnd:
+			return
+		case sevenZipPackInfo:
+			r.packInfo(archive)
+		case sevenZipUnpackInfo:
+			r.unpackInfo(archive)
+			for _, folder := range archive.folders {
+				folder.subStreamSize = []uint64{folder.unpackSize}
+			}
+		case sevenZipSubStreamsInfo:
+			r.subStreamsInfo(archive)
+		default:
+			r.err = fmt.Errorf("unexpected 7z streams info property %#x", id)
+		}
+	}
+}
+
+func (r *sevenZipReader) names(numFiles int) []string {
+	if r.byte() != 0 {
+		r.err = errors.New("external 7z names is not supported")
+		return nil
+	}
+	data := r.bytes(uint64(len(r.buf)))
+	names := make([]string, 0, numFiles)
+	name := []uint16{}
+	for i := 0; i+1 < len(data); i += 2 {
+		c := binary.LittleEndian.Uint16(data[i:])
+		if c == 0 {
+			names = append(names, string(utf16.Decode(name)))
+			name = name[:0]
+			continue
+		}
+		name = append(name, c)
+	}
+	if len(names) != numFiles {
+		r.err = errors.New("invalid 7z names")
+	}
+	return names
+}
+
+func (r *sevenZipReader) mtimes(numFiles int) []time.Time {
+	defined := r.definedBits(numFiles)
+	if r.byte() != 0 {
+		r.err = errors.New("external 7z times is not supported")
+		return nil
+	}
+	mtimes := make([]time.Time, numFiles)
+	for i := range mtimes {
+		if !defined[i] {
+			continue
+		}
+		b := r.bytes(8)
+		if b == nil {
+			return nil
+		}
+		// windows FILETIME,100ns since 1601
+		filetime := int64(binary.LittleEndian.Uint64(b)) - 116444736000000000
+		mtimes[i] = time.Unix(filetime/1e7, filetime%1e7*100)
+	}
+	return mtimes
+}
+
+func (r *sevenZipReader) filesInfo(archive *sevenZipArchive) []*archiveMember {
+	numFiles := r.int(len(r.buf))
+	emptyStream := make([]bool, numFiles)
+	var emptyFile []bool
+	var names []string
+	var mtimes []time.Time
+	for r.err == nil {
+		propType := r.byte()
+		if propType == sevenZipEnd {
+			break
+		}
+		prop := &sevenZipReader{buf: r.bytes(r.number())}
+		switch propType {
+		case sevenZipEmptyStream:
+			emptyStream = prop.bits(numFiles)
+		case sevenZipEmptyFile:
+			numEmptyStreams := 0
+			for _, empty := range emptyStream {
+				if empty {
+					numEmptyStreams++
+				}
+			}
+			emptyFile = prop.bits(numEmptyStreams)
+		case sevenZipName:
+			names = prop.names(numFiles)
+		case sevenZipMTime:
+			mtimes = prop.mtimes(numFiles)
+		}
+		if r.err == nil {
+			r.err = prop.err
+		}
+	}
+	if r.err != nil {
+		return nil
+	}
+	if names == nil {
+		r.err = errors.New("7z archive has no names")
+		return nil
+	}
+
+	members := []*archiveMember{}
+	folderIndex, subStreamIndex, packIndex, emptyIndex := 0, 0, 0, 0
+	folderOffset := uint64(0)
+	for i := 0; i < numFiles; i++ {
+		member := &archiveMember{
+			name:   cleanMemberName(names[i]),
+			offset: -1,
+		}
+		if mtimes != nil {
+			member.modTime = mtimes[i]
+		}
+		if emptyStream[i] {
+			member.isDir = emptyIndex >= len(emptyFile) || !emptyFile[emptyIndex]
+			emptyIndex++
+		} else {
+			// skip folder without stream
+			for folderIndex < len(archive.folders) && subStreamIndex >= archive.folders[folderIndex].subStreams {
+				packIndex += archive.folders[folderIndex].numPacked
+				folderIndex++
+				subStreamIndex = 0
+				folderOffset = 0
+			}
+			if folderIndex >= len(archive.folders) {
+				r.err = errors.New("invalid 7z streams")
+				return nil
+			}
+			folder := archive.folders[folderIndex]
+			member.size = int64(folder.subStreamSize[subStreamIndex])
+			if folder.copy && packIndex < len(archive.packSizes) {
+				packOffset := sevenZipStartHeaderSize + archive.packPos
+				for _, packSize := range archive.packSizes[:packIndex] {
+					packOffset += packSize
+				}
+				member.offset = int64(packOffset + folderOffset)
+			}
+			folderOffset += folder.subStreamSize[subStreamIndex]
+			subStreamIndex++
+		}
+		if member.name != "" {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// readSevenZip read members of 7z archive,only member of copy method can stream,
+// header must not be compressed
+func readSevenZip(f *os.File) ([]*archiveMember, error) {
+	startHeader := make([]byte, sevenZipStartHeaderSize)
+	_, err := io.ReadFull(f, startHeader)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(startHeader[:len(sevenZipSignature)], sevenZipSignature) {
+		return nil, errors.New("invalid 7z signature")
+	}
+	nextHeaderOffset := binary.LittleEndian.Uint64(startHeader[12:20])
+	nextHeaderSize := binary.LittleEndian.Uint64(startHeader[20:28])
+	if nextHeaderSize == 0 {
+		return []*archiveMember{}, nil
+	}
+	if nextHeaderSize > sevenZipMaxHeaderSize {
+		return nil, fmt.Errorf("7z header is too large %d", nextHeaderSize)
+	}
+	header := make([]byte, nextHeaderSize)
+	_, err = f.ReadAt(header, int64(sevenZipStartHeaderSize+nextHeaderOffset))
+	if err != nil {
+		return nil, err
+	}
+	r := &sevenZipReader{buf: header}
+	switch id := r.byte(); id {
+	case sevenZipHeader:
+	case sevenZipEncodedHeader:
+		return nil, ErrSevenZipEncodedHeader
+	default:
+		return nil, fmt.Errorf("unexpected 7z header %#x", id)
+	}
+	archive := &sevenZipArchive{}
+	members := []*archiveMember{}
+	for r.err == nil {
+		switch id := r.byte(); id {
+		case sevenZipEnd:
+			return members, nil
+		case sevenZipArchiveProperties:
+			for r.err == nil && r.byte() != 0 {
+				r.bytes(r.number())
+			}
+		case sevenZipAdditionalStreamsInfo:
+			r.err = errors.New("7z additional streams is not supported")
+		case sevenZipMainStreamsInfo:
+			r.streamsInfo(archive)
+		case sevenZipFilesInfo:
+			members = r.filesInfo(archive)
+		default:
+			r.err = fmt.Errorf("unexpected 7z header property %#x", id)
+		}
+	}
+	return nil, r.err
+}
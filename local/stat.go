@@ -0,0 +1,25 @@
+//go:build wasip1
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+// setFileTime set times of wasi filestat,wasi has no birth time of file so created time is modified time,
+// ctime is inode change time which is changed by chmod and rename so it is not used
+func setFileTime(fileEntry *plugin.FileEntry, fileInfo os.FileInfo) {
+	modTime := uint64(fileInfo.ModTime().Unix())
+	fileEntry.AccessedTime, fileEntry.ModifiedTime, fileEntry.CreatedTime = modTime, modTime, modTime
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	fileEntry.AccessedTime = stat.Atime / uint64(time.Second)
+	fileEntry.ModifiedTime = stat.Mtime / uint64(time.Second)
+	fileEntry.CreatedTime = fileEntry.ModifiedTime
+}
@@ -0,0 +1,45 @@
+//go:build wasip1
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+// fakeFileInfo return fixed stat from Sys
+type fakeFileInfo struct {
+	os.FileInfo
+	modTime time.Time
+	sys     any
+}
+
+func (f *fakeFileInfo) ModTime() time.Time {
+	return f.modTime
+}
+
+func (f *fakeFileInfo) Sys() any {
+	return f.sys
+}
+
+func TestSetFileTime(t *testing.T) {
+	fileEntry := &plugin.FileEntry{}
+	setFileTime(fileEntry, &fakeFileInfo{sys: &syscall.Stat_t{
+		Atime: 300e9,
+		Mtime: 100e9 + 999,
+		Ctime: 200e9,
+	}})
+	if fileEntry.AccessedTime != 300 || fileEntry.ModifiedTime != 100 || fileEntry.CreatedTime != 100 {
+		t.Fatalf("unexpected times %+v", fileEntry)
+	}
+
+	fileEntry = &plugin.FileEntry{}
+	setFileTime(fileEntry, &fakeFileInfo{modTime: time.Unix(400, 0)})
+	if fileEntry.AccessedTime != 400 || fileEntry.ModifiedTime != 400 || fileEntry.CreatedTime != 400 {
+		t.Fatalf("unexpected times %+v", fileEntry)
+	}
+}
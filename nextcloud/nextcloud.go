@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"plugins/util"
+	"plugins/util/webdav"
+	"strings"
+)
+
+const (
+	// loginFlowUserAgent is shown as app name in nextcloud security settings
+	loginFlowUserAgent = "Medianex"
+	previewSize        = 512
+	searchLimit        = 100
+)
+
+var ErrLoginFlowPending = errors.New("login in browser is not finished")
+
+// loginFlow is login flow v2 of nextcloud,user grant app password in browser and plugin poll it
+type loginFlow struct {
+	Poll struct {
+		Token    string `json:"token"`
+		Endpoint string `json:"endpoint"`
+	} `json:"poll"`
+	Login string `json:"login"`
+}
+
+// loginCredential is app password of login flow
+type loginCredential struct {
+	Server      string `json:"server"`
+	LoginName   string `json:"loginName"`
+	AppPassword string `json:"appPassword"`
+}
+
+// account is user of server which login by app password
+type account struct {
+	server      string
+	loginName   string
+	appPassword string
+	userId      string
+}
+
+// normalizeServer trim path of dav and index.php in server url which user paste
+func normalizeServer(server string) string {
+	server = strings.TrimSpace(server)
+	if server == "" {
+		return ""
+	}
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	for _, suffix := range []string{"/remote.php", "/index.php"} {
+		if i := strings.Index(server, suffix); i >= 0 {
+			server = server[:i]
+		}
+	}
+	return strings.TrimRight(server, "/")
+}
+
+// davRoot return webdav root of user files
+func davRoot(server, userId string) string {
+	return fmt.Sprintf("%s/remote.php/dav/files/%s", server, url.PathEscape(userId))
+}
+
+// previewURL return url of preview image which is requested with header of file
+func previewURL(server, fileId string) string {
+	u := url.Values{}
+	u.Set("fileId", fileId)
+	u.Set("x", fmt.Sprint(previewSize))
+	u.Set("y", fmt.Sprint(previewSize))
+	u.Set("a", "true")
+	return fmt.Sprintf("%s/index.php/core/preview?%s", server, u.Encode())
+}
+
+func readResponse(resp *http.Response, data any) error {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed,status %d,%s", resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, data)
+}
+
+// startLoginFlow start login flow v2,user open login url to grant access
+func startLoginFlow(do func(*http.Request) (*http.Response, error), server string) (*loginFlow, error) {
+	req, err := http.NewRequest(http.MethodPost, server+"/index.php/login/v2", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", loginFlowUserAgent)
+	resp, err := do(req)
+	if err != nil {
+		return nil, err
+	}
+	flow := &loginFlow{}
+	if err := readResponse(resp, flow); err != nil {
+		return nil, err
+	}
+	if flow.Login == "" || flow.Poll.Token == "" || flow.Poll.Endpoint == "" {
+		return nil, errors.New("invalid login flow response")
+	}
+	return flow, nil
+}
+
+// pollLoginFlow return credential if user grant access,nil if user not finish login
+func pollLoginFlow(do func(*http.Request) (*http.Response, error), flow *loginFlow) (*loginCredential, error) {
+	form := url.Values{}
+	form.Set("token", flow.Poll.Token)
+	req, err := http.NewRequest(http.MethodPost, flow.Poll.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := do(req)
+	if err != nil {
+		return nil, err
+	}
+	// poll endpoint return 404 until user grant access
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, nil
+	}
+	credential := &loginCredential{}
+	if err := readResponse(resp, credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// fetchUserId return user id of login name by ocs api,login name may be email which is not in dav path
+func fetchUserId(do func(*http.Request) (*http.Response, error), acc *account) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, acc.server+"/ocs/v1.php/cloud/user?format=json", nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(acc.loginName, acc.appPassword)
+	req.Header.Set("OCS-APIRequest", "true")
+	req.Header.Set("Accept", "application/json")
+	resp, err := do(req)
+	if err != nil {
+		return "", err
+	}
+	userResp := &struct {
+		Ocs struct {
+			Data struct {
+				Id string `json:"id"`
+			} `json:"data"`
+		} `json:"ocs"`
+	}{}
+	if err := readResponse(resp, userResp); err != nil {
+		return "", err
+	}
+	if userResp.Ocs.Data.Id == "" {
+		return "", errors.New("user id not found")
+	}
+	return userResp.Ocs.Data.Id, nil
+}
+
+// searchBody is basicsearch of files which name contains keyword
+func searchBody(userId, keyword string) string {
+	escape := func(s string) string {
+		b := &strings.Builder{}
+		xml.EscapeText(b, []byte(s))
+		return b.String()
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<d:searchrequest xmlns:d="DAV:" xmlns:oc="http://owncloud.org/ns" xmlns:nc="http://nextcloud.org/ns">
+	<d:basicsearch>
+		<d:select>
+			<d:prop>
+				<d:displayname/>
+				<d:resourcetype/>
+				<d:getcontentlength/>
+				<d:getcontenttype/>
+				<d:getetag/>
+				<d:getlastmodified/>
+				<d:creationdate/>
+				<oc:fileid/>
+				<nc:has-preview/>
+			</d:prop>
+		</d:select>
+		<d:from>
+			<d:scope>
+				<d:href>/files/%s</d:href>
+				<d:depth>infinity</d:depth>
+			</d:scope>
+		</d:from>
+		<d:where>
+			<d:like>
+				<d:prop><d:displayname/></d:prop>
+				<d:literal>%%%s%%</d:literal>
+			</d:like>
+		</d:where>
+		<d:orderby/>
+		<d:limit>
+			<d:nresults>%d</d:nresults>
+		</d:limit>
+	</d:basicsearch>
+</d:searchrequest>`, escape(userId), escape(keyword), searchLimit)
+}
+
+// search file by webdav SEARCH of nextcloud,path of result is relative to dav root
+func search(do func(*http.Request) (*http.Response, error), acc *account, query *util.SearchQuery) ([]*webdav.Resource, error) {
+	body := searchBody(acc.userId, query.Keyword)
+	req, err := http.NewRequest("SEARCH", acc.server+"/remote.php/dav/", strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(acc.loginName, acc.appPassword)
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	resp, err := do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("search failed,status %d,%s", resp.StatusCode, data)
+	}
+	resources, err := webdav.ParseMultistatus(data)
+	if err != nil {
+		return nil, err
+	}
+	rootPath := "/remote.php/dav/files/" + acc.userId
+	if u, err := url.Parse(acc.server); err == nil {
+		rootPath = u.Path + rootPath
+	}
+	results := make([]*webdav.Resource, 0, len(resources))
+	for _, resource := range resources {
+		filePath := strings.TrimSuffix(strings.TrimPrefix(resource.Href, rootPath), "/")
+		if filePath == "" || filePath == resource.Href || !query.MatchCategory(resource.Name, resource.IsDir) {
+			continue
+		}
+		resource.RawData.Path = filePath
+		results = append(results, resource)
+	}
+	return results, nil
+}
@@ -0,0 +1,311 @@
+//go:build wasip1
+
+package main
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"plugins/util"
+	"plugins/util/webdav"
+	"strings"
+	"time"
+
+	_ "github.com/labulakalia/wazero_net/wasi/http"
+	"github.com/medianexapp/gowebdav"
+	"github.com/medianexapp/plugin_api/httpclient"
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+// login flow token is valid for 20 minutes
+const loginFlowExpire = 20 * time.Minute
+
+type PluginImpl struct {
+	nextcloudAuth *nextcloudAuth
+
+	account    *account
+	driver     *webdav.Driver
+	httpclient *httpclient.Client
+	// loginFlow is login flow started when callback or qrcode is chosen,
+	// GetAuth offer its url so page render never start login flow
+	loginFlow *loginFlowParam
+}
+
+func NewPluginImpl() *PluginImpl {
+	return &PluginImpl{
+		nextcloudAuth: &nextcloudAuth{
+			Server:         plugin.String(""),
+			User:           plugin.String(""),
+			AppPassword:    plugin.ObscureString(""),
+			ShowDiscFolder: plugin.Bool(false),
+		},
+		httpclient: httpclient.NewClient(httpclient.WithTimeout(10 * time.Second)),
+	}
+}
+
+type nextcloudAuth struct {
+	Server         *plugin.Formdata_FormItem_StringValue
+	User           *plugin.Formdata_FormItem_StringValue
+	AppPassword    *plugin.Formdata_FormItem_ObscureStringValue
+	ShowDiscFolder *plugin.Formdata_FormItem_BoolValue
+}
+
+// loginFlowParam is param of qrcode and callback to poll login flow
+type loginFlowParam struct {
+	Server string     `json:"server"`
+	Flow   *loginFlow `json:"flow"`
+	// ExpireTime is unix time when token of login flow expire
+	ExpireTime uint64 `json:"expireTime"`
+}
+
+func (l *loginFlowParam) expired() bool {
+	return uint64(time.Now().Unix()) >= l.ExpireTime
+}
+
+// Id implements IPlugin.
+func (p *PluginImpl) PluginId() (string, error) {
+	return "nextcloud", nil
+}
+
+func (p *PluginImpl) formdata() *plugin.Formdata {
+	return &plugin.Formdata{
+		FormItems: []*plugin.Formdata_FormItem{
+			{
+				Name:  "Server(like https://cloud.example.com)",
+				Value: p.nextcloudAuth.Server,
+			},
+			{
+				Name:  "User",
+				Value: p.nextcloudAuth.User,
+			},
+			{
+				Name:  "App Password(or login by browser and qrcode)",
+				Value: p.nextcloudAuth.AppPassword,
+			},
+			{
+				Name:  "Show Disc Folder(BDMV/VIDEO_TS)",
+				Value: p.nextcloudAuth.ShowDiscFolder,
+			},
+		},
+	}
+}
+
+// GetAuth return form to input app password,browser and qrcode of login flow,
+// login flow is started when browser or qrcode is chosen,not when auth page is shown
+func (p *PluginImpl) GetAuth() (*plugin.Auth, error) {
+	flowParam := &loginFlowParam{Server: p.nextcloudAuth.Server.StringValue.Value}
+	loginURL := ""
+	if p.loginFlow != nil && !p.loginFlow.expired() {
+		flowParam = p.loginFlow
+		loginURL = p.loginFlow.Flow.Login
+	}
+	param, err := json.Marshal(flowParam)
+	if err != nil {
+		return nil, err
+	}
+	return &plugin.Auth{
+		AuthMethods: []*plugin.AuthMethod{
+			{
+				Method: &plugin.AuthMethod_Formdata{
+					Formdata: p.formdata(),
+				},
+			},
+			{
+				Method: &plugin.AuthMethod_Callback{
+					Callback: &plugin.Callback{
+						CallbackUrl:      loginURL,
+						CallbackUrlParam: string(param),
+					},
+				},
+			},
+			{
+				Method: &plugin.AuthMethod_Scanqrcode{
+					Scanqrcode: &plugin.Scanqrcode{
+						QrcodeImageParam:   string(param),
+						QrcodeImageContent: loginURL,
+						QrcodeExpireTime:   flowParam.ExpireTime,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// CheckAuthMethod implements IPlugin.
+func (p *PluginImpl) CheckAuthMethod(authMethod *plugin.AuthMethod) (*plugin.AuthData, error) {
+	var (
+		credential *loginCredential
+		err        error
+	)
+	switch v := authMethod.Method.(type) {
+	case *plugin.AuthMethod_Formdata:
+		p.unmarshalFormData(v.Formdata)
+		if p.nextcloudAuth.AppPassword.ObscureStringValue.Value == "" {
+			return nil, errors.New("app password is empty,login by browser or qrcode")
+		}
+		credential = &loginCredential{
+			Server:      p.nextcloudAuth.Server.StringValue.Value,
+			LoginName:   p.nextcloudAuth.User.StringValue.Value,
+			AppPassword: p.nextcloudAuth.AppPassword.ObscureStringValue.Value,
+		}
+	case *plugin.AuthMethod_Scanqrcode:
+		credential, err = p.loginFlowCredential(v.Scanqrcode.QrcodeImageParam)
+	case *plugin.AuthMethod_Callback:
+		credential, err = p.loginFlowCredential(v.Callback.CallbackUrlParam)
+	default:
+		return nil, fmt.Errorf("unsupport %+v", v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil {
+		return nil, nil
+	}
+	p.loginFlow = nil
+
+	p.nextcloudAuth.Server.StringValue.Value = normalizeServer(credential.Server)
+	p.nextcloudAuth.User.StringValue.Value = credential.LoginName
+	p.nextcloudAuth.AppPassword.ObscureStringValue.Value = credential.AppPassword
+	authDataBytes, err := p.formdata().MarshalVT()
+	if err != nil {
+		return nil, err
+	}
+	return &plugin.AuthData{
+		AuthDataBytes: authDataBytes,
+	}, nil
+}
+
+// loginFlowCredential start login flow of qrcode and callback when it is chosen,
+// then poll it,return nil if user not finish login
+func (p *PluginImpl) loginFlowCredential(param string) (*loginCredential, error) {
+	flowParam := &loginFlowParam{}
+	if param != "" {
+		if err := json.Unmarshal([]byte(param), flowParam); err != nil {
+			return nil, err
+		}
+	}
+	server := normalizeServer(flowParam.Server)
+	if server == "" {
+		server = p.nextcloudAuth.Server.StringValue.Value
+	}
+	// param of auth page rendered before login flow started has no flow
+	if flowParam.Flow == nil && p.loginFlow != nil && p.loginFlow.Server == server {
+		flowParam = p.loginFlow
+	}
+	if flowParam.Flow == nil || flowParam.expired() {
+		if server == "" {
+			return nil, errors.New("server is empty,input server in form")
+		}
+		flow, err := startLoginFlow(p.httpclient.Do, server)
+		if err != nil {
+			return nil, err
+		}
+		p.loginFlow = &loginFlowParam{
+			Server:     server,
+			Flow:       flow,
+			ExpireTime: uint64(time.Now().Add(loginFlowExpire).Unix()),
+		}
+		return nil, fmt.Errorf("%w,open %s or scan qrcode to login", ErrLoginFlowPending, flow.Login)
+	}
+	credential, err := pollLoginFlow(p.httpclient.Do, flowParam.Flow)
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil {
+		slog.Debug("login flow not finish", "server", flowParam.Server)
+	}
+	return credential, nil
+}
+
+func (p *PluginImpl) unmarshalFormData(formData *plugin.Formdata) {
+	server := formData.FormItems[0].Value.(*plugin.Formdata_FormItem_StringValue).StringValue.Value
+	p.nextcloudAuth.Server.StringValue.Value = normalizeServer(server)
+	p.nextcloudAuth.User.StringValue.Value = strings.TrimSpace(formData.FormItems[1].Value.(*plugin.Formdata_FormItem_StringValue).StringValue.Value)
+	p.nextcloudAuth.AppPassword.ObscureStringValue.Value = formData.FormItems[2].Value.(*plugin.Formdata_FormItem_ObscureStringValue).ObscureStringValue.Value
+	p.nextcloudAuth.ShowDiscFolder.BoolValue = formData.FormItems[3].Value.(*plugin.Formdata_FormItem_BoolValue).BoolValue
+}
+
+// CheckAuthData derive dav root by user id of login name
+func (p *PluginImpl) CheckAuthData(authData []byte) error {
+	formData := &plugin.Formdata{}
+	err := formData.UnmarshalVT(authData)
+	if err != nil {
+		return err
+	}
+	p.unmarshalFormData(formData)
+	acc := &account{
+		server:      p.nextcloudAuth.Server.StringValue.Value,
+		loginName:   p.nextcloudAuth.User.StringValue.Value,
+		appPassword: p.nextcloudAuth.AppPassword.ObscureStringValue.Value,
+	}
+	acc.userId, err = fetchUserId(p.httpclient.Do, acc)
+	if err != nil {
+		slog.Error("get user id failed", "err", err, "server", acc.server)
+		return err
+	}
+	authorizer, err := webdav.NewAuthorizer(webdav.AuthTypeBasic, acc.loginName, acc.appPassword)
+	if err != nil {
+		return err
+	}
+	p.account = acc
+	p.driver = webdav.NewDriver(gowebdav.NewAuthClient(davRoot(acc.server, acc.userId), authorizer), p.httpclient.Do)
+	p.driver.ShowDiscFolder = p.nextcloudAuth.ShowDiscFolder.BoolValue.GetValue()
+	p.driver.PreviewURL = func(rawData *webdav.RawData) string {
+		return previewURL(acc.server, rawData.FileId)
+	}
+	_, err = p.driver.Client.Stat("/")
+	return err
+}
+
+// PluginAuthId implements IPlugin.
+func (p *PluginImpl) PluginAuthId() (string, error) {
+	id := p.nextcloudAuth.Server.StringValue.Value + p.nextcloudAuth.User.StringValue.Value
+	return fmt.Sprintf("%x", md5.Sum([]byte(id))), nil
+}
+
+// GetDirEntry implements IPlugin.
+func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	if util.IsSearchPath(req.Path) && webdav.RealPath(req.Path, req.FileEntry) == req.Path {
+		return p.search(req)
+	}
+	dirEntry, err := p.driver.GetDirEntry(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Path == "/" && req.Page == 1 {
+		dirEntry.FileEntries = append(dirEntry.FileEntries, util.SearchFileEntry())
+	}
+	return dirEntry, nil
+}
+
+// search file by "/search/<keyword>",result name is path of file
+func (p *PluginImpl) search(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+	}
+	if req.Path == util.SearchDir || req.Page > 1 {
+		return dirEntry, nil
+	}
+	query, err := util.ParseSearchQuery(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := search(p.driver.Do, p.account, query)
+	if err != nil {
+		return nil, err
+	}
+	for _, resource := range resources {
+		fileEntry := resource.FileEntry()
+		fileEntry.Name = strings.TrimPrefix(resource.RawData.Path, "/")
+		fileEntry.FileType = util.LinkFileEntryType(fileEntry.Name, fileEntry.FileType)
+		dirEntry.FileEntries = append(dirEntry.FileEntries, fileEntry)
+	}
+	return dirEntry, nil
+}
+
+// GetFileResource implements IPlugin.
+func (p *PluginImpl) GetFileResource(req *plugin.GetFileResourceRequest) (*plugin.FileResource, error) {
+	return p.driver.GetFileResource(req)
+}
@@ -0,0 +1,50 @@
+//go:build wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+func TestGetAuth(t *testing.T) {
+	p := NewPluginImpl()
+	p.nextcloudAuth.Server.StringValue.Value = "https://cloud.example.com"
+	auth, err := p.GetAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(auth.AuthMethods) != 3 {
+		t.Fatalf("unexpected auth methods %v", auth.AuthMethods)
+	}
+	if p.loginFlow != nil {
+		t.Fatal("login flow is started by auth page")
+	}
+	callback := auth.AuthMethods[1].Method.(*plugin.AuthMethod_Callback).Callback
+	flowParam := &loginFlowParam{}
+	if err := json.Unmarshal([]byte(callback.CallbackUrlParam), flowParam); err != nil {
+		t.Fatal(err)
+	}
+	if callback.CallbackUrl != "" || flowParam.Server != "https://cloud.example.com" || flowParam.Flow != nil {
+		t.Fatalf("unexpected callback %v", callback)
+	}
+	if _, ok := auth.AuthMethods[2].Method.(*plugin.AuthMethod_Scanqrcode); !ok {
+		t.Fatalf("unexpected auth method %v", auth.AuthMethods[2])
+	}
+}
+
+func TestCheckAuthMethod(t *testing.T) {
+	p := NewPluginImpl()
+	auth, err := p.GetAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.CheckAuthMethod(auth.AuthMethods[0]); err == nil {
+		t.Fatal("form with empty app password is accepted")
+	}
+	if _, err := p.CheckAuthMethod(auth.AuthMethods[1]); err == nil || p.loginFlow != nil {
+		t.Fatalf("login flow without server return %v", err)
+	}
+}
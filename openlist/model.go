@@ -1,10 +1,16 @@
 package main
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
 
 type AuthLogin struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	OtpCode  string `json:"otp_code"`
 }
 
 type Response struct {
@@ -13,6 +19,16 @@ type Response struct {
 	Data    any    `json:"data"`
 }
 
+// ResponseError is error of response code not 200
+type ResponseError struct {
+	Code    int
+	Message string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%s(%d)", e.Message, e.Code)
+}
+
 type TokenData struct {
 	Token string `json:"token"`
 }
@@ -27,6 +43,7 @@ type FsListReq struct {
 type FsListResp struct {
 	Total    int       `json:"total"`
 	Contents []Content `json:"content"`
+	Provider string    `json:"provider"`
 }
 
 type Content struct {
@@ -35,13 +52,85 @@ type Content struct {
 	IsDir    bool      `json:"is_dir"`
 	Modified time.Time `json:"modified"`
 	Created  time.Time `json:"created"`
+	Sign     string    `json:"sign"`
 
-	RawUrl string `json:"raw_url"`
+	RawUrl   string `json:"raw_url"`
+	Provider string `json:"provider"`
 }
 
 type FsGetReq struct {
-	Path string
+	Path     string `json:"path"`
+	Password string `json:"password"`
 }
 type FsGetResp struct {
 	Path string
 }
+
+// /api/fs/search
+type FsSearchReq struct {
+	Parent   string `json:"parent"`
+	Keywords string `json:"keywords"`
+	Scope    int    `json:"scope"` // 0 all,1 dir,2 file
+	Page     int64  `json:"page"`
+	PerPage  int64  `json:"per_page"`
+	Password string `json:"password"`
+}
+
+type FsSearchResp struct {
+	Total    int             `json:"total"`
+	Contents []SearchContent `json:"content"`
+}
+
+type SearchContent struct {
+	Parent string `json:"parent"`
+	Name   string `json:"name"`
+	IsDir  bool   `json:"is_dir"`
+	Size   int64  `json:"size"`
+}
+
+// FileRawData is raw data of file entry,store real path of file
+type FileRawData struct {
+	Path     string `json:"path"`
+	Sign     string `json:"sign,omitempty"`
+	Provider string `json:"provider,omitempty"` // empty if not get from fs list
+}
+
+// /api/fs/other
+type FsOtherReq struct {
+	Path     string `json:"path"`
+	Method   string `json:"method"` // video_preview
+	Password string `json:"password"`
+}
+
+// video_preview of aliyundrive storage
+type VideoPreviewResp struct {
+	VideoPreviewPlayInfo struct {
+		LiveTranscodingTaskList []struct {
+			TemplateId string `json:"template_id"`
+			Status     string `json:"status"`
+			Url        string `json:"url"`
+		} `json:"live_transcoding_task_list"`
+		LiveTranscodingSubtitleTaskList []struct {
+			Language string `json:"language"`
+			Status   string `json:"status"`
+			Url      string `json:"url"`
+		} `json:"live_transcoding_subtitle_task_list"`
+	} `json:"video_preview_play_info"`
+}
+
+// storage provider support video_preview
+var videoPreviewProviders = map[string]bool{
+	"AliyundriveOpen": true,
+	"Aliyundrive":     true,
+	"115 Cloud":       true,
+	"115 Open":        true,
+}
+
+var templateResolutionMap = map[string]plugin.FileResource_Resolution{
+	"LD":  plugin.FileResource_LD,
+	"SD":  plugin.FileResource_SD,
+	"HD":  plugin.FileResource_HD,
+	"FHD": plugin.FileResource_FHD,
+	"QHD": plugin.FileResource_QHD,
+	"UHD": plugin.FileResource_UHD,
+}
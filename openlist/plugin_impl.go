@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"path"
+	"plugins/util"
+	"strings"
 	"time"
 
 	"github.com/medianexapp/plugin_api/httpclient"
@@ -29,8 +34,24 @@ type AuthData struct {
 	Password     string
 	TokenExpired int64
 	Token        string
+	// path -> password of password-protected folder
+	FolderPasswords map[string]string
+	// account has two factor auth,login again need otp code
+	Otp bool `json:",omitempty"`
+	// Version is version of auth data format,auth data without it is stored by old version
+	// which auth id is md5 of whole auth data
+	Version int
+	// auth id of old version,keep it so stored account is not changed
+	LegacyAuthId string `json:",omitempty"`
 }
 
+const authDataVersion = 1
+
+// openlist return 402 if otp code of login is invalid
+const codeInvalidOtp = 402
+
+var ErrOtpReauthenticate = errors.New("account has two factor auth,re-authenticate with otp code")
+
 func NewPluginImpl() *PluginImpl {
 	slog.SetLogLoggerLevel(slog.LevelDebug)
 	return &PluginImpl{
@@ -40,6 +61,7 @@ func NewPluginImpl() *PluginImpl {
 }
 
 // Id implements IPlugin.
+// accounts are stored by plugin id,it is kept as alist after plugin is renamed to openlist
 func (p *PluginImpl) PluginId() (string, error) {
 	return "alist", nil
 }
@@ -71,6 +93,14 @@ func (p *PluginImpl) GetAuth() (*plugin.Auth, error) {
 								Name:  "Default Token Expired(H)",
 								Value: plugin.Int64(48),
 							},
+							{
+								Name:  "OTP Code",
+								Value: plugin.String(""),
+							},
+							{
+								Name:  "Folder Passwords(/path=password,one per line)",
+								Value: plugin.String(""),
+							},
 						},
 					},
 				},
@@ -90,8 +120,9 @@ func (p *PluginImpl) request(method string, uri string, reqData, respData any) e
 		fmt.Println(string(data))
 		body = bytes.NewReader(data)
 	}
-	slog.Debug("alist request", "req", reqData, "url", fmt.Sprintf("%s%s", p.authData.Addr, uri))
-	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", p.authData.Addr, uri), body)
+	reqURL := fmt.Sprintf("%s%s", strings.TrimSuffix(p.authData.Addr, "/"), uri)
+	slog.Debug("alist request", "req", reqData, "url", reqURL)
+	req, err := http.NewRequest(method, reqURL, body)
 	if err != nil {
 		return err
 	}
@@ -118,41 +149,106 @@ func (p *PluginImpl) request(method string, uri string, reqData, respData any) e
 		return err
 	}
 	if resp.Code != 200 {
-		return fmt.Errorf("%s", resp.Message)
+		return &ResponseError{Code: resp.Code, Message: resp.Message}
 	}
 	return nil
 }
 
+// requestWithPassword retry request with folder password if path is forbidden
+func (p *PluginImpl) requestWithPassword(filePath string, request func(password string) error) error {
+	err := request("")
+	responseErr := &ResponseError{}
+	if !errors.As(err, &responseErr) || responseErr.Code != http.StatusForbidden {
+		return err
+	}
+	password, ok := p.folderPassword(filePath)
+	if !ok {
+		return err
+	}
+	slog.Debug("retry request with folder password", "path", filePath)
+	return request(password)
+}
+
+// folderPassword return password of nearest password-protected parent folder
+func (p *PluginImpl) folderPassword(filePath string) (string, bool) {
+	for dir := filePath; ; dir = path.Dir(dir) {
+		if password, ok := p.authData.FolderPasswords[dir]; ok {
+			return password, true
+		}
+		if dir == "/" || dir == "." {
+			return "", false
+		}
+	}
+}
+
+// parseFolderPasswords parse "/path=password" line by line
+func parseFolderPasswords(data string) map[string]string {
+	folderPasswords := map[string]string{}
+	for _, line := range strings.Split(data, "\n") {
+		dir, password, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || dir == "" {
+			continue
+		}
+		folderPasswords[path.Clean("/"+strings.TrimSpace(dir))] = password
+	}
+	return folderPasswords
+}
+
 // CheckAuthMethod check auth is finished and return authDataBytes and authData's expired time
 // if authmethod's type is *plugin.AuthMethod_Refresh,you need to refresh token
 // assert authMethod.Method's type to check auth is finished,return auth data and expired time if authed
 func (p *PluginImpl) CheckAuthMethod(authMethod *plugin.AuthMethod) (*plugin.AuthData, error) {
 	slog.Debug("CheckAuthMethod", "authMethod", authMethod)
+	otpCode := ""
 	switch data := authMethod.Method.(type) {
 	case *plugin.AuthMethod_Refresh:
+		// login again with stored credentials
+		err := p.loadAuthData(data.Refresh.AuthData.AuthDataBytes)
+		if err != nil {
+			return nil, err
+		}
+		if p.authData.Otp {
+			return nil, ErrOtpReauthenticate
+		}
 	case *plugin.AuthMethod_Formdata:
 		forms := data.Formdata.FormItems
 		p.authData.Addr = forms[0].Value.(*plugin.Formdata_FormItem_StringValue).StringValue.Value
 		p.authData.Username = forms[1].Value.(*plugin.Formdata_FormItem_StringValue).StringValue.Value
 		p.authData.Password = forms[2].Value.(*plugin.Formdata_FormItem_ObscureStringValue).ObscureStringValue.Value
 		p.authData.TokenExpired = forms[3].Value.(*plugin.Formdata_FormItem_Int64Value).Int64Value.Value
+		if len(forms) > 5 {
+			otpCode = forms[4].Value.(*plugin.Formdata_FormItem_StringValue).StringValue.Value
+			p.authData.FolderPasswords = parseFolderPasswords(forms[5].Value.(*plugin.Formdata_FormItem_StringValue).StringValue.Value)
+		}
+		p.authData.Otp = otpCode != ""
+	default:
+		return nil, fmt.Errorf("unsupport %+v", data)
 	}
+	// token of old login is invalid to login
+	p.authData.Token = ""
 	authResp := &TokenData{}
 	err := p.request(http.MethodPost, "/api/auth/login", &AuthLogin{
 		Username: p.authData.Username,
 		Password: p.authData.Password,
+		OtpCode:  otpCode,
 	}, authResp)
+	responseErr := &ResponseError{}
+	if errors.As(err, &responseErr) && responseErr.Code == codeInvalidOtp && otpCode == "" {
+		// otp is enabled after login
+		return nil, ErrOtpReauthenticate
+	}
 	if err != nil {
 		return nil, err
 	}
 	p.authData.Token = authResp.Token
+	p.authData.Version = authDataVersion
 	authData, err := json.Marshal(p.authData)
 	if err != nil {
 		return nil, err
 	}
 	return &plugin.AuthData{
 		AuthDataBytes:       authData,
-		AuthDataExpiredTime: uint64(time.Hour * time.Duration(p.authData.TokenExpired)),
+		AuthDataExpiredTime: uint64(time.Now().Add(time.Hour * time.Duration(p.authData.TokenExpired)).Unix()),
 	}, nil
 }
 
@@ -160,7 +256,7 @@ func (p *PluginImpl) CheckAuthMethod(authMethod *plugin.AuthMethod) (*plugin.Aut
 // you must store auth data to *PluginImpl
 func (p *PluginImpl) CheckAuthData(authDataBytes []byte) error {
 	slog.Debug("CheckAuthData", "authDataBytes", authDataBytes)
-	err := json.Unmarshal(authDataBytes, p.authData)
+	err := p.loadAuthData(authDataBytes)
 	if err != nil {
 		return err
 	}
@@ -171,14 +267,30 @@ func (p *PluginImpl) CheckAuthData(authDataBytes []byte) error {
 	return err
 }
 
+// loadAuthData unmarshal stored auth data,auth data of old version
+// remember its auth id to keep the account which host stored
+func (p *PluginImpl) loadAuthData(authDataBytes []byte) error {
+	authData := &AuthData{}
+	err := json.Unmarshal(authDataBytes, authData)
+	if err != nil {
+		return err
+	}
+	if authData.Version < authDataVersion && authData.LegacyAuthId == "" {
+		authData.LegacyAuthId = fmt.Sprintf("%x", md5.Sum(authDataBytes))
+		slog.Info("migrate auth data of old version", "addr", authData.Addr, "username", authData.Username, "authId", authData.LegacyAuthId)
+	}
+	p.authData = authData
+	return nil
+}
+
 // PluginAuthId implements IPlugin.
 // plugin auth id,you can generate id by md5 or sha
 func (p *PluginImpl) PluginAuthId() (string, error) {
-	data, err := json.Marshal(p.authData)
-	if err != nil {
-		return "", err
+	if p.authData.LegacyAuthId != "" {
+		return p.authData.LegacyAuthId, nil
 	}
-	return fmt.Sprintf("%x", md5.Sum(data)), nil
+	// token changes after refresh,only use addr and username
+	return fmt.Sprintf("%x", md5.Sum([]byte(p.authData.Addr+p.authData.Username))), nil
 }
 
 // GetDirEntry implements IPlugin.
@@ -187,16 +299,55 @@ func (p *PluginImpl) PluginAuthId() (string, error) {
 // default page_size if 100,if this not for you,change is on DirEntry.PageSize,will use new PageSize for next request
 func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
 	slog.Debug("GetDirEntry", "req", req)
+	// real dir named search has raw data
+	if util.IsSearchPath(req.Path) && fileRawData(req.FileEntry) == nil {
+		return p.search(req)
+	}
+	dirPath := realPath(req.Path, req.FileEntry)
+	dirEntry, err := p.listDir(dirPath, req.Page, req.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	if req.Path == "/" && req.Page == 1 {
+		dirEntry.FileEntries = append(dirEntry.FileEntries, util.SearchFileEntry())
+	}
+	return dirEntry, nil
+}
+
+// realPath return path in raw data,path of search result is not real path
+func realPath(filePath string, fileEntry *plugin.FileEntry) string {
+	rawData := fileRawData(fileEntry)
+	if rawData == nil || rawData.Path == "" {
+		return filePath
+	}
+	return rawData.Path
+}
+
+func fileRawData(fileEntry *plugin.FileEntry) *FileRawData {
+	if fileEntry == nil || fileEntry.RawData == nil {
+		return nil
+	}
+	rawData := &FileRawData{}
+	if err := json.Unmarshal(fileEntry.RawData, rawData); err != nil {
+		return nil
+	}
+	return rawData
+}
+
+func (p *PluginImpl) listDir(dirPath string, page, pageSize uint64) (*plugin.DirEntry, error) {
 	fsResp := &FsListResp{
 		Contents: []Content{},
 	}
 	fsReq := &FsListReq{
-		Path:    req.Path,
-		Page:    int64(req.Page),
-		PerPage: int64(req.PageSize),
+		Path:    dirPath,
+		Page:    int64(page),
+		PerPage: int64(pageSize),
 		Refresh: false,
 	}
-	err := p.request(http.MethodPost, "/api/fs/list", fsReq, fsResp)
+	err := p.requestWithPassword(dirPath, func(password string) error {
+		fsReq.Password = password
+		return p.request(http.MethodPost, "/api/fs/list", fsReq, fsResp)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -216,29 +367,173 @@ func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEnt
 		} else {
 			fileEntry.FileType = plugin.FileEntry_FileTypeFile
 		}
+		fileEntry.RawData, _ = json.Marshal(&FileRawData{
+			Path:     path.Join(dirPath, content.Name),
+			Sign:     content.Sign,
+			Provider: fsResp.Provider,
+		})
 		dirEntry.FileEntries = append(dirEntry.FileEntries, fileEntry)
 	}
 	return &dirEntry, nil
 }
 
+// search file by "/search/<keyword>",walk dir if search is not enabled in server
+func (p *PluginImpl) search(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+	}
+	if req.Path == util.SearchDir {
+		return dirEntry, nil
+	}
+	query, err := util.ParseSearchQuery(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	searchResp := &FsSearchResp{
+		Contents: []SearchContent{},
+	}
+	err = p.request(http.MethodPost, "/api/fs/search", &FsSearchReq{
+		Parent:   "/",
+		Keywords: query.Keyword,
+		Page:     int64(req.Page),
+		PerPage:  int64(req.PageSize),
+	}, searchResp)
+	if err != nil {
+		slog.Warn("search failed,walk dir to search", "err", err)
+		if req.Page > 1 {
+			return dirEntry, nil
+		}
+		fileEntries, err := util.WalkSearch(query, "/", func(dirPath string) ([]*plugin.FileEntry, error) {
+			walkDirEntry, err := p.listDir(dirPath, 1, 0)
+			if err != nil {
+				return nil, err
+			}
+			return walkDirEntry.FileEntries, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		dirEntry.FileEntries = fileEntries
+		return dirEntry, nil
+	}
+	for _, content := range searchResp.Contents {
+		if !query.MatchCategory(content.Name, content.IsDir) {
+			continue
+		}
+		filePath := path.Join(content.Parent, content.Name)
+		fileEntry := &plugin.FileEntry{
+			Name:     strings.TrimPrefix(filePath, "/"),
+			Size:     uint64(content.Size),
+			FileType: plugin.FileEntry_FileTypeFile,
+		}
+		if content.IsDir {
+			fileEntry.FileType = plugin.FileEntry_FileTypeDir
+		}
+		fileEntry.RawData, _ = json.Marshal(&FileRawData{Path: filePath})
+		dirEntry.FileEntries = append(dirEntry.FileEntries, fileEntry)
+	}
+	return dirEntry, nil
+}
+
 // GetFileResource implements IPlugin.
 func (p *PluginImpl) GetFileResource(req *plugin.GetFileResourceRequest) (*plugin.FileResource, error) {
 	slog.Debug("GetFileResource", "req", req)
-	fsGetReq := &FsGetReq{
-		Path: req.FilePath,
+	filePath := realPath(req.FilePath, req.FileEntry)
+	rawUrl := ""
+	rawData := fileRawData(req.FileEntry)
+	if rawData == nil || rawData.Provider == "" {
+		// file not from fs list,get sign and provider by fs get
+		fsGetReq := &FsGetReq{
+			Path: filePath,
+		}
+		content := &Content{}
+		err := p.requestWithPassword(filePath, func(password string) error {
+			fsGetReq.Password = password
+			return p.request(http.MethodPost, "/api/fs/get", fsGetReq, content)
+		})
+		if err != nil {
+			return nil, err
+		}
+		rawUrl = content.RawUrl
+		rawData = &FileRawData{
+			Path:     filePath,
+			Sign:     content.Sign,
+			Provider: content.Provider,
+		}
 	}
-	content := &Content{}
-	err := p.request(http.MethodPost, "/api/fs/get", fsGetReq, content)
-	if err != nil {
-		return nil, err
+	if rawUrl == "" {
+		rawUrl = p.downloadURL(filePath, rawData.Sign)
 	}
-	return &plugin.FileResource{
+	fileResource := &plugin.FileResource{
 		FileResourceData: []*plugin.FileResource_FileResourceData{
 			{
-				Url:          content.RawUrl,
+				Url:          rawUrl,
 				ResourceType: plugin.FileResource_Video,
 				Resolution:   plugin.FileResource_Original,
+				Size:         fileSize(req.FileEntry),
 			},
 		},
-	}, nil
+	}
+	if req.IsMedia && videoPreviewProviders[rawData.Provider] {
+		err := p.appendVideoPreview(fileResource, filePath)
+		if err != nil {
+			slog.Error("get video preview failed", "path", filePath, "err", err)
+		}
+	}
+	return fileResource, nil
+}
+
+func fileSize(fileEntry *plugin.FileEntry) uint64 {
+	if fileEntry == nil {
+		return 0
+	}
+	return fileEntry.Size
+}
+
+// downloadURL return /d/ url,sign is required if sign is enabled
+func (p *PluginImpl) downloadURL(filePath string, sign string) string {
+	u := &url.URL{Path: "/d" + filePath}
+	downloadURL := strings.TrimSuffix(p.authData.Addr, "/") + u.EscapedPath()
+	if sign != "" {
+		downloadURL += "?sign=" + url.QueryEscape(sign)
+	}
+	return downloadURL
+}
+
+// appendVideoPreview append transcoded video and subtitle of storage by fs other
+func (p *PluginImpl) appendVideoPreview(fileResource *plugin.FileResource, filePath string) error {
+	otherReq := &FsOtherReq{
+		Path:   filePath,
+		Method: "video_preview",
+	}
+	previewResp := &VideoPreviewResp{}
+	err := p.requestWithPassword(filePath, func(password string) error {
+		otherReq.Password = password
+		return p.request(http.MethodPost, "/api/fs/other", otherReq, previewResp)
+	})
+	if err != nil {
+		return err
+	}
+	for _, task := range previewResp.VideoPreviewPlayInfo.LiveTranscodingTaskList {
+		resolution, ok := templateResolutionMap[task.TemplateId]
+		if task.Status != "finished" || task.Url == "" || !ok {
+			continue
+		}
+		fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
+			Url:          task.Url,
+			ResourceType: plugin.FileResource_Video,
+			Resolution:   resolution,
+		})
+	}
+	for _, task := range previewResp.VideoPreviewPlayInfo.LiveTranscodingSubtitleTaskList {
+		if task.Status != "finished" || task.Url == "" {
+			continue
+		}
+		fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
+			Url:          task.Url,
+			Title:        task.Language,
+			ResourceType: plugin.FileResource_Subtitle,
+		})
+	}
+	return nil
 }
@@ -1,7 +1,15 @@
 package main
 
 import (
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/medianexapp/plugin_api/plugin"
 )
@@ -45,3 +53,322 @@ func TestPluginImpl(t *testing.T) {
 	t.Logf("get file  fileResource %+v", fileResource.FileResourceData[0])
 	return
 }
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestSearchWalkFallback(t *testing.T) {
+	transport := http.DefaultClient.Transport
+	defer func() {
+		http.DefaultClient.Transport = transport
+	}()
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		reqBody := map[string]any{}
+		json.NewDecoder(req.Body).Decode(&reqBody)
+		body := ""
+		switch req.URL.Path {
+		case "/api/fs/search":
+			body = `{"code":500,"message":"search not available"}`
+		case "/api/fs/list":
+			switch reqBody["path"] {
+			case "/":
+				body = `{"code":200,"data":{"content":[{"name":"movies","is_dir":true},{"name":"readme.txt"}]}}`
+			case "/movies":
+				body = `{"code":200,"data":{"content":[{"name":"Movie.mkv","size":1024}]}}`
+			case "/search":
+				body = `{"code":200,"data":{"content":[{"name":"Search.mkv","size":1024}]}}`
+			}
+		case "/api/fs/get":
+			if reqBody["path"] != "/movies/Movie.mkv" {
+				t.Errorf("unexpected get path %v", reqBody["path"])
+			}
+			body = `{"code":200,"data":{"raw_url":"http://127.0.0.1:5244/d/movies/Movie.mkv"}}`
+		}
+		if body == "" {
+			t.Errorf("unexpected request %s %v", req.URL, reqBody)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+
+	p := NewPluginImpl()
+	p.authData.Addr = "http://127.0.0.1:5244"
+	dirEntry, err := p.GetDirEntry(&plugin.GetDirEntryRequest{
+		Path:     "/search/movie?category=video",
+		Page:     1,
+		PageSize: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirEntry.FileEntries) != 1 || dirEntry.FileEntries[0].Name != "movies/Movie.mkv" {
+		t.Fatalf("unexpected search result %v", dirEntry.FileEntries)
+	}
+	fileResource, err := p.GetFileResource(&plugin.GetFileResourceRequest{
+		FilePath:  "/search/movie?category=video/movies/Movie.mkv",
+		FileEntry: dirEntry.FileEntries[0],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileResource.FileResourceData[0].Url != "http://127.0.0.1:5244/d/movies/Movie.mkv" {
+		t.Fatalf("unexpected url %s", fileResource.FileResourceData[0].Url)
+	}
+
+	// real dir named search is listed
+	rawData, _ := json.Marshal(&FileRawData{Path: "/search"})
+	dirEntry, err = p.GetDirEntry(&plugin.GetDirEntryRequest{
+		Path:      "/search",
+		FileEntry: &plugin.FileEntry{Name: "search", FileType: plugin.FileEntry_FileTypeDir, RawData: rawData},
+		Page:      1,
+		PageSize:  100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirEntry.FileEntries) != 1 || dirEntry.FileEntries[0].Name != "Search.mkv" {
+		t.Fatalf("unexpected real search dir %v", dirEntry.FileEntries)
+	}
+}
+
+func TestFolderPasswordAndRefresh(t *testing.T) {
+	transport := http.DefaultClient.Transport
+	defer func() {
+		http.DefaultClient.Transport = transport
+	}()
+	logins := 0
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		reqBody := map[string]any{}
+		json.NewDecoder(req.Body).Decode(&reqBody)
+		body := ""
+		switch req.URL.Path {
+		case "/api/auth/login":
+			logins++
+			if reqBody["username"] == "otp" && reqBody["otp_code"] != "123456" {
+				body = `{"code":402,"message":"Invalid 2FA code"}`
+				break
+			}
+			body = fmt.Sprintf(`{"code":200,"data":{"token":"token%d"}}`, logins)
+		case "/api/fs/list":
+			if req.Header.Get("Authorization") != "token1" {
+				t.Errorf("unexpected token %s", req.Header.Get("Authorization"))
+			}
+			if reqBody["password"] != "secret" {
+				body = `{"code":403,"message":"password is incorrect or you have no permission"}`
+			} else {
+				body = `{"code":200,"data":{"content":[{"name":"Movie.mkv","size":1024}]}}`
+			}
+		}
+		if body == "" {
+			t.Errorf("unexpected request %s %v", req.URL, reqBody)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+
+	p := NewPluginImpl()
+	auth, _ := p.GetAuth()
+	formData := auth.AuthMethods[0].Method.(*plugin.AuthMethod_Formdata)
+	formData.Formdata.FormItems[5].Value = plugin.String("/private/=secret\n/other=x")
+	authData, err := p.CheckAuthMethod(&plugin.AuthMethod{Method: formData})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authData.AuthDataExpiredTime < uint64(time.Now().Add(47*time.Hour).Unix()) || authData.AuthDataExpiredTime > uint64(time.Now().Add(49*time.Hour).Unix()) {
+		t.Fatalf("unexpected expired time %d", authData.AuthDataExpiredTime)
+	}
+	dirEntry, err := p.GetDirEntry(&plugin.GetDirEntryRequest{
+		Path:     "/private/movies",
+		Page:     1,
+		PageSize: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirEntry.FileEntries) != 1 {
+		t.Fatalf("unexpected dir entry %v", dirEntry.FileEntries)
+	}
+	authId, _ := p.PluginAuthId()
+
+	p = NewPluginImpl()
+	authData, err = p.CheckAuthMethod(&plugin.AuthMethod{
+		Method: &plugin.AuthMethod_Refresh{
+			Refresh: &plugin.Refresh{AuthData: authData},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logins != 2 || p.authData.Token != "token2" || p.authData.FolderPasswords["/private"] != "secret" {
+		t.Fatalf("unexpected refresh auth data %+v", p.authData)
+	}
+	refreshAuthId, _ := p.PluginAuthId()
+	if authId != refreshAuthId {
+		t.Fatal("auth id changed after refresh")
+	}
+
+	// account with otp can not refresh without otp code
+	p = NewPluginImpl()
+	formData.Formdata.FormItems[1].Value = plugin.String("otp")
+	formData.Formdata.FormItems[4].Value = plugin.String("123456")
+	authData, err = p.CheckAuthMethod(&plugin.AuthMethod{Method: formData})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logins = 0
+	_, err = p.CheckAuthMethod(&plugin.AuthMethod{
+		Method: &plugin.AuthMethod_Refresh{
+			Refresh: &plugin.Refresh{AuthData: authData},
+		},
+	})
+	if !errors.Is(err, ErrOtpReauthenticate) || logins != 0 {
+		t.Fatalf("unexpected refresh of otp account %v,%d", err, logins)
+	}
+	// otp is enabled after login
+	p.authData.Otp = false
+	authData.AuthDataBytes, _ = json.Marshal(p.authData)
+	_, err = p.CheckAuthMethod(&plugin.AuthMethod{
+		Method: &plugin.AuthMethod_Refresh{
+			Refresh: &plugin.Refresh{AuthData: authData},
+		},
+	})
+	if !errors.Is(err, ErrOtpReauthenticate) {
+		t.Fatalf("unexpected refresh of otp enabled account %v", err)
+	}
+}
+
+func TestFileResourceFromRawData(t *testing.T) {
+	transport := http.DefaultClient.Transport
+	defer func() {
+		http.DefaultClient.Transport = transport
+	}()
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		reqBody := map[string]any{}
+		json.NewDecoder(req.Body).Decode(&reqBody)
+		body := ""
+		switch req.URL.Path {
+		case "/api/fs/list":
+			body = `{"code":200,"data":{"provider":"AliyundriveOpen","content":[{"name":"我的 电影.mkv","size":1024,"sign":"abc=:0"}]}}`
+		case "/api/fs/other":
+			if reqBody["path"] != "/ali/我的 电影.mkv" || reqBody["method"] != "video_preview" {
+				t.Errorf("unexpected fs other request %v", reqBody)
+			}
+			body = `{"code":200,"data":{"video_preview_play_info":{
+				"live_transcoding_task_list":[{"template_id":"FHD","status":"finished","url":"https://cn.example.com/fhd.m3u8"},{"template_id":"QHD","status":"running"}],
+				"live_transcoding_subtitle_task_list":[{"language":"chi","status":"finished","url":"https://cn.example.com/chi.vtt"}]}}}`
+		}
+		if body == "" {
+			t.Errorf("unexpected request %s %v", req.URL, reqBody)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+
+	p := NewPluginImpl()
+	p.authData.Addr = "http://127.0.0.1:5244/"
+	dirEntry, err := p.GetDirEntry(&plugin.GetDirEntryRequest{
+		Path:     "/ali",
+		Page:     1,
+		PageSize: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileResource, err := p.GetFileResource(&plugin.GetFileResourceRequest{
+		FilePath:  "/ali/我的 电影.mkv",
+		FileEntry: dirEntry.FileEntries[0],
+		IsMedia:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileResource.FileResourceData) != 3 {
+		t.Fatalf("unexpected resource %v", fileResource.FileResourceData)
+	}
+	if fileResource.FileResourceData[0].Url != "http://127.0.0.1:5244/d/ali/%E6%88%91%E7%9A%84%20%E7%94%B5%E5%BD%B1.mkv?sign=abc%3D%3A0" {
+		t.Fatalf("unexpected url %s", fileResource.FileResourceData[0].Url)
+	}
+	if fileResource.FileResourceData[1].Resolution != plugin.FileResource_FHD || fileResource.FileResourceData[2].ResourceType != plugin.FileResource_Subtitle {
+		t.Fatalf("unexpected video preview %v", fileResource.FileResourceData[1:])
+	}
+}
+
+func TestMigrateLegacyAuthData(t *testing.T) {
+	transport := http.DefaultClient.Transport
+	defer func() {
+		http.DefaultClient.Transport = transport
+	}()
+	http.DefaultClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"code":200,"data":{}}`
+		if req.URL.Path == "/api/auth/login" {
+			body = `{"code":200,"data":{"token":"new_token"}}`
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+
+	// accounts of old version are stored by plugin id alist
+	if pluginId, _ := NewPluginImpl().PluginId(); pluginId != "alist" {
+		t.Fatalf("unexpected plugin id %s", pluginId)
+	}
+	// auth data stored by old version,auth id is md5 of it
+	legacyAuthDataBytes := []byte(`{"Addr":"http://openlist.test","Username":"admin","Password":"pass","TokenExpired":48,"Token":"old_token"}`)
+	legacyAuthId := fmt.Sprintf("%x", md5.Sum(legacyAuthDataBytes))
+	p := NewPluginImpl()
+	err := p.CheckAuthData(legacyAuthDataBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authId, _ := p.PluginAuthId()
+	if authId != legacyAuthId {
+		t.Fatalf("unexpected legacy auth id %s", authId)
+	}
+
+	authData, err := p.CheckAuthMethod(&plugin.AuthMethod{
+		Method: &plugin.AuthMethod_Refresh{
+			Refresh: &plugin.Refresh{AuthData: &plugin.AuthData{AuthDataBytes: legacyAuthDataBytes}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = NewPluginImpl()
+	err = p.CheckAuthData(authData.AuthDataBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authId, _ = p.PluginAuthId()
+	if authId != legacyAuthId || p.authData.Token != "new_token" || p.authData.Version != authDataVersion {
+		t.Fatalf("unexpected migrated auth data %s %+v", authId, p.authData)
+	}
+
+	// new login use addr and username
+	p = NewPluginImpl()
+	auth, _ := p.GetAuth()
+	formData := auth.AuthMethods[0].Method.(*plugin.AuthMethod_Formdata)
+	formData.Formdata.FormItems[0].Value = plugin.String("http://openlist.test")
+	formData.Formdata.FormItems[1].Value = plugin.String("admin")
+	_, err = p.CheckAuthMethod(&plugin.AuthMethod{Method: formData})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authId, _ = p.PluginAuthId()
+	if authId != fmt.Sprintf("%x", md5.Sum([]byte("http://openlist.testadmin"))) {
+		t.Fatalf("unexpected auth id %s", authId)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"testing"
 
+	"plugins/util/clouddrive/clouddrivetest"
+
 	"github.com/medianexapp/plugin_api/plugin"
 )
 
@@ -47,3 +49,11 @@ func TestPluginImpl(t *testing.T) {
 	t.Log(string(dd))
 
 }
+
+func TestFakeServer(t *testing.T) {
+	clouddrivetest.TestPlugin(t, NewPluginImpl().PluginImpl)
+}
+
+func TestFakeShare(t *testing.T) {
+	clouddrivetest.TestShare(t, NewPluginImpl().PluginImpl)
+}
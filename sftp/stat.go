@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/medianexapp/plugin_api/plugin"
+	"github.com/medianexapp/sftp"
+)
+
+// extended attribute names of birth time which some servers send,like birthtime@example.com
+var birthTimeExtTypes = []string{"birthtime", "crtime", "createtime"}
+
+// statBirthTime return birth time in extended attributes,value is decimal seconds
+func statBirthTime(stat *sftp.FileStat) (uint32, bool) {
+	for _, ext := range stat.Extended {
+		extType := strings.ToLower(ext.ExtType)
+		for _, name := range birthTimeExtTypes {
+			if !strings.Contains(extType, name) {
+				continue
+			}
+			sec, err := strconv.ParseFloat(strings.TrimSpace(ext.ExtData), 64)
+			if err == nil && sec > 0 {
+				return uint32(sec), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// setFileTime set times of sftp stat,created time fall back to mtime
+func setFileTime(fileEntry *plugin.FileEntry, stat *sftp.FileStat) {
+	fileEntry.ModifiedTime = uint64(stat.Mtime)
+	fileEntry.AccessedTime = uint64(stat.Atime)
+	fileEntry.CreatedTime = uint64(stat.Mtime)
+	if birthTime, ok := statBirthTime(stat); ok {
+		fileEntry.CreatedTime = uint64(birthTime)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/medianexapp/plugin_api/plugin"
+	"github.com/medianexapp/sftp"
+)
+
+func TestSetFileTime(t *testing.T) {
+	fileEntry := &plugin.FileEntry{}
+	setFileTime(fileEntry, &sftp.FileStat{Mode: 0o100644, Mtime: 100, Atime: 300})
+	if fileEntry.ModifiedTime != 100 || fileEntry.AccessedTime != 300 || fileEntry.CreatedTime != 100 {
+		t.Fatalf("unexpected times %+v", fileEntry)
+	}
+
+	fileEntry = &plugin.FileEntry{}
+	setFileTime(fileEntry, &sftp.FileStat{Mtime: 100, Atime: 300, Extended: []sftp.StatExtended{
+		{ExtType: "acl@example.com", ExtData: "1"},
+		{ExtType: "birthtime@example.com", ExtData: "50.5"},
+	}})
+	if fileEntry.ModifiedTime != 100 || fileEntry.AccessedTime != 300 || fileEntry.CreatedTime != 50 {
+		t.Fatalf("unexpected times %+v", fileEntry)
+	}
+
+	fileEntry = &plugin.FileEntry{}
+	setFileTime(fileEntry, &sftp.FileStat{Mtime: 100, Extended: []sftp.StatExtended{
+		{ExtType: "crtime", ExtData: "invalid"},
+	}})
+	if fileEntry.CreatedTime != 100 {
+		t.Fatalf("created time should fall back to mtime,got %d", fileEntry.CreatedTime)
+	}
+}
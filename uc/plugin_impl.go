@@ -0,0 +1,40 @@
+package main
+
+import (
+	"plugins/util/clouddrive"
+
+	_ "github.com/labulakalia/wazero_net/wasi/http" // if you need http import this
+)
+
+const (
+	userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) uc-cloud-drive/2.5.20 Chrome/100.0.4896.160 Electron/18.3.5.4-b478491100 Safari/537.36 Channel/pckk_other_ch"
+	referer   = "https://drive.uc.cn"
+	api       = "https://pc-api.uc.cn/1/clouddrive"
+	pr        = "UCBrowser"
+
+	qrcodeApi      = "https://api.open.uc.cn/cas/ajax"
+	qrcodeURL      = "https://su.uc.cn/1_n0ZCv"
+	qrcodeClientId = "381"
+	accountInfoURL = "https://drive.uc.cn/account/info"
+)
+
+// PluginImpl request/listing/play logic is shared with quark in clouddrive
+type PluginImpl struct {
+	*clouddrive.PluginImpl
+}
+
+func NewPluginImpl() *PluginImpl {
+	return &PluginImpl{
+		PluginImpl: clouddrive.New(&clouddrive.Config{
+			PluginId:       "uc",
+			UserAgent:      userAgent,
+			Referer:        referer,
+			Api:            api,
+			Pr:             pr,
+			QrcodeApi:      qrcodeApi,
+			QrcodeURL:      qrcodeURL,
+			QrcodeClientId: qrcodeClientId,
+			AccountInfoURL: accountInfoURL,
+		}),
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"testing"
+
+	"plugins/util/clouddrive/clouddrivetest"
+)
+
+func TestFakeServer(t *testing.T) {
+	clouddrivetest.TestPlugin(t, NewPluginImpl().PluginImpl)
+}
+
+func TestFakeShare(t *testing.T) {
+	clouddrivetest.TestShare(t, NewPluginImpl().PluginImpl)
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is lru cache with ttl,the least recently used item is evicted when it is full
+type Cache[K comparable, V any] struct {
+	mu      sync.Mutex
+	maxSize int
+	ttl     time.Duration
+	items   map[K]*list.Element
+	lru     *list.List
+}
+
+type cacheItem[K comparable, V any] struct {
+	key        K
+	value      V
+	expireTime time.Time
+}
+
+// NewCache create cache which hold at most maxSize items,item expire after ttl,zero ttl never expire
+func NewCache[K comparable, V any](maxSize int, ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		maxSize: maxSize,
+		ttl:     ttl,
+		items:   map[K]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var zero V
+	elem, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	item := elem.Value.(*cacheItem[K, V])
+	if c.ttl > 0 && time.Now().After(item.expireTime) {
+		c.lru.Remove(elem)
+		delete(c.items, key)
+		return zero, false
+	}
+	c.lru.MoveToFront(elem)
+	return item.value, true
+}
+
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expireTime := time.Now().Add(c.ttl)
+	if elem, ok := c.items[key]; ok {
+		item := elem.Value.(*cacheItem[K, V])
+		item.value = value
+		item.expireTime = expireTime
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.lru.PushFront(&cacheItem[K, V]{key: key, value: value, expireTime: expireTime})
+	for c.lru.Len() > c.maxSize {
+		elem := c.lru.Back()
+		c.lru.Remove(elem)
+		delete(c.items, elem.Value.(*cacheItem[K, V]).key)
+	}
+}
+
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.lru.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
@@ -0,0 +1,34 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	cache := NewCache[string, int](2, time.Minute)
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("a should be cached")
+	}
+	// b is least recently used
+	cache.Set("c", 3)
+	if _, ok := cache.Get("b"); ok {
+		t.Fatal("b should be evicted")
+	}
+	if v, ok := cache.Get("c"); !ok || v != 3 || cache.Len() != 2 {
+		t.Fatalf("unexpected c %d %v,len %d", v, ok, cache.Len())
+	}
+	cache.Delete("c")
+	if _, ok := cache.Get("c"); ok {
+		t.Fatal("c should be deleted")
+	}
+
+	expired := NewCache[string, int](2, time.Nanosecond)
+	expired.Set("a", 1)
+	time.Sleep(time.Millisecond)
+	if _, ok := expired.Get("a"); ok || expired.Len() != 0 {
+		t.Fatal("a should be expired")
+	}
+}
@@ -0,0 +1,272 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+// ChangesDir is virtual dir of protocol plugin,open "/.changes/<dir>" to get all entries of dir as added,
+// open "/.changes@<cursor>/<dir>" to get changes since cursor,cursor is in ChangeRawData of changed entry.
+// empty changes mean dir not change since cursor,poll again with the same cursor.
+// it is only used when request has no FileEntry,so real ".changes" dir listed by host is not shadowed
+const ChangesDir = "/.changes"
+
+// change kind of changed entry
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+const (
+	// changesHistorySize is snapshot count kept for each dir,host can poll again with an older cursor
+	changesHistorySize = 4
+	// changesMaxDirs is max dir count kept in memory,the least recently polled dir is dropped
+	changesMaxDirs = 10000
+)
+
+var ErrChangeCursorExpired = errors.New("change cursor expired,list dir again")
+
+// ChangeRawData is raw data of changed entry,RawData is raw data of entry from plugin
+type ChangeRawData struct {
+	Kind    string `json:"kind"`
+	Cursor  string `json:"cursor"`
+	RawData []byte `json:"rawData,omitempty"`
+}
+
+// ParseChangeRawData return raw data of changed entry,nil if it is not changed entry
+func ParseChangeRawData(fileEntry *plugin.FileEntry) *ChangeRawData {
+	if fileEntry == nil || len(fileEntry.RawData) == 0 {
+		return nil
+	}
+	rawData := &ChangeRawData{}
+	if err := json.Unmarshal(fileEntry.RawData, rawData); err != nil || rawData.Kind == "" {
+		return nil
+	}
+	return rawData
+}
+
+// IsChangesPath check path is in ChangesDir,req is request of GetDirEntry
+func IsChangesPath(req *plugin.GetDirEntryRequest) bool {
+	_, _, ok := ParseChangesPath(req.Path)
+	return ok && req.FileEntry == nil
+}
+
+// ChangesPath return path to poll changes of dir since cursor
+func ChangesPath(dirPath, cursor string) string {
+	dirPath = strings.TrimSuffix(dirPath, "/")
+	if cursor == "" {
+		return ChangesDir + dirPath
+	}
+	return ChangesDir + "@" + cursor + dirPath
+}
+
+// ParseChangesPath return watched dir and cursor of "/.changes@<cursor>/<dir>"
+func ParseChangesPath(changesPath string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(changesPath, ChangesDir)
+	if !ok {
+		return "", "", false
+	}
+	cursor := ""
+	if strings.HasPrefix(rest, "@") {
+		cursor, rest, _ = strings.Cut(rest[1:], "/")
+		if cursor == "" {
+			return "", "", false
+		}
+		rest = "/" + rest
+	}
+	if rest != "" && !strings.HasPrefix(rest, "/") {
+		return "", "", false
+	}
+	if rest == "" || rest == "/" {
+		return "/", cursor, true
+	}
+	return strings.TrimSuffix(rest, "/"), cursor, true
+}
+
+// EntryFingerprint is fingerprint of entry by type,size and modified time
+func EntryFingerprint(fileEntry *plugin.FileEntry) string {
+	return fmt.Sprintf("%d:%d:%d", fileEntry.FileType, fileEntry.Size, fileEntry.ModifiedTime)
+}
+
+type changeSnapshot struct {
+	cursor  string
+	entries map[string]*changeSnapshotEntry
+}
+
+type changeSnapshotEntry struct {
+	fingerprint string
+	fileEntry   *plugin.FileEntry
+}
+
+type changeDir struct {
+	snapshots []*changeSnapshot
+	polledAt  uint64
+}
+
+// ChangeFeed record fingerprint of polled dirs in memory and report changes since cursor,
+// cursor of other plugin instance is expired,so host list dir again after plugin restart.
+// modified time of dir change when entry in it is added or removed,host can poll modified dir
+type ChangeFeed struct {
+	mu         sync.Mutex
+	generation string
+	seq        uint64
+	dirs       map[string]*changeDir
+}
+
+// DirEntry report changes of page in ChangesDir,listDir list whole dir,
+// fingerprint is EntryFingerprint if it is nil
+func (f *ChangeFeed) DirEntry(req *plugin.GetDirEntryRequest, listDir func(string) ([]*plugin.FileEntry, error), fingerprint func(*plugin.FileEntry) string) (*plugin.DirEntry, error) {
+	dirPath, cursor, ok := ParseChangesPath(req.Path)
+	if !ok {
+		return nil, fmt.Errorf("%s is not changes path", req.Path)
+	}
+	fileEntries, err := listDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := f.Changes(dirPath, cursor, fileEntries, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	return &plugin.DirEntry{
+		FileEntries: PageSlice(changes, req.Page, req.PageSize),
+	}, nil
+}
+
+// Changes compare entries of dir with snapshot of cursor,and record entries as new snapshot,
+// changed entries are sorted by name and cursor of new snapshot is in their ChangeRawData
+func (f *ChangeFeed) Changes(dirPath, cursor string, fileEntries []*plugin.FileEntry, fingerprint func(*plugin.FileEntry) string) ([]*plugin.FileEntry, error) {
+	if fingerprint == nil {
+		fingerprint = EntryFingerprint
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dirs == nil {
+		f.generation = strconv.FormatInt(time.Now().UnixNano(), 36)
+		f.dirs = map[string]*changeDir{}
+	}
+	dir := f.dirs[dirPath]
+	old := &changeSnapshot{entries: map[string]*changeSnapshotEntry{}}
+	oldIndex := -1
+	if cursor != "" {
+		if dir != nil {
+			for i, snapshot := range dir.snapshots {
+				if snapshot.cursor == cursor {
+					old, oldIndex = snapshot, i
+				}
+			}
+		}
+		if oldIndex < 0 {
+			return nil, ErrChangeCursorExpired
+		}
+	}
+
+	current := &changeSnapshot{entries: make(map[string]*changeSnapshotEntry, len(fileEntries))}
+	for _, fileEntry := range fileEntries {
+		current.entries[fileEntry.Name] = &changeSnapshotEntry{
+			fingerprint: fingerprint(fileEntry),
+			fileEntry:   fileEntry,
+		}
+	}
+	changes := diffSnapshot(old, current)
+
+	if dir == nil {
+		f.evictDir()
+		dir = &changeDir{}
+		f.dirs[dirPath] = dir
+	}
+	f.seq++
+	dir.polledAt = f.seq
+	if len(changes) == 0 {
+		// dir not change since cursor,keep snapshot of cursor as the latest so cursor is not expired
+		if oldIndex >= 0 {
+			dir.snapshots = append(append(dir.snapshots[:oldIndex:oldIndex], dir.snapshots[oldIndex+1:]...), old)
+		}
+		return []*plugin.FileEntry{}, nil
+	}
+	if latest := len(dir.snapshots) - 1; latest >= 0 && len(diffSnapshot(dir.snapshots[latest], current)) == 0 {
+		// dir not change since last poll,keep cursor of last poll
+		current.cursor = dir.snapshots[latest].cursor
+	} else {
+		current.cursor = fmt.Sprintf("%s.%d", f.generation, f.seq)
+		dir.snapshots = append(dir.snapshots, current)
+		if len(dir.snapshots) > changesHistorySize {
+			dir.snapshots = dir.snapshots[len(dir.snapshots)-changesHistorySize:]
+		}
+	}
+	fileEntries = make([]*plugin.FileEntry, 0, len(changes))
+	for _, change := range changes {
+		rawData, err := json.Marshal(&ChangeRawData{Kind: change.kind, Cursor: current.cursor, RawData: change.fileEntry.RawData})
+		if err != nil {
+			return nil, err
+		}
+		fileEntries = append(fileEntries, &plugin.FileEntry{
+			Name:         change.fileEntry.Name,
+			FileType:     change.fileEntry.FileType,
+			Size:         change.fileEntry.Size,
+			RawData:      rawData,
+			CreatedTime:  change.fileEntry.CreatedTime,
+			ModifiedTime: change.fileEntry.ModifiedTime,
+			AccessedTime: change.fileEntry.AccessedTime,
+		})
+	}
+	return fileEntries, nil
+}
+
+// evictDir drop the least recently polled dir if there are too many dirs
+func (f *ChangeFeed) evictDir() {
+	if len(f.dirs) < changesMaxDirs {
+		return
+	}
+	oldestPath := ""
+	var oldest *changeDir
+	for dirPath, dir := range f.dirs {
+		if oldest == nil || dir.polledAt < oldest.polledAt {
+			oldestPath, oldest = dirPath, dir
+		}
+	}
+	delete(f.dirs, oldestPath)
+}
+
+type changedEntry struct {
+	kind string
+	*changeSnapshotEntry
+}
+
+// diffSnapshot return changed entries sorted by name,removed entry is the entry in old snapshot
+func diffSnapshot(old, current *changeSnapshot) []changedEntry {
+	names := make([]string, 0, len(current.entries))
+	for name := range current.entries {
+		names = append(names, name)
+	}
+	for name := range old.entries {
+		if _, ok := current.entries[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []changedEntry{}
+	for _, name := range names {
+		oldEntry, inOld := old.entries[name]
+		currentEntry, inCurrent := current.entries[name]
+		switch {
+		case !inOld:
+			changes = append(changes, changedEntry{ChangeAdded, currentEntry})
+		case !inCurrent:
+			changes = append(changes, changedEntry{ChangeRemoved, oldEntry})
+		case oldEntry.fingerprint != currentEntry.fingerprint:
+			changes = append(changes, changedEntry{ChangeModified, currentEntry})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,159 @@
+package util
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+func changeNames(t *testing.T, fileEntries []*plugin.FileEntry) ([]string, string) {
+	names, cursor := []string{}, ""
+	for _, fileEntry := range fileEntries {
+		rawData := ParseChangeRawData(fileEntry)
+		if rawData == nil {
+			t.Fatalf("entry %s has no change raw data", fileEntry.Name)
+		}
+		names = append(names, rawData.Kind+":"+fileEntry.Name)
+		cursor = rawData.Cursor
+	}
+	return names, cursor
+}
+
+func TestChangeFeed(t *testing.T) {
+	feed := &ChangeFeed{}
+	fileEntries := []*plugin.FileEntry{
+		{Name: "E01.mkv", FileType: plugin.FileEntry_FileTypeFile, Size: 100, ModifiedTime: 1, RawData: []byte("e01")},
+		{Name: "E02.mkv", FileType: plugin.FileEntry_FileTypeFile, Size: 200, ModifiedTime: 1},
+		{Name: "Extras", FileType: plugin.FileEntry_FileTypeDir, ModifiedTime: 1},
+	}
+	changes, err := feed.Changes("/Show", "", fileEntries, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, firstCursor := changeNames(t, changes)
+	if want := []string{"added:E01.mkv", "added:E02.mkv", "added:Extras"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got %v,want %v", names, want)
+	}
+
+	changes, err = feed.Changes("/Show", firstCursor, fileEntries, nil)
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("unchanged dir got %v %v", changes, err)
+	}
+
+	fileEntries = []*plugin.FileEntry{
+		{Name: "E02.mkv", FileType: plugin.FileEntry_FileTypeFile, Size: 250, ModifiedTime: 2},
+		{Name: "E03.mkv", FileType: plugin.FileEntry_FileTypeFile, Size: 300, ModifiedTime: 2},
+		{Name: "Extras", FileType: plugin.FileEntry_FileTypeDir, ModifiedTime: 1},
+	}
+	changes, err = feed.Changes("/Show", firstCursor, fileEntries, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, secondCursor := changeNames(t, changes)
+	if want := []string{"removed:E01.mkv", "modified:E02.mkv", "added:E03.mkv"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got %v,want %v", names, want)
+	}
+	if changes[0].Size != 100 || changes[1].Size != 250 || string(ParseChangeRawData(changes[0]).RawData) != "e01" {
+		t.Fatalf("unexpected changed entries %v", changes)
+	}
+	if secondCursor == firstCursor {
+		t.Fatal("cursor should change")
+	}
+
+	// the older cursor is still in history
+	changes, err = feed.Changes("/Show", firstCursor, fileEntries, nil)
+	if _, cursor := changeNames(t, changes); err != nil || len(changes) != 3 || cursor != secondCursor {
+		t.Fatalf("poll with older cursor got %v %v", changes, err)
+	}
+
+	for _, cursor := range []string{"unknown.1", secondCursor} {
+		_, err = feed.Changes("/Other", cursor, fileEntries, nil)
+		if !errors.Is(err, ErrChangeCursorExpired) {
+			t.Fatalf("cursor %s got %v", cursor, err)
+		}
+	}
+}
+
+func TestChangeFeedCursorKept(t *testing.T) {
+	feed := &ChangeFeed{}
+	fileEntries := []*plugin.FileEntry{{Name: "a.mkv"}}
+	changes, err := feed.Changes("/", "", fileEntries, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cursor := changeNames(t, changes)
+	// unchanged polls keep cursor alive after more snapshots than history size
+	for i := range changesHistorySize + 1 {
+		if _, err = feed.Changes("/", "", []*plugin.FileEntry{{Name: "a.mkv", Size: uint64(i + 1)}}, nil); err != nil {
+			t.Fatal(err)
+		}
+		changes, err = feed.Changes("/", cursor, fileEntries, nil)
+		if err != nil || len(changes) != 0 {
+			t.Fatalf("poll %d got %v %v", i, changes, err)
+		}
+	}
+}
+
+func TestChangeFeedDirEntry(t *testing.T) {
+	feed := &ChangeFeed{}
+	etag := func(fileEntry *plugin.FileEntry) string {
+		return string(fileEntry.RawData)
+	}
+	changes, err := feed.Changes("/", "", []*plugin.FileEntry{{Name: "a.mkv", RawData: []byte("v1")}}, etag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cursor := changeNames(t, changes)
+	changes, err = feed.Changes("/", cursor, []*plugin.FileEntry{{Name: "a.mkv", RawData: []byte("v2")}}, etag)
+	if names, _ := changeNames(t, changes); err != nil || !reflect.DeepEqual(names, []string{"modified:a.mkv"}) {
+		t.Fatal(changes, err)
+	}
+
+	listDir := func(dirPath string) ([]*plugin.FileEntry, error) {
+		if dirPath != "/Movies" {
+			t.Fatalf("unexpected dir %s", dirPath)
+		}
+		return []*plugin.FileEntry{{Name: "b.mkv"}, {Name: "c.mkv"}, {Name: "d.mkv"}}, nil
+	}
+	dirEntry, err := feed.DirEntry(&plugin.GetDirEntryRequest{Path: ChangesPath("/Movies/", ""), Page: 2, PageSize: 2}, listDir, nil)
+	if names, _ := changeNames(t, dirEntry.GetFileEntries()); err != nil || !reflect.DeepEqual(names, []string{"added:d.mkv"}) {
+		t.Fatal(dirEntry, err)
+	}
+	_, cursor = changeNames(t, dirEntry.FileEntries)
+	dirEntry, err = feed.DirEntry(&plugin.GetDirEntryRequest{Path: ChangesPath("/Movies", cursor)}, listDir, nil)
+	if err != nil || len(dirEntry.FileEntries) != 0 {
+		t.Fatal(dirEntry, err)
+	}
+}
+
+func TestChangesPath(t *testing.T) {
+	for changesPath, want := range map[string][2]string{
+		ChangesDir:                       {"/", ""},
+		ChangesDir + "/":                 {"/", ""},
+		ChangesDir + "/Movies/2024":      {"/Movies/2024", ""},
+		ChangesDir + "@abc.1":            {"/", "abc.1"},
+		ChangesDir + "@abc.1/Movies@x/a": {"/Movies@x/a", "abc.1"},
+	} {
+		dirPath, cursor, ok := ParseChangesPath(changesPath)
+		if !ok || dirPath != want[0] || cursor != want[1] {
+			t.Fatalf("ParseChangesPath(%s) = %s,%s,%v", changesPath, dirPath, cursor, ok)
+		}
+	}
+	for _, changesPath := range []string{"/.changesx", "/.changes@", "/.changes@/Movies", "/Movies/.changes"} {
+		if _, _, ok := ParseChangesPath(changesPath); ok {
+			t.Fatalf("%s should not be changes path", changesPath)
+		}
+	}
+	if ChangesPath("/", "") != ChangesDir || ChangesPath("/Movies/", "abc.1") != ChangesDir+"@abc.1/Movies" {
+		t.Fatal("unexpected changes path")
+	}
+	if !IsChangesPath(&plugin.GetDirEntryRequest{Path: ChangesDir}) {
+		t.Fatal("changes dir without file entry is virtual")
+	}
+	// real .changes dir listed by host has file entry
+	if IsChangesPath(&plugin.GetDirEntryRequest{Path: ChangesDir, FileEntry: &plugin.FileEntry{Name: ".changes"}}) {
+		t.Fatal("real .changes dir is shadowed")
+	}
+}
@@ -0,0 +1,276 @@
+// Package clouddrivetest run the same fake server test for every clouddrive plugin
+package clouddrivetest
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"plugins/util"
+	"plugins/util/clouddrive"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+const (
+	cookie      = "__pus=abc; __uid=uid1; __puus=old"
+	downloadURL = "https://download.example.com/video.mkv?Expires=1700000000"
+	playURL     = "https://play.example.com/video.m3u8?auth_key=1700000001-0-0-abc"
+	subtitleURL = "https://play.example.com/video.srt?Expires=1700000002"
+	audioURL    = "https://play.example.com/audio.m3u8?Expires=1700000003"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// fakeServer reply clouddrive api with fixed data,and check every request is sent with config of plugin
+func fakeServer(t *testing.T, config *clouddrive.Config) roundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("User-Agent") != config.UserAgent {
+			t.Errorf("%s unexpected user agent %s", req.URL, req.Header.Get("User-Agent"))
+		}
+		if req.Header.Get("Referer") != config.Referer {
+			t.Errorf("%s unexpected referer %s", req.URL, req.Header.Get("Referer"))
+		}
+		reqURL := req.URL.String()
+		body := ""
+		switch {
+		case strings.HasPrefix(reqURL, config.QrcodeApi+"/getTokenForQrcodeLogin"):
+			if req.URL.Query().Get("client_id") != config.QrcodeClientId {
+				t.Errorf("unexpected client_id %s", req.URL.Query().Get("client_id"))
+			}
+			body = `{"status":2000000,"message":"ok","data":{"members":{"token":"qrcode-token"}}}`
+		case strings.HasPrefix(reqURL, config.AccountInfoURL):
+			body = `{"success":true,"code":"OK","data":{"nickname":"tester"}}`
+		case strings.HasPrefix(reqURL, config.Api):
+			if req.URL.Query().Get("pr") != config.Pr {
+				t.Errorf("%s unexpected pr %s", req.URL, req.URL.Query().Get("pr"))
+			}
+			if req.Header.Get("Cookie") != cookie {
+				t.Errorf("%s unexpected cookie %s", req.URL, req.Header.Get("Cookie"))
+			}
+			uri, _, _ := strings.Cut(strings.TrimPrefix(reqURL, config.Api), "?")
+			switch uri {
+			case "/config":
+				body = `{"code":0,"data":{}}`
+			case "/file/sort":
+				if req.URL.Query().Get("_fetch_full_path") == "1" {
+					if req.URL.Query().Get("pdir_fid") != "dir2" {
+						t.Errorf("unexpected full path query %s", req.URL.RawQuery)
+					}
+					body = `{"code":0,"data":{"list":[],"full_path":[{"fid":"dir1","file_name":"movies"},{"fid":"dir2","file_name":"2024"}]}}`
+					break
+				}
+				body = `{"code":0,"data":{"list":[{"fid":"fid1","file_name":"video.mkv","size":1024,"file":true,"created_at":1700000000000,"updated_at":1700000000000}]}}`
+			case "/file/download":
+				body = fmt.Sprintf(`{"code":0,"data":[{"fid":"fid1","download_url":%q}]}`, downloadURL)
+			case "/file/search":
+				if req.URL.Query().Get("q") != "video" {
+					t.Errorf("unexpected search query %s", req.URL.RawQuery)
+				}
+				body = `{"code":0,"data":{"list":[{"fid":"fid2","file_name":"video","dir":true},{"fid":"fid1","pdir_fid":"dir2","file_name":"video.mkv","size":1024,"file":true}]}}`
+			case "/share/sharepage/token":
+				reqBody, _ := io.ReadAll(req.Body)
+				if string(reqBody) != `{"pwd_id":"share1","passcode":"1234"}` {
+					t.Errorf("unexpected share token request %s", reqBody)
+				}
+				body = `{"code":0,"data":{"stoken":"stoken+1","title":"share title"}}`
+			case "/share/sharepage/detail":
+				if req.URL.Query().Get("stoken") != "stoken+1" || req.URL.Query().Get("pdir_fid") != "0" {
+					t.Errorf("unexpected share detail query %s", req.URL.RawQuery)
+				}
+				body = `{"code":0,"data":{"list":[{"fid":"sharefid1","file_name":"share.mkv","size":2048,"file":true}]}}`
+			case "/file/v2/play":
+				body = fmt.Sprintf(`{"code":0,"data":{"video_list":[
+					{"resolution":"2k","trans_status":"success","video_info":{"url":%q,"height":1440}},
+					{"resolution":"normal","trans_status":"success","video_info":{"url":%q}},
+					{"resolution":"4k","trans_status":"processing","video_info":{"url":""}}],
+					"subtitle_list":[{"name":"简体中文","language":"chi","url":%q}],
+					"audio_list":[{"name":"English","language":"eng","url":%q}]}}`, playURL, playURL, subtitleURL, audioURL)
+			}
+		}
+		if body == "" {
+			t.Errorf("unexpected request %s", reqURL)
+			return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	}
+}
+
+// TestPlugin run auth,list and play with fake server
+func TestPlugin(t *testing.T, p *clouddrive.PluginImpl) {
+	transport := http.DefaultClient.Transport
+	defer func() {
+		http.DefaultClient.Transport = transport
+	}()
+	http.DefaultClient.Transport = fakeServer(t, p.Config())
+
+	auth, err := p.GetAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(auth.AuthMethods) != 2 {
+		t.Fatalf("expect formdata and qrcode auth method,got %d", len(auth.AuthMethods))
+	}
+	formdata := auth.AuthMethods[0].Method.(*plugin.AuthMethod_Formdata)
+	formdata.Formdata.FormItems[0].Value = plugin.String(cookie)
+	authData, err := p.CheckAuthMethod(&plugin.AuthMethod{Method: formdata})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.CheckAuthData(authData.AuthDataBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authId, err := p.PluginAuthId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authId != fmt.Sprintf("%x", md5.Sum([]byte("uid1"))) {
+		t.Fatalf("unexpected plugin auth id %s", authId)
+	}
+
+	dirEntry, err := p.GetDirEntry(&plugin.GetDirEntryRequest{
+		Path:     "/",
+		Page:     1,
+		PageSize: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// shares,search virtual dir and video.mkv
+	if len(dirEntry.FileEntries) != 3 || dirEntry.FileEntries[0].Name != "shares" || dirEntry.FileEntries[1].Name != "search" || dirEntry.FileEntries[2].Name != "video.mkv" {
+		t.Fatalf("unexpected dir entry %v", dirEntry.FileEntries)
+	}
+	if dirEntry.FileEntries[2].FileType != plugin.FileEntry_FileTypeFile {
+		t.Fatalf("unexpected file type %v", dirEntry.FileEntries[2].FileType)
+	}
+	dirEntry.FileEntries = dirEntry.FileEntries[2:]
+
+	searchEntry, err := p.GetDirEntry(&plugin.GetDirEntryRequest{
+		Path:     "/search/video?category=video",
+		Page:     1,
+		PageSize: 50,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// video dir is filtered by category
+	if len(searchEntry.FileEntries) != 1 || searchEntry.FileEntries[0].Name != "movies/2024/video.mkv" || searchEntry.FileEntries[0].RawData == nil {
+		t.Fatalf("unexpected search entry %v", searchEntry.FileEntries)
+	}
+
+	fileResource, err := p.GetFileResource(&plugin.GetFileResourceRequest{
+		FilePath:  "/video.mkv",
+		FileEntry: dirEntry.FileEntries[0],
+		IsMedia:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileResource.FileResourceData) != 5 {
+		t.Fatalf("expect download,2 play,subtitle and audio resource,got %d", len(fileResource.FileResourceData))
+	}
+	download := fileResource.FileResourceData[0]
+	if download.Url != downloadURL || download.ExpireTime != 1700000000 || download.Resolution != plugin.FileResource_Original {
+		t.Fatalf("unexpected download resource %v", download)
+	}
+	if download.Header["Referer"] != p.Config().Referer || download.Header["User-Agent"] != p.Config().UserAgent {
+		t.Fatalf("unexpected download header %v", download.Header)
+	}
+	play := fileResource.FileResourceData[1]
+	if play.Url != playURL || play.ExpireTime != 1700000001 || play.Resolution != plugin.FileResource_QHD || play.Title != "2K 1440P" {
+		t.Fatalf("unexpected play resource %v", play)
+	}
+	play = fileResource.FileResourceData[2]
+	if play.Resolution != plugin.FileResource_SD || play.Title != "标清" {
+		t.Fatalf("unexpected play resource %v", play)
+	}
+	subtitle := fileResource.FileResourceData[3]
+	if subtitle.Url != subtitleURL || subtitle.ResourceType != plugin.FileResource_Subtitle || subtitle.Title != "简体中文(chi)" || subtitle.ExpireTime != 1700000002 {
+		t.Fatalf("unexpected subtitle resource %v", subtitle)
+	}
+	audio := fileResource.FileResourceData[4]
+	if audio.Url != audioURL || audio.ResourceType != plugin.FileResource_Audio || audio.Title != "English(eng)" {
+		t.Fatalf("unexpected audio resource %v", audio)
+	}
+}
+
+// TestShare run share listing with fake server
+func TestShare(t *testing.T, p *clouddrive.PluginImpl) {
+	transport := http.DefaultClient.Transport
+	defer func() {
+		http.DefaultClient.Transport = transport
+	}()
+	http.DefaultClient.Transport = fakeServer(t, p.Config())
+
+	authData, err := p.CheckAuthMethod(&plugin.AuthMethod{
+		Method: &plugin.AuthMethod_Formdata{
+			Formdata: &plugin.Formdata{
+				FormItems: []*plugin.Formdata_FormItem{
+					{Name: "Cookie", Value: plugin.String(cookie)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.CheckAuthData(authData.AuthDataBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirEntry, err := p.GetDirEntry(&plugin.GetDirEntryRequest{
+		Path:     "/shares/https://pan.example.com/s/share1?pwd=1234",
+		Page:     1,
+		PageSize: 50,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirEntry.FileEntries) != 1 || dirEntry.FileEntries[0].Name != "share.mkv" {
+		t.Fatalf("unexpected share dir entry %v", dirEntry.FileEntries)
+	}
+	_, err = p.GetFileResource(&plugin.GetFileResourceRequest{
+		FilePath:  "/shares/share title/share.mkv",
+		FileEntry: dirEntry.FileEntries[0],
+	})
+	if err != util.ErrShareNotPlayable {
+		t.Fatalf("expect share not playable,got %v", err)
+	}
+
+	sharesEntry, err := p.GetDirEntry(&plugin.GetDirEntryRequest{
+		Path: "/shares",
+		Page: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sharesEntry.FileEntries) != 1 || sharesEntry.FileEntries[0].Name != "share title" {
+		t.Fatalf("unexpected shares %v", sharesEntry.FileEntries)
+	}
+	// open share from shares dir
+	dirEntry, err = p.GetDirEntry(&plugin.GetDirEntryRequest{
+		Path:      "/shares/share title",
+		Page:      1,
+		PageSize:  50,
+		FileEntry: sharesEntry.FileEntries[0],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirEntry.FileEntries) != 1 {
+		t.Fatalf("unexpected share dir entry %v", dirEntry.FileEntries)
+	}
+}
@@ -0,0 +1,146 @@
+package clouddrive
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+type Response struct {
+	Status  int
+	Code    int
+	Message string
+	Data    any
+}
+
+// /cas/ajax/getTokenForQrcodeLogin
+// /cas/ajax/getServiceTicketByQrcodeToken
+type QrcodeTokenResponse struct {
+	Status  int    `json:"status"` // 2000000 success 50004001 not scan 50004002 expired
+	Message string `json:"message"`
+	Data    struct {
+		Members struct {
+			Token         string `json:"token"`
+			ServiceTicket string `json:"service_ticket"`
+		} `json:"members"`
+	} `json:"data"`
+}
+
+type QrcodeParam struct {
+	Token     string `json:"token"`
+	RequestId string `json:"request_id"`
+}
+
+// /account/info
+type AccountInfoResponse struct {
+	Success bool         `json:"success"`
+	Code    string       `json:"code"`
+	Msg     string       `json:"msg"`
+	Data    *AccountInfo `json:"data"`
+}
+
+type AccountInfo struct {
+	Nickname  string `json:"nickname"`
+	AvatarUri string `json:"avatarUri"`
+}
+
+type FileData struct {
+	List     []File `json:"list"`
+	FullPath []File `json:"full_path"` // dirs from root to pdir_fid,return with _fetch_full_path=1
+}
+
+type File struct {
+	Fid           string `json:"fid"`
+	PdirFid       string `json:"pdir_fid"`
+	FileName      string `json:"file_name"`
+	Size          uint64 `json:"size"`
+	FileType      uint64 `json:"file_type"`
+	CreatedAt     uint64 `json:"created_at"`
+	UpdatedAt     uint64 `json:"updated_at"`
+	Dir           bool   `json:"dir"`
+	File          bool   `json:"file"`
+	UpdatedViewAt uint64 `json:"updated_view_at"`
+
+	DownloadUrl string `json:"download_url"`
+}
+
+type PlayReq struct {
+	Fid         string `json:"fid"`
+	Resolutions string `json:"resolutions"`
+	Supports    string `json:"supports"`
+}
+
+type PlayData struct {
+	VideoList    []VideoList `json:"video_list"`
+	SubtitleList []PlayTrack `json:"subtitle_list"`
+	AudioList    []PlayTrack `json:"audio_list"`
+}
+
+type VideoList struct {
+	Resolution  string `json:"resolution"`
+	TransStatus string `json:"trans_status"` // success
+	VideoInfo   struct {
+		URL    string `json:"url"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+	} `json:"video_info"`
+}
+
+// PlayTrack is subtitle or audio track of transcoded video
+type PlayTrack struct {
+	Name     string `json:"name"`
+	Language string `json:"language"`
+	URL      string `json:"url"`
+}
+
+// Title return track name with language
+func (t *PlayTrack) Title() string {
+	if t.Language == "" || strings.Contains(t.Name, t.Language) {
+		return t.Name
+	}
+	if t.Name == "" {
+		return t.Language
+	}
+	return fmt.Sprintf("%s(%s)", t.Name, t.Language)
+}
+
+// transStatusSuccess is trans_status of finished transcode
+const transStatusSuccess = "success"
+
+// all resolutions request in PlayReq.Resolutions
+var resolutionMap = map[string]plugin.FileResource_Resolution{
+	"4k":     plugin.FileResource_UHD,
+	"2k":     plugin.FileResource_QHD,
+	"super":  plugin.FileResource_FHD,
+	"high":   plugin.FileResource_HD,
+	"normal": plugin.FileResource_SD,
+	"low":    plugin.FileResource_LD,
+}
+
+var resolutionTitleMap = map[string]string{
+	"4k":     "4K",
+	"2k":     "2K",
+	"super":  "超清",
+	"high":   "高清",
+	"normal": "标清",
+	"low":    "流畅",
+}
+
+// /share/sharepage/token
+type ShareTokenReq struct {
+	PwdId    string `json:"pwd_id"`
+	Passcode string `json:"passcode"`
+}
+
+type ShareToken struct {
+	Stoken string `json:"stoken"`
+	Title  string `json:"title"`
+}
+
+// ShareFile is raw data of share file entry
+type ShareFile struct {
+	PwdId    string `json:"pwd_id"`
+	Passcode string `json:"passcode"`
+	Fid      string `json:"fid"`
+}
@@ -0,0 +1,864 @@
+package clouddrive
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"plugins/util"
+
+	"github.com/medianexapp/plugin_api/httpclient"
+	"github.com/medianexapp/plugin_api/plugin"
+	"github.com/medianexapp/plugin_api/ratelimit"
+)
+
+const (
+	// cookie __puus will be rotated,let host refresh auth data to store new cookie
+	cookieRefreshInterval = 24 * time.Hour
+	// authDataVersion is stored in auth data,auth data without it use legacy auth id
+	authDataVersion = 1
+)
+
+// Config is the difference of clouddrive api family,like quark and uc drive
+type Config struct {
+	PluginId  string
+	UserAgent string
+	Referer   string
+	Api       string
+	Pr        string
+
+	QrcodeApi      string
+	QrcodeURL      string
+	QrcodeClientId string
+	AccountInfoURL string
+	// LegacyAuthId is auth id of auth data stored without version,
+	// empty means md5 of nickname
+	LegacyAuthId string
+}
+
+type PluginImpl struct {
+	config      *Config
+	cookie      string
+	accountInfo *AccountInfo
+	// legacyAuthId keep auth id of old auth data,so account is not changed
+	legacyAuthId string
+	shares       util.Shares
+	client       *httpclient.Client
+	ratelimit    *ratelimit.RateLimit
+}
+
+func New(config *Config) *PluginImpl {
+	slog.SetLogLoggerLevel(slog.LevelDebug)
+	limitConfigMap := map[string]ratelimit.LimitConfig{
+		"": ratelimit.LimitConfig{
+			Limit:    1,
+			Duration: time.Second,
+		},
+	}
+	return &PluginImpl{
+		config:    config,
+		client:    httpclient.NewClient(httpclient.WithUserAgent(config.UserAgent)),
+		ratelimit: ratelimit.New(limitConfigMap),
+	}
+}
+
+func (p *PluginImpl) Config() *Config {
+	return p.config
+}
+
+// Id implements IPlugin.
+func (p *PluginImpl) PluginId() (string, error) {
+	return p.config.PluginId, nil
+}
+
+// GetAuth return how to auth
+// 1.FormData input data
+// 2.Callback use url callback auth,like oauth
+// 3.Scanqrcode,return qrcode image to auth
+func (p *PluginImpl) GetAuth() (*plugin.Auth, error) {
+	slog.Info("GetAuth")
+	auth := &plugin.Auth{
+		AuthMethods: []*plugin.AuthMethod{
+			{
+				Method: &plugin.AuthMethod_Formdata{
+					Formdata: &plugin.Formdata{
+						FormItems: []*plugin.Formdata_FormItem{
+							{
+								Name:  "Cookie",
+								Value: plugin.String(""),
+							},
+						},
+					},
+				},
+				HelpDocUrl: "",
+			},
+		},
+	}
+	scanQrcode, err := p.getQrcode()
+	if err != nil {
+		slog.Error("get qrcode failed", "err", err)
+		return auth, nil
+	}
+	auth.AuthMethods = append(auth.AuthMethods, &plugin.AuthMethod{
+		Method: scanQrcode,
+	})
+	return auth, nil
+}
+
+func (p *PluginImpl) getQrcode() (*plugin.AuthMethod_Scanqrcode, error) {
+	qrcodeParam := &QrcodeParam{
+		RequestId: newRequestId(),
+	}
+	u := url.Values{}
+	u.Add("client_id", p.config.QrcodeClientId)
+	u.Add("v", "1.2")
+	u.Add("request_id", qrcodeParam.RequestId)
+	tokenResp := &QrcodeTokenResponse{}
+	err := p.requestQrcode("/getTokenForQrcodeLogin", u, tokenResp)
+	if err != nil {
+		return nil, err
+	}
+	if tokenResp.Status != 2000000 {
+		return nil, errors.New(tokenResp.Message)
+	}
+	qrcodeParam.Token = tokenResp.Data.Members.Token
+	param, err := json.Marshal(qrcodeParam)
+	if err != nil {
+		return nil, err
+	}
+	u = url.Values{}
+	u.Add("token", qrcodeParam.Token)
+	u.Add("client_id", p.config.QrcodeClientId)
+	u.Add("ssb", "weblogin")
+	u.Add("uc_param_str", "")
+	return &plugin.AuthMethod_Scanqrcode{
+		Scanqrcode: &plugin.Scanqrcode{
+			QrcodeImageParam:   string(param),
+			QrcodeImageContent: fmt.Sprintf("%s?%s", p.config.QrcodeURL, u.Encode()),
+			QrcodeExpireTime:   uint64(time.Now().Add(5 * time.Minute).Unix()),
+		},
+	}, nil
+}
+
+// CheckAuthMethod check auth is finished and return authDataBytes and authData's expired time
+// if authmethod's type is *plugin.AuthMethod_Refresh,you need to refresh token
+// assert authMethod.Method's type to check auth is finished,return auth data and expired time if authed
+func (p *PluginImpl) CheckAuthMethod(authMethod *plugin.AuthMethod) (*plugin.AuthData, error) {
+	slog.Debug("CheckAuthMethod", "authMethod", authMethod)
+	switch v := authMethod.Method.(type) {
+	case *plugin.AuthMethod_Formdata:
+		p.cookie = v.Formdata.FormItems[0].Value.(*plugin.Formdata_FormItem_StringValue).StringValue.Value
+		p.legacyAuthId = ""
+	case *plugin.AuthMethod_Scanqrcode:
+		cookie, err := p.checkQrcode(v.Scanqrcode.QrcodeImageParam)
+		if err != nil {
+			return nil, err
+		}
+		if cookie == "" {
+			return nil, nil
+		}
+		p.cookie = cookie
+		p.legacyAuthId = ""
+	case *plugin.AuthMethod_Refresh:
+		// keep rotated cookie in memory,it is newer than stored
+		if p.cookie == "" {
+			if err := p.loadAuthData(v.Refresh.AuthData.AuthDataBytes); err != nil {
+				return nil, err
+			}
+		}
+		// request to rotate cookie __puus
+		err := p.request("/config", http.MethodGet, nil, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupport %+v", v)
+	}
+	return p.authData()
+}
+
+// authData marshal current cookie to auth data
+func (p *PluginImpl) authData() (*plugin.AuthData, error) {
+	formdata := &plugin.Formdata{
+		FormItems: []*plugin.Formdata_FormItem{
+			{
+				Name:  "Cookie",
+				Value: plugin.String(p.cookie),
+			},
+			{
+				Name:  "Version",
+				Value: plugin.Int64(authDataVersion),
+			},
+			{
+				Name:  "Legacy Auth Id",
+				Value: plugin.String(p.legacyAuthId),
+			},
+		},
+	}
+	authDataBytes, err := formdata.MarshalVT()
+	if err != nil {
+		return nil, err
+	}
+	return &plugin.AuthData{
+		AuthDataBytes:       authDataBytes,
+		AuthDataExpiredTime: uint64(time.Now().Add(cookieRefreshInterval).Unix()),
+	}, nil
+}
+
+// checkQrcode return cookie if qrcode scan success,return empty if not scan
+func (p *PluginImpl) checkQrcode(param string) (string, error) {
+	qrcodeParam := &QrcodeParam{}
+	err := json.Unmarshal([]byte(param), qrcodeParam)
+	if err != nil {
+		return "", err
+	}
+	u := url.Values{}
+	u.Add("client_id", p.config.QrcodeClientId)
+	u.Add("v", "1.2")
+	u.Add("token", qrcodeParam.Token)
+	u.Add("request_id", qrcodeParam.RequestId)
+	ticketResp := &QrcodeTokenResponse{}
+	err = p.requestQrcode("/getServiceTicketByQrcodeToken", u, ticketResp)
+	if err != nil {
+		return "", err
+	}
+	switch ticketResp.Status {
+	case 2000000:
+	case 50004001:
+		slog.Warn("qrcode not scan", "message", ticketResp.Message)
+		return "", nil
+	default:
+		slog.Error("scan qrcode failed", "status", ticketResp.Status, "message", ticketResp.Message)
+		return "", errors.New(ticketResp.Message)
+	}
+
+	// exchange service ticket to cookie
+	u = url.Values{}
+	u.Add("st", ticketResp.Data.Members.ServiceTicket)
+	u.Add("lw", "scan")
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s?%s", p.config.AccountInfoURL, u.Encode()), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Referer", p.config.Referer)
+	req.Header.Set("User-Agent", p.config.UserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	cookieStrs := []string{}
+	for _, cookie := range resp.Cookies() {
+		cookieStrs = append(cookieStrs, fmt.Sprintf("%s=%s", cookie.Name, cookie.Value))
+	}
+	if len(cookieStrs) == 0 {
+		return "", errors.New("get cookie by service ticket failed")
+	}
+	slog.Info("qrcode scan success")
+	return strings.Join(cookieStrs, "; "), nil
+}
+
+func (p *PluginImpl) requestQrcode(uri string, u url.Values, respData any) error {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s%s?%s", p.config.QrcodeApi, uri, u.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Referer", p.config.Referer)
+	req.Header.Set("User-Agent", p.config.UserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(respBytes, respData)
+}
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// CheckAuthData use authDataBytes to uath
+// you must store auth data to *PluginImpl
+func (p *PluginImpl) CheckAuthData(authDataBytes []byte) error {
+	slog.Debug("CheckAuthData", "authDataBytes", authDataBytes)
+	err := p.loadAuthData(authDataBytes)
+	if err != nil {
+		return err
+	}
+	err = p.request("/config", http.MethodGet, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if p.accountInfo == nil {
+		p.accountInfo, err = p.getAccountInfo()
+		if err != nil {
+			slog.Error("get account info failed", "err", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAuthData load cookie and legacy auth id,
+// auth data without version is stored by old version,keep the auth id of it
+func (p *PluginImpl) loadAuthData(authDataBytes []byte) error {
+	formdata := &plugin.Formdata{}
+	if err := formdata.UnmarshalVT(authDataBytes); err != nil {
+		return err
+	}
+	version := int64(0)
+	p.accountInfo = nil
+	p.legacyAuthId = ""
+	for _, item := range formdata.FormItems {
+		switch value := item.Value.(type) {
+		case *plugin.Formdata_FormItem_StringValue:
+			switch item.Name {
+			case "Cookie":
+				p.cookie = value.StringValue.Value
+			case "Legacy Auth Id":
+				p.legacyAuthId = value.StringValue.Value
+			}
+		case *plugin.Formdata_FormItem_Int64Value:
+			if item.Name == "Version" {
+				version = value.Int64Value.Value
+			}
+		}
+	}
+	if version >= authDataVersion {
+		return nil
+	}
+	p.legacyAuthId = p.config.LegacyAuthId
+	if p.legacyAuthId == "" {
+		accountInfo, err := p.getAccountInfo()
+		if err != nil {
+			return err
+		}
+		p.accountInfo = accountInfo
+		p.legacyAuthId = fmt.Sprintf("%x", md5.Sum([]byte(accountInfo.Nickname)))
+	}
+	slog.Info("migrate auth data of old version", "authId", p.legacyAuthId)
+	return nil
+}
+
+func (p *PluginImpl) getAccountInfo() (*AccountInfo, error) {
+	u := url.Values{}
+	u.Add("fr", "pc")
+	u.Add("platform", "pc")
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s?%s", p.config.AccountInfoURL, u.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Cookie", p.cookie)
+	req.Header.Set("Referer", p.config.Referer)
+	req.Header.Set("User-Agent", p.config.UserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	accountInfoResp := &AccountInfoResponse{}
+	err = json.Unmarshal(respBytes, accountInfoResp)
+	if err != nil {
+		return nil, err
+	}
+	if !accountInfoResp.Success || accountInfoResp.Data == nil {
+		return nil, fmt.Errorf("get account info failed: %s", accountInfoResp.Msg)
+	}
+	return accountInfoResp.Data, nil
+}
+
+// PluginAuthId implements IPlugin.
+// plugin auth id,you can generate id by md5 or sha
+// auth id is md5 of user id in cookie,nickname can be changed and is not unique
+func (p *PluginImpl) PluginAuthId() (string, error) {
+	if p.legacyAuthId != "" {
+		return p.legacyAuthId, nil
+	}
+	uid := cookieValue(p.cookie, "__uid")
+	if uid == "" {
+		return "", errors.New("cookie has no __uid,login by qrcode or copy the whole cookie")
+	}
+	return fmt.Sprintf("%x", md5.Sum([]byte(uid))), nil
+}
+
+// cookieValue return value of cookie name in cookie string
+func cookieValue(cookieStr, name string) string {
+	r := http.Request{Header: http.Header{"Cookie": []string{cookieStr}}}
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// GetDirEntry implements IPlugin.
+// return dir file entry
+// save your driver file raw data to FileEntry.RawData,you can get it after GetDirEntry and GetFileResource request
+// default page_size if 100,if this not for you,change is on DirEntry.PageSize,will use new PageSize for next request
+func (p *PluginImpl) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	slog.Debug("GetDirEntry", "req", req)
+	if util.IsShareEntry(req.Path, req.FileEntry, "pwd_id") {
+		return p.getShareDirEntry(req)
+	}
+	if util.IsSearchPath(req.Path) && (req.FileEntry == nil || req.FileEntry.RawData == nil) {
+		return p.search(req)
+	}
+	var pdirFid string
+	if req.Path == "/" {
+		pdirFid = "0"
+	} else {
+		file := File{}
+		if req.FileEntry == nil || req.FileEntry.RawData == nil {
+			return nil, errors.New("file entry is nil")
+		}
+		err := json.Unmarshal(req.FileEntry.RawData, &file)
+		if err != nil {
+			return nil, err
+		}
+		pdirFid = file.Fid
+	}
+	if req.PageSize > 50 {
+		req.PageSize = 50
+	}
+	u := url.Values{}
+	u.Add("pdir_fid", pdirFid)
+	u.Add("_page", fmt.Sprint(req.Page))
+	u.Add("_size", fmt.Sprint(req.PageSize))
+	u.Add("_fetch_total", "1")
+	fileData := &FileData{
+		List: []File{},
+	}
+	err := p.request("/file/sort", http.MethodGet, u, nil, fileData)
+	if err != nil {
+		return nil, err
+	}
+	dirEntry := &plugin.DirEntry{
+		PageSize:    50,
+		FileEntries: []*plugin.FileEntry{},
+	}
+	if req.Path == "/" && req.Page == 1 {
+		dirEntry.FileEntries = append(dirEntry.FileEntries, util.SharesFileEntry(), util.SearchFileEntry())
+	}
+	p.appendFileEntries(dirEntry, fileData.List, nil)
+	return dirEntry, nil
+}
+
+// search file by "/search/<keyword>",category is filtered by file ext,result name is full path
+func (p *PluginImpl) search(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	dirEntry := &plugin.DirEntry{
+		PageSize:    50,
+		FileEntries: []*plugin.FileEntry{},
+	}
+	if req.Path == util.SearchDir {
+		return dirEntry, nil
+	}
+	query, err := util.ParseSearchQuery(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	if req.PageSize == 0 || req.PageSize > 50 {
+		req.PageSize = 50
+	}
+	u := url.Values{}
+	u.Add("q", query.Keyword)
+	u.Add("_page", fmt.Sprint(req.Page))
+	u.Add("_size", fmt.Sprint(req.PageSize))
+	u.Add("_fetch_total", "1")
+	u.Add("_sort", "file_type:desc,updated_at:desc")
+	fileData := &FileData{
+		List: []File{},
+	}
+	err = p.request("/file/search", http.MethodGet, u, nil, fileData)
+	if err != nil {
+		return nil, err
+	}
+	files := []File{}
+	for _, file := range fileData.List {
+		if query.MatchCategory(file.FileName, !file.File) {
+			files = append(files, file)
+		}
+	}
+	p.appendFileEntries(dirEntry, files, nil)
+	// parent dir of results are mostly same
+	parentPaths := map[string]string{"0": "/"}
+	for i, file := range files {
+		parentPath, ok := parentPaths[file.PdirFid]
+		if !ok {
+			parentPath, err = p.getDirPath(file.PdirFid)
+			if err != nil {
+				return nil, err
+			}
+			parentPaths[file.PdirFid] = parentPath
+		}
+		dirEntry.FileEntries[i].Name = strings.TrimPrefix(path.Join(parentPath, file.FileName), "/")
+	}
+	return dirEntry, nil
+}
+
+// getDirPath return full path of dir
+func (p *PluginImpl) getDirPath(fid string) (string, error) {
+	u := url.Values{}
+	u.Add("pdir_fid", fid)
+	u.Add("_page", "1")
+	u.Add("_size", "1")
+	u.Add("_fetch_full_path", "1")
+	fileData := &FileData{}
+	err := p.request("/file/sort", http.MethodGet, u, nil, fileData)
+	if err != nil {
+		return "", err
+	}
+	names := []string{"/"}
+	for _, dir := range fileData.FullPath {
+		names = append(names, dir.FileName)
+	}
+	return path.Join(names...), nil
+}
+
+// getShareDirEntry list opened shares in "/shares",
+// if path is "/shares/<share link>",list root of share
+func (p *PluginImpl) getShareDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	if req.Path == util.SharesDir {
+		return p.shares.DirEntry(), nil
+	}
+	shareFile := &ShareFile{}
+	isShareRoot := req.FileEntry == nil || req.FileEntry.RawData == nil
+	if isShareRoot {
+		shareLink, err := util.ParseShareLink(req.Path)
+		if err != nil {
+			return nil, err
+		}
+		shareFile.PwdId = shareLink.Id
+		shareFile.Passcode = shareLink.Pwd
+		shareFile.Fid = "0"
+	} else {
+		err := json.Unmarshal(req.FileEntry.RawData, shareFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	shareToken := &ShareToken{}
+	err := p.request("/share/sharepage/token", http.MethodPost, nil, &ShareTokenReq{
+		PwdId:    shareFile.PwdId,
+		Passcode: shareFile.Passcode,
+	}, shareToken)
+	if err != nil {
+		return nil, err
+	}
+	if isShareRoot {
+		name := shareToken.Title
+		if name == "" {
+			name = shareFile.PwdId
+		}
+		rawData, _ := json.Marshal(shareFile)
+		p.shares.Store(&plugin.FileEntry{
+			Name:     name,
+			FileType: plugin.FileEntry_FileTypeDir,
+			RawData:  rawData,
+		})
+	}
+	if req.PageSize == 0 || req.PageSize > 50 {
+		req.PageSize = 50
+	}
+	u := url.Values{}
+	u.Add("pwd_id", shareFile.PwdId)
+	u.Add("stoken", shareToken.Stoken)
+	u.Add("pdir_fid", shareFile.Fid)
+	u.Add("_page", fmt.Sprint(req.Page))
+	u.Add("_size", fmt.Sprint(req.PageSize))
+	u.Add("_fetch_total", "1")
+	fileData := &FileData{
+		List: []File{},
+	}
+	err = p.request("/share/sharepage/detail", http.MethodGet, u, nil, fileData)
+	if err != nil {
+		return nil, err
+	}
+	dirEntry := &plugin.DirEntry{
+		PageSize:    50,
+		FileEntries: []*plugin.FileEntry{},
+	}
+	p.appendFileEntries(dirEntry, fileData.List, func(file File) any {
+		return &ShareFile{
+			PwdId:    shareFile.PwdId,
+			Passcode: shareFile.Passcode,
+			Fid:      file.Fid,
+		}
+	})
+	return dirEntry, nil
+}
+
+// appendFileEntries convert file to FileEntry,rawData return raw data of file,default is file self
+func (p *PluginImpl) appendFileEntries(dirEntry *plugin.DirEntry, files []File, rawData func(file File) any) {
+	for _, file := range files {
+		fileEntry := &plugin.FileEntry{
+			Name:         file.FileName,
+			Size:         file.Size,
+			CreatedTime:  file.CreatedAt / 1000,
+			ModifiedTime: file.UpdatedAt / 1000,
+			AccessedTime: file.UpdatedViewAt,
+		}
+		if file.File {
+			fileEntry.FileType = plugin.FileEntry_FileTypeFile
+		} else {
+			fileEntry.FileType = plugin.FileEntry_FileTypeDir
+		}
+		var data any = file
+		if rawData != nil {
+			data = rawData(file)
+		}
+		fileRawData, err := json.Marshal(data)
+		if err == nil {
+			fileEntry.RawData = fileRawData
+		}
+		dirEntry.FileEntries = append(dirEntry.FileEntries, fileEntry)
+	}
+}
+
+// GetFileResource implements IPlugin.
+func (p *PluginImpl) GetFileResource(req *plugin.GetFileResourceRequest) (*plugin.FileResource, error) {
+	slog.Debug("GetFileResource", "req", req)
+	if util.IsShareEntry(req.FilePath, req.FileEntry, "pwd_id") {
+		// play share file need save it to drive
+		return nil, util.ErrShareNotPlayable
+	}
+	file := File{}
+	if req.FileEntry == nil || req.FileEntry.RawData == nil {
+		return nil, errors.New("file entry is nil")
+	}
+	err := json.Unmarshal(req.FileEntry.RawData, &file)
+	if err != nil {
+		return nil, err
+	}
+	fileResource := &plugin.FileResource{
+		FileResourceData: []*plugin.FileResource_FileResourceData{},
+	}
+	data := map[string][]string{
+		"fids": {file.Fid},
+	}
+	respData := []File{}
+	err = p.request("/file/download", http.MethodPost, nil, data, &respData)
+	if err != nil {
+		return nil, err
+	}
+	if len(respData) == 1 {
+		expireTime, err := getExpires(respData[0].DownloadUrl)
+		if err != nil {
+			slog.Error("get expires failed", "url", respData[0].DownloadUrl, "err", err)
+		} else {
+			fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
+				Url:          respData[0].DownloadUrl,
+				Resolution:   plugin.FileResource_Original,
+				ResourceType: plugin.FileResource_Video,
+				Header: map[string]string{
+					"Cookie":     p.cookie,
+					"Referer":    p.config.Referer,
+					"User-Agent": p.config.UserAgent,
+				},
+				ExpireTime:         expireTime,
+				Size:               req.FileEntry.Size,
+				Proxy:              true,
+				ProxyChunkParallel: 3,
+				ProxyChunkSize:     1024 * 1024 * 5,
+			})
+		}
+	}
+	if req.IsMedia {
+		// 获取播放链接
+		uri := "/file/v2/play"
+		reqData := PlayReq{
+			Fid:         file.Fid,
+			Resolutions: "normal,low,high,super,2k,4k",
+			Supports:    "fmp4,m3u8",
+		}
+		u := url.Values{}
+		u.Add("uc_param_str", "")
+		playData := PlayData{
+			VideoList: []VideoList{},
+		}
+		err = p.request(uri, http.MethodPost, u, reqData, &playData)
+		if err != nil {
+			return nil, err
+		}
+		header := map[string]string{
+			"Cookie":     p.cookie,
+			"Referer":    p.config.Referer,
+			"User-Agent": p.config.UserAgent,
+		}
+		for _, item := range playData.VideoList {
+			if item.TransStatus != transStatusSuccess || item.VideoInfo.URL == "" {
+				slog.Debug("skip unfinished transcode", "resolution", item.Resolution, "trans_status", item.TransStatus)
+				continue
+			}
+			resolution, ok := resolutionMap[item.Resolution]
+			if !ok {
+				slog.Warn("unknown resolution", "resolution", item.Resolution)
+			}
+			title, ok := resolutionTitleMap[item.Resolution]
+			if !ok {
+				title = item.Resolution
+			}
+			if item.VideoInfo.Height > 0 {
+				title = fmt.Sprintf("%s %dP", title, item.VideoInfo.Height)
+			}
+			fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
+				Url:          item.VideoInfo.URL,
+				Resolution:   resolution,
+				ResourceType: plugin.FileResource_Video,
+				Title:        title,
+				Header:       header,
+				ExpireTime:   getPlayExpires(item.VideoInfo.URL),
+			})
+		}
+		for _, subtitle := range playData.SubtitleList {
+			if subtitle.URL == "" {
+				continue
+			}
+			fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
+				Url:          subtitle.URL,
+				ResourceType: plugin.FileResource_Subtitle,
+				Title:        subtitle.Title(),
+				Header:       header,
+				ExpireTime:   getPlayExpires(subtitle.URL),
+			})
+		}
+		for _, audio := range playData.AudioList {
+			if audio.URL == "" {
+				continue
+			}
+			fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
+				Url:          audio.URL,
+				ResourceType: plugin.FileResource_Audio,
+				Title:        audio.Title(),
+				Header:       header,
+				ExpireTime:   getPlayExpires(audio.URL),
+			})
+		}
+	}
+
+	return fileResource, nil
+}
+
+func (p *PluginImpl) request(uri string, method string, u url.Values, reqData, respData any) error {
+	if u == nil {
+		u = url.Values{}
+	}
+	p.ratelimit.Wait("")
+	u.Add("pr", p.config.Pr)
+	u.Add("fr", "pc")
+	var body io.Reader
+	if reqData != nil {
+		data, err := json.Marshal(reqData)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(data)
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("%s%s?%s", p.config.Api, uri, u.Encode()), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Cookie", p.cookie)
+	req.Header.Set("Accept", "application/json, text/plain, */*")
+	req.Header.Set("Referer", p.config.Referer)
+	req.Header.Set("User-Agent", p.config.UserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "__puus" {
+			p.updateCookie(cookie)
+		}
+	}
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	response := Response{
+		Data: respData,
+	}
+	err = json.Unmarshal(respBytes, &response)
+	if err != nil {
+		return err
+	}
+	if response.Code != 0 {
+		slog.Error("resp code failed", "response", response)
+		return fmt.Errorf("%s", response.Message)
+	}
+
+	defer resp.Body.Close()
+	return nil
+}
+
+// updateCookie replace cookie value in p.cookie,only keep name=value
+func (p *PluginImpl) updateCookie(cookie *http.Cookie) {
+	h := http.Header{}
+	h.Add("Cookie", p.cookie)
+	r := http.Request{Header: h}
+	cookieStrs := []string{}
+	found := false
+	for _, oldCookie := range r.Cookies() {
+		value := oldCookie.Value
+		if oldCookie.Name == cookie.Name {
+			value = cookie.Value
+			found = true
+		}
+		cookieStrs = append(cookieStrs, fmt.Sprintf("%s=%s", oldCookie.Name, value))
+	}
+	if !found {
+		cookieStrs = append(cookieStrs, fmt.Sprintf("%s=%s", cookie.Name, cookie.Value))
+	}
+	p.cookie = strings.Join(cookieStrs, "; ")
+}
+
+// getPlayExpires return expire time of play url,log if not found
+func getPlayExpires(u string) uint64 {
+	expireTime, err := getExpires(u)
+	if err != nil {
+		slog.Error("get expires failed", "url", u, "err", err)
+	}
+	return expireTime
+}
+
+func getExpires(u string) (uint64, error) {
+	p, err := url.Parse(u)
+	if err != nil {
+		return 0, err
+	}
+	expires := p.Query().Get("Expires")
+	epInt, err := strconv.Atoi(expires)
+	if err != nil {
+		p, _ = url.Parse(u)
+		sp := strings.Split(p.Query().Get("auth_key"), "-")
+		if len(sp) > 0 {
+			epInt, err = strconv.Atoi(sp[0])
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	return uint64(epInt), nil
+}
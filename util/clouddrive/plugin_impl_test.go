@@ -0,0 +1,65 @@
+package clouddrive
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+func TestUpdateCookie(t *testing.T) {
+	p := New(&Config{PluginId: "test"})
+	p.cookie = "__pus=abc; __puus=old"
+	p.updateCookie(&http.Cookie{Name: "__puus", Value: "new", Path: "/", Domain: ".quark.cn"})
+	if p.cookie != "__pus=abc; __puus=new" {
+		t.Fatalf("unexpected cookie %s", p.cookie)
+	}
+	p.cookie = "__pus=abc"
+	p.updateCookie(&http.Cookie{Name: "__puus", Value: "new"})
+	if p.cookie != "__pus=abc; __puus=new" {
+		t.Fatalf("unexpected cookie %s", p.cookie)
+	}
+}
+
+func TestLoadAuthData(t *testing.T) {
+	p := New(&Config{PluginId: "test", LegacyAuthId: "test"})
+	legacy := &plugin.Formdata{
+		FormItems: []*plugin.Formdata_FormItem{
+			{Name: "Cookie", Value: plugin.String("__pus=abc; __uid=uid1")},
+		},
+	}
+	legacyBytes, err := legacy.MarshalVT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.loadAuthData(legacyBytes); err != nil {
+		t.Fatal(err)
+	}
+	authId, err := p.PluginAuthId()
+	if err != nil || authId != "test" {
+		t.Fatalf("legacy auth data should keep auth id,got %s %v", authId, err)
+	}
+	// legacy auth id is kept after auth data is stored again
+	authData, err := p.authData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = New(&Config{PluginId: "test", LegacyAuthId: "other"})
+	if err := p.loadAuthData(authData.AuthDataBytes); err != nil {
+		t.Fatal(err)
+	}
+	if authId, _ := p.PluginAuthId(); authId != "test" || p.cookie != "__pus=abc; __uid=uid1" {
+		t.Fatalf("unexpected auth id %s,cookie %s", authId, p.cookie)
+	}
+
+	p.legacyAuthId = ""
+	if authId, _ := p.PluginAuthId(); authId != fmt.Sprintf("%x", md5.Sum([]byte("uid1"))) {
+		t.Fatalf("unexpected auth id %s", authId)
+	}
+	p.cookie = "__pus=abc"
+	if _, err := p.PluginAuthId(); err == nil {
+		t.Fatal("cookie without __uid should fail")
+	}
+}
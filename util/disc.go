@@ -0,0 +1,339 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+// disc type of blu-ray and dvd
+const (
+	DiscBluray = "bluray"
+	DiscDVD    = "dvd"
+)
+
+var (
+	discDirNames = map[string][]string{
+		DiscBluray: {"BDMV", "bdmv"},
+		DiscDVD:    {"VIDEO_TS", "video_ts"},
+	}
+	// VTS_01_1.VOB,VTS_01_0.VOB is menu
+	dvdVobRegexp = regexp.MustCompile(`(?i)^VTS_(\d\d)_([1-9])\.VOB$`)
+
+	ErrDiscNoMainFeature = errors.New("main feature of disc not found")
+)
+
+// DiscDirType return disc type of dir name,empty if dir is not disc dir
+func DiscDirType(name string) string {
+	for discType, names := range discDirNames {
+		if strings.EqualFold(name, names[0]) {
+			return discType
+		}
+	}
+	return ""
+}
+
+func discEntryName(dirPath, discType string) string {
+	name := path.Base(dirPath)
+	if name == "/" || name == "." {
+		name = "disc"
+	}
+	return name + "." + discType
+}
+
+// DiscEntries replace disc dir BDMV/VIDEO_TS in dir with a playable file named after dir,
+// like "/Avatar (2009)/BDMV" to "/Avatar (2009)/Avatar (2009).bluray"
+func DiscEntries(dirPath string, fileEntries []*plugin.FileEntry) []*plugin.FileEntry {
+	for i, fileEntry := range fileEntries {
+		if fileEntry.FileType != plugin.FileEntry_FileTypeDir {
+			continue
+		}
+		discType := DiscDirType(fileEntry.Name)
+		if discType == "" {
+			continue
+		}
+		fileEntries[i] = &plugin.FileEntry{
+			Name:         discEntryName(dirPath, discType),
+			FileType:     plugin.FileEntry_FileTypeFile,
+			Size:         fileEntry.Size,
+			RawData:      fileEntry.RawData,
+			CreatedTime:  fileEntry.CreatedTime,
+			ModifiedTime: fileEntry.ModifiedTime,
+			AccessedTime: fileEntry.AccessedTime,
+		}
+	}
+	return fileEntries
+}
+
+// ParseDiscPath return dir which contain disc dir and disc type of disc file
+func ParseDiscPath(filePath string) (string, string, bool) {
+	dirPath, name := path.Split(filePath)
+	dirPath = path.Clean("/" + dirPath)
+	discType := strings.TrimPrefix(path.Ext(name), ".")
+	if _, ok := discDirNames[discType]; !ok {
+		return "", "", false
+	}
+	if name != discEntryName(dirPath, discType) {
+		return "", "", false
+	}
+	return dirPath, discType, true
+}
+
+// listDiscDir list the first exist dir of names in dirPath
+func listDiscDir(dirPath string, names []string, listDir func(string) ([]*plugin.FileEntry, error)) (string, []*plugin.FileEntry, error) {
+	var err error
+	for _, name := range names {
+		discDir := path.Join(dirPath, name)
+		var fileEntries []*plugin.FileEntry
+		fileEntries, err = listDir(discDir)
+		if err == nil {
+			return discDir, fileEntries, nil
+		}
+	}
+	return "", nil, err
+}
+
+// DiscMainFeature return files of main feature if filePath is disc file,
+// blu-ray is clips of the longest playlist in BDMV/PLAYLIST,largest m2ts in BDMV/STREAM if playlist is invalid,
+// dvd is VOBs of the largest title set in VIDEO_TS
+func DiscMainFeature(filePath string, listDir func(string) ([]*plugin.FileEntry, error), readFile func(string, int64) ([]byte, error)) ([]string, bool, error) {
+	dirPath, discType, ok := ParseDiscPath(filePath)
+	if !ok {
+		return nil, false, nil
+	}
+	discDir, fileEntries, err := listDiscDir(dirPath, discDirNames[discType], listDir)
+	if err != nil {
+		return nil, true, err
+	}
+	switch discType {
+	case DiscBluray:
+		streamDir, streamEntries, err := listDiscDir(discDir, []string{"STREAM", "stream"}, listDir)
+		if err != nil {
+			return nil, true, err
+		}
+		files, err := blurayPlaylistFiles(discDir, streamDir, streamEntries, listDir, readFile)
+		if err == nil {
+			return files, true, nil
+		}
+		slog.Warn("get main playlist of blu-ray failed,use largest m2ts", "path", discDir, "err", err)
+		var mainFeature *plugin.FileEntry
+		for _, fileEntry := range streamEntries {
+			if strings.EqualFold(path.Ext(fileEntry.Name), ".m2ts") && (mainFeature == nil || fileEntry.Size > mainFeature.Size) {
+				mainFeature = fileEntry
+			}
+		}
+		if mainFeature == nil {
+			return nil, true, ErrDiscNoMainFeature
+		}
+		return []string{path.Join(streamDir, mainFeature.Name)}, true, nil
+	default:
+		titleSizes := map[string]uint64{}
+		titleVobs := map[string][]string{}
+		for _, fileEntry := range fileEntries {
+			match := dvdVobRegexp.FindStringSubmatch(fileEntry.Name)
+			if match == nil {
+				continue
+			}
+			titleSizes[match[1]] += fileEntry.Size
+			titleVobs[match[1]] = append(titleVobs[match[1]], fileEntry.Name)
+		}
+		mainTitle := ""
+		for title, size := range titleSizes {
+			if mainTitle == "" || size > titleSizes[mainTitle] || (size == titleSizes[mainTitle] && title < mainTitle) {
+				mainTitle = title
+			}
+		}
+		if mainTitle == "" {
+			return nil, true, ErrDiscNoMainFeature
+		}
+		vobs := titleVobs[mainTitle]
+		sort.Slice(vobs, func(i, j int) bool {
+			return vobPart(vobs[i]) < vobPart(vobs[j])
+		})
+		files := make([]string, 0, len(vobs))
+		for _, vob := range vobs {
+			files = append(files, path.Join(discDir, vob))
+		}
+		return files, true, nil
+	}
+}
+
+// blurayPlaylistFiles return m2ts files of the longest playlist,
+// clip of playlist must be in stream dir
+func blurayPlaylistFiles(discDir, streamDir string, streamEntries []*plugin.FileEntry, listDir func(string) ([]*plugin.FileEntry, error), readFile func(string, int64) ([]byte, error)) ([]string, error) {
+	playlistDir, playlistEntries, err := listDiscDir(discDir, []string{"PLAYLIST", "playlist"}, listDir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(playlistEntries, func(i, j int) bool {
+		return playlistEntries[i].Name < playlistEntries[j].Name
+	})
+	var (
+		mainClips    []string
+		mainDuration uint64
+		count        int
+	)
+	for _, fileEntry := range playlistEntries {
+		if !strings.EqualFold(path.Ext(fileEntry.Name), ".mpls") || fileEntry.FileType == plugin.FileEntry_FileTypeDir {
+			continue
+		}
+		if count++; count > maxMplsCount {
+			break
+		}
+		data, err := readFile(path.Join(playlistDir, fileEntry.Name), maxMplsSize)
+		if err != nil {
+			return nil, err
+		}
+		clips, duration, err := parseMpls(data)
+		if err != nil {
+			slog.Warn("parse mpls failed", "name", fileEntry.Name, "err", err)
+			continue
+		}
+		if duration > mainDuration {
+			mainClips, mainDuration = clips, duration
+		}
+	}
+	if len(mainClips) == 0 {
+		return nil, ErrDiscNoMainFeature
+	}
+	streams := map[string]string{}
+	for _, fileEntry := range streamEntries {
+		streams[strings.ToUpper(fileEntry.Name)] = fileEntry.Name
+	}
+	files := make([]string, 0, len(mainClips))
+	for _, clip := range mainClips {
+		name, ok := streams[strings.ToUpper(clip+".m2ts")]
+		if !ok {
+			return nil, fmt.Errorf("clip %s of playlist not found", clip)
+		}
+		files = append(files, path.Join(streamDir, name))
+	}
+	return files, nil
+}
+
+const (
+	// maxMplsCount is max count of playlist to read,some disc has hundreds of fake playlists
+	maxMplsCount = 200
+	maxMplsSize  = 1 << 20
+)
+
+// parseMpls parse clip names and duration in 45khz of play items in blu-ray playlist,
+// see PlayList() of mpls in blu-ray spec
+func parseMpls(data []byte) ([]string, uint64, error) {
+	if len(data) < 12 || string(data[:4]) != "MPLS" {
+		return nil, 0, errors.New("invalid mpls header")
+	}
+	start := int(binary.BigEndian.Uint32(data[8:12]))
+	// length(4) reserved(2) number_of_PlayItems(2) number_of_SubPaths(2)
+	if start+10 > len(data) {
+		return nil, 0, errors.New("invalid mpls playlist")
+	}
+	itemCount := int(binary.BigEndian.Uint16(data[start+6:]))
+	offset := start + 10
+	clips := []string{}
+	var duration uint64
+	for range itemCount {
+		// length(2) clip_information_file_name(5) clip_codec_identifier(4) flags(2) ref_to_STC_id(1) IN_time(4) OUT_time(4)
+		if offset+22 > len(data) {
+			return nil, 0, errors.New("invalid mpls play item")
+		}
+		length := int(binary.BigEndian.Uint16(data[offset:]))
+		inTime := binary.BigEndian.Uint32(data[offset+14:])
+		outTime := binary.BigEndian.Uint32(data[offset+18:])
+		if outTime > inTime {
+			duration += uint64(outTime - inTime)
+		}
+		clips = append(clips, string(data[offset+2:offset+7]))
+		offset += 2 + length
+	}
+	return clips, duration, nil
+}
+
+func vobPart(name string) int {
+	part, _ := strconv.Atoi(dvdVobRegexp.FindStringSubmatch(name)[2])
+	return part
+}
+
+// isLocalURL check url is file url or path of host
+func isLocalURL(url string) bool {
+	return strings.HasPrefix(url, "file://") || !strings.Contains(url, "://")
+}
+
+// DiscURL join local urls of main feature by ffmpeg concat protocol,
+// remote urls are not joined because concat can not pass their auth and leak credential in url,
+// the first file of main feature is played for them
+func DiscURL(urls []string) string {
+	if len(urls) == 1 {
+		return urls[0]
+	}
+	for _, url := range urls {
+		if !isLocalURL(url) {
+			slog.Warn("only play the first file of disc main feature on remote driver", "count", len(urls))
+			return urls[0]
+		}
+	}
+	return "concat:" + strings.Join(urls, "|")
+}
+
+// IsIso check file is disc image
+func IsIso(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".iso")
+}
+
+// isoScanSize is size of iso head to find disc dir,file system of disc is at head of iso
+const isoScanSize = 8 << 20
+
+// IsoDiscType detect disc type of iso by disc dir name in file system,r is read from head of iso,
+// empty if iso is not blu-ray or dvd
+func IsoDiscType(r io.Reader) (string, error) {
+	buf, err := io.ReadAll(io.LimitReader(r, isoScanSize))
+	if err != nil {
+		return "", err
+	}
+	// udf name is 8 bit OSTA compressed unicode,iso9660 name is ascii
+	if bytes.Contains(buf, []byte("BDMV")) {
+		return DiscBluray, nil
+	}
+	if bytes.Contains(buf, []byte("VIDEO_TS")) {
+		return DiscDVD, nil
+	}
+	return "", nil
+}
+
+// IsoURL return url of iso which player read by libbluray or libdvdnav,
+// like bluray:////mnt/movie.iso
+func IsoURL(discType, isoPath string) string {
+	return fmt.Sprintf("%s:///%s", discType, isoPath)
+}
+
+// IsoDiscURL return bluray:// or dvd:// url of iso device,fileURL if iso is not disc,
+// device is path of local iso,libbluray and libdvdnav can not open remote url so fileURL is returned for it,
+// openHead open reader from head of iso
+func IsoDiscURL(fileURL, device string, openHead func() (io.ReadCloser, error)) (string, error) {
+	if !isLocalURL(device) {
+		return fileURL, nil
+	}
+	r, err := openHead()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	discType, err := IsoDiscType(r)
+	if err != nil {
+		return "", err
+	}
+	if discType == "" {
+		return fileURL, nil
+	}
+	return IsoURL(discType, device), nil
+}
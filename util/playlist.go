@@ -0,0 +1,295 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+const (
+	// StrmMaxSize is max size of .strm file,it only contain a url
+	StrmMaxSize = 64 << 10
+	// PlaylistMaxSize is max size of .m3u/.m3u8 file
+	PlaylistMaxSize = 4 << 20
+)
+
+var (
+	ErrStrmEmpty            = errors.New("strm file has no url")
+	ErrFileTooLarge         = errors.New("file is too large")
+	ErrPlaylistItemNotExist = errors.New("playlist item not exist")
+	ErrLinkToLinkFile       = errors.New("link to other .strm or playlist item is not supported")
+	ErrLinkSchemeNotAllowed = errors.New("link only support http and https url")
+
+	// tag of hls playlist,hls playlist is played as one file
+	hlsTags = [][]byte{[]byte("#EXT-X-TARGETDURATION"), []byte("#EXT-X-STREAM-INF"), []byte("#EXT-X-MEDIA-SEQUENCE")}
+)
+
+// IsStrm check file is kodi/emby style .strm file
+func IsStrm(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".strm")
+}
+
+// IsPlaylist check file is .m3u/.m3u8 playlist which is list as dir
+func IsPlaylist(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".m3u" || ext == ".m3u8"
+}
+
+// ReadLimit read all data of r,return ErrFileTooLarge if data is larger than maxSize
+func ReadLimit(r io.Reader, maxSize int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, ErrFileTooLarge
+	}
+	return data, nil
+}
+
+// linkSchemeRegexp match scheme of url,like "http:" and "concat:"
+var linkSchemeRegexp = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*):`)
+
+// linkSchemes is scheme of url which link file can point to,
+// other scheme like file:// and smb:// can reach file out of root of driver
+var linkSchemes = map[string]bool{
+	"http":  true,
+	"https": true,
+}
+
+// resolveTarget join relative path with dir of link file,url of scheme not in linkSchemes is refused
+func resolveTarget(linkPath, target string) (string, bool, error) {
+	if match := linkSchemeRegexp.FindStringSubmatch(target); match != nil {
+		if !linkSchemes[strings.ToLower(match[1])] {
+			return "", false, fmt.Errorf("%w,%s", ErrLinkSchemeNotAllowed, match[1])
+		}
+		return target, false, nil
+	}
+	target = strings.ReplaceAll(target, `\`, "/")
+	if !strings.HasPrefix(target, "/") {
+		target = path.Join(path.Dir(linkPath), target)
+	}
+	return path.Clean(target), true, nil
+}
+
+// ParseStrm return the first url of .strm file
+func ParseStrm(data []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return line, nil
+	}
+	return "", ErrStrmEmpty
+}
+
+type PlaylistItem struct {
+	Name   string
+	Target string // url or path in playlist
+}
+
+// ParsePlaylist parse items of .m3u/.m3u8,name is title of #EXTINF or file name of url,
+// hls playlist has only one item of itself
+func ParsePlaylist(playlistPath string, data []byte) []*PlaylistItem {
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+	for _, tag := range hlsTags {
+		if bytes.Contains(data, tag) {
+			return []*PlaylistItem{{Name: path.Base(playlistPath), Target: path.Base(playlistPath)}}
+		}
+	}
+	items := []*PlaylistItem{}
+	names := map[string]int{}
+	title := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#EXTINF:") {
+			if _, t, ok := strings.Cut(line, ","); ok {
+				title = strings.TrimSpace(t)
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name := title
+		title = ""
+		if name == "" {
+			name = path.Base(strings.SplitN(strings.ReplaceAll(line, `\`, "/"), "?", 2)[0])
+		}
+		name = strings.ReplaceAll(name, "/", "_")
+		names[name]++
+		if count := names[name]; count > 1 {
+			name = fmt.Sprintf("%s (%d)", name, count)
+		}
+		items = append(items, &PlaylistItem{Name: name, Target: line})
+	}
+	return items
+}
+
+// SplitPlaylistPath split path in playlist to playlist path and item name,like
+// "/tv/list.m3u/News" to "/tv/list.m3u" and "News",
+// isFile check element is file,dir named like playlist is not playlist
+func SplitPlaylistPath(filePath string, isFile func(filePath string) bool) (string, string, bool) {
+	elems := strings.Split(strings.TrimPrefix(path.Clean("/"+filePath), "/"), "/")
+	for i, elem := range elems {
+		if !IsPlaylist(elem) {
+			continue
+		}
+		playlistPath := "/" + strings.Join(elems[:i+1], "/")
+		if !isFile(playlistPath) {
+			continue
+		}
+		return playlistPath, strings.Join(elems[i+1:], "/"), true
+	}
+	return "", "", false
+}
+
+// PageSlice return items of page,page start from 1
+func PageSlice[T any](items []T, page, pageSize uint64) []T {
+	if page == 0 {
+		page = 1
+	}
+	if pageSize == 0 {
+		return items
+	}
+	start := (page - 1) * pageSize
+	if uint64(len(items)) <= start {
+		return nil
+	}
+	return items[start:min(start+pageSize, uint64(len(items)))]
+}
+
+// ListDirPageSize is page size of ListDir
+const ListDirPageSize = 1000
+
+// ListDir list whole dir by pages of GetDirEntry of plugin,it is used by DiscMainFeature and ChangeFeed,
+// request has FileEntry of dir so virtual dir like ChangesDir is not listed
+func ListDir(getDirEntry func(*plugin.GetDirEntryRequest) (*plugin.DirEntry, error)) func(string) ([]*plugin.FileEntry, error) {
+	return func(dirPath string) ([]*plugin.FileEntry, error) {
+		fileEntries := []*plugin.FileEntry{}
+		for page := uint64(1); ; page++ {
+			dirEntry, err := getDirEntry(&plugin.GetDirEntryRequest{
+				Path:     dirPath,
+				Page:     page,
+				PageSize: ListDirPageSize,
+				FileEntry: &plugin.FileEntry{
+					Name:     path.Base(dirPath),
+					FileType: plugin.FileEntry_FileTypeDir,
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			fileEntries = append(fileEntries, dirEntry.FileEntries...)
+			if len(dirEntry.FileEntries) < ListDirPageSize {
+				return fileEntries, nil
+			}
+		}
+	}
+}
+
+// PlaylistDirEntry list items of page in playlist as file if dirPath is playlist
+func PlaylistDirEntry(dirPath string, page, pageSize uint64, readFile func(filePath string, maxSize int64) ([]byte, error), isFile func(filePath string) bool) (*plugin.DirEntry, bool, error) {
+	playlistPath, itemName, ok := SplitPlaylistPath(dirPath, isFile)
+	if !ok || itemName != "" {
+		return nil, false, nil
+	}
+	data, err := readFile(playlistPath, PlaylistMaxSize)
+	if err != nil {
+		return nil, true, err
+	}
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+	}
+	for _, item := range PageSlice(ParsePlaylist(playlistPath, data), page, pageSize) {
+		dirEntry.FileEntries = append(dirEntry.FileEntries, &plugin.FileEntry{
+			Name:     item.Name,
+			FileType: plugin.FileEntry_FileTypeFile,
+		})
+	}
+	return dirEntry, true, nil
+}
+
+// isLinkFile check path is .strm or playlist item which is resolved by ResolveLinkFile
+func isLinkFile(filePath string, isFile func(filePath string) bool) bool {
+	if IsStrm(filePath) {
+		return true
+	}
+	_, itemName, ok := SplitPlaylistPath(filePath, isFile)
+	return ok && itemName != ""
+}
+
+// ResolveLinkFile return target of .strm file or playlist item,
+// target is path of driver if isPath is true,or else it is url,
+// path target can not be link file again,so link files can not loop
+func ResolveLinkFile(filePath string, readFile func(filePath string, maxSize int64) ([]byte, error), isFile func(filePath string) bool) (target string, isPath bool, ok bool, err error) {
+	if playlistPath, itemName, isPlaylist := SplitPlaylistPath(filePath, isFile); isPlaylist && itemName != "" {
+		data, err := readFile(playlistPath, PlaylistMaxSize)
+		if err != nil {
+			return "", false, true, err
+		}
+		for _, item := range ParsePlaylist(playlistPath, data) {
+			if item.Name == itemName {
+				target, isPath, err = resolveTarget(playlistPath, item.Target)
+				if err != nil {
+					return "", false, true, err
+				}
+				if isPath && isLinkFile(target, isFile) {
+					return "", false, true, fmt.Errorf("%w,%s", ErrLinkToLinkFile, target)
+				}
+				return target, isPath, true, nil
+			}
+		}
+		return "", false, true, ErrPlaylistItemNotExist
+	}
+	if !IsStrm(filePath) {
+		return "", false, false, nil
+	}
+	data, err := readFile(filePath, StrmMaxSize)
+	if err != nil {
+		return "", false, true, err
+	}
+	target, err = ParseStrm(data)
+	if err != nil {
+		return "", false, true, err
+	}
+	target, isPath, err = resolveTarget(filePath, target)
+	if err != nil {
+		return "", false, true, err
+	}
+	if isPath && isLinkFile(target, isFile) {
+		return "", false, true, fmt.Errorf("%w,%s", ErrLinkToLinkFile, target)
+	}
+	return target, isPath, true, nil
+}
+
+// LinkFileEntryType return dir type for playlist which is list as dir
+func LinkFileEntryType(name string, fileType plugin.FileEntry_FileType) plugin.FileEntry_FileType {
+	if fileType == plugin.FileEntry_FileTypeFile && IsPlaylist(name) {
+		return plugin.FileEntry_FileTypeDir
+	}
+	return fileType
+}
+
+// URLFileResource is resource of url in .strm file or playlist
+func URLFileResource(url string) *plugin.FileResource {
+	return &plugin.FileResource{
+		FileResourceData: []*plugin.FileResource_FileResourceData{
+			{
+				Url:          url,
+				ResourceType: plugin.FileResource_Video,
+				Resolution:   plugin.FileResource_Original,
+			},
+		},
+	}
+}
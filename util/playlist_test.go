@@ -0,0 +1,117 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+func TestParsePlaylist(t *testing.T) {
+	items := ParsePlaylist("/tv/list.m3u", []byte("\xEF\xBB\xBF#EXTM3U\n#EXTINF:-1 tvg-id=\"news\",News\nhttp://example.com/news.m3u8\n\nhttp://example.com/live/sport.ts?token=1\n#EXTINF:10,News\nhttp://example.com/news2.m3u8\nSeason 1\\E01.mkv\n"))
+	want := []*PlaylistItem{
+		{Name: "News", Target: "http://example.com/news.m3u8"},
+		{Name: "sport.ts", Target: "http://example.com/live/sport.ts?token=1"},
+		{Name: "News (2)", Target: "http://example.com/news2.m3u8"},
+		{Name: "E01.mkv", Target: `Season 1\E01.mkv`},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Fatalf("unexpected items %+v", items)
+	}
+	items = ParsePlaylist("/tv/movie.m3u8", []byte("#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nseg0.ts\n"))
+	if len(items) != 1 || items[0].Name != "movie.m3u8" || items[0].Target != "movie.m3u8" {
+		t.Fatalf("unexpected hls items %+v", items)
+	}
+}
+
+func TestResolveLinkFile(t *testing.T) {
+	files := map[string]string{
+		"/movies/a.strm":     "\n# comment\n  http://example.com/a.mkv  \n",
+		"/movies/b.strm":     "../library/b.mkv",
+		"/movies/c.strm":     "\n",
+		"/tv/list.m3u":       "#EXTM3U\n#EXTINF:-1,News\nhttp://example.com/news.m3u8\n#EXTINF:-1,Local\n/media/local.mkv\nshows/e01.mkv\n",
+		"/tv/movie.m3u8":     "#EXT-X-STREAM-INF:BANDWIDTH=1\nhigh.m3u8\n",
+		"/movies/large.strm": string(make([]byte, StrmMaxSize+1)),
+		"/loop/a.strm":       "b.strm",
+		"/loop/b.strm":       "a.strm",
+		"/loop/list.m3u":     "/tv/list.m3u/News\n/loop/a.strm\n",
+		"/loop/self.strm":    "self.strm",
+		"/escape/file.strm":  "file:///etc/passwd",
+		"/escape/smb.strm":   "SMB://host/share/a.mkv",
+		"/escape/list.m3u":   "concat:/etc/passwd|/etc/hosts\n",
+		"/movies/https.strm": "HTTPS://example.com/a.mkv",
+	}
+	// dir named like playlist
+	dirs := map[string]bool{"/shows.m3u": true}
+	isFile := func(filePath string) bool {
+		_, ok := files[filePath]
+		return ok && !dirs[filePath]
+	}
+	readFile := func(filePath string, maxSize int64) ([]byte, error) {
+		data, ok := files[filePath]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		if int64(len(data)) > maxSize {
+			return nil, ErrFileTooLarge
+		}
+		return []byte(data), nil
+	}
+	tests := []struct {
+		filePath string
+		target   string
+		isPath   bool
+		ok       bool
+		err      error
+	}{
+		{"/movies/a.strm", "http://example.com/a.mkv", false, true, nil},
+		{"/movies/b.strm", "/library/b.mkv", true, true, nil},
+		{"/movies/c.strm", "", false, true, ErrStrmEmpty},
+		{"/movies/large.strm", "", false, true, ErrFileTooLarge},
+		{"/movies/a.mkv", "", false, false, nil},
+		{"/tv/list.m3u/News", "http://example.com/news.m3u8", false, true, nil},
+		{"/tv/list.m3u/Local", "/media/local.mkv", true, true, nil},
+		{"/tv/list.m3u/e01.mkv", "/tv/shows/e01.mkv", true, true, nil},
+		{"/tv/list.m3u/Other", "", false, true, ErrPlaylistItemNotExist},
+		{"/tv/movie.m3u8/movie.m3u8", "/tv/movie.m3u8", true, true, nil},
+		{"/shows.m3u/e01.mkv", "", false, false, nil},
+		{"/loop/a.strm", "", false, true, ErrLinkToLinkFile},
+		{"/loop/self.strm", "", false, true, ErrLinkToLinkFile},
+		{"/loop/list.m3u/News", "", false, true, ErrLinkToLinkFile},
+		{"/loop/list.m3u/a.strm", "", false, true, ErrLinkToLinkFile},
+		{"/escape/file.strm", "", false, true, ErrLinkSchemeNotAllowed},
+		{"/escape/smb.strm", "", false, true, ErrLinkSchemeNotAllowed},
+		{"/escape/list.m3u/hosts", "", false, true, ErrLinkSchemeNotAllowed},
+		{"/movies/https.strm", "HTTPS://example.com/a.mkv", false, true, nil},
+	}
+	for _, test := range tests {
+		target, isPath, ok, err := ResolveLinkFile(test.filePath, readFile, isFile)
+		if target != test.target || isPath != test.isPath || ok != test.ok || !errors.Is(err, test.err) {
+			t.Fatalf("%s got %s %v %v %v", test.filePath, target, isPath, ok, err)
+		}
+	}
+
+	dirEntry, ok, err := PlaylistDirEntry("/tv/list.m3u", 1, 100, readFile, isFile)
+	if err != nil || !ok || len(dirEntry.FileEntries) != 3 || dirEntry.FileEntries[1].Name != "Local" {
+		t.Fatal(dirEntry, ok, err)
+	}
+	dirEntry, ok, err = PlaylistDirEntry("/tv/list.m3u", 2, 2, readFile, isFile)
+	if err != nil || !ok || len(dirEntry.FileEntries) != 1 || dirEntry.FileEntries[0].Name != "e01.mkv" {
+		t.Fatal(dirEntry, ok, err)
+	}
+	dirEntry, ok, err = PlaylistDirEntry("/tv/list.m3u", 3, 2, readFile, isFile)
+	if err != nil || !ok || len(dirEntry.FileEntries) != 0 {
+		t.Fatal(dirEntry, ok, err)
+	}
+	if _, ok, _ = PlaylistDirEntry("/tv", 1, 100, readFile, isFile); ok {
+		t.Fatal("/tv is not playlist")
+	}
+	if _, ok, _ = PlaylistDirEntry("/shows.m3u", 1, 100, readFile, isFile); ok {
+		t.Fatal("/shows.m3u is dir")
+	}
+	if LinkFileEntryType("list.M3U", plugin.FileEntry_FileTypeFile) != plugin.FileEntry_FileTypeDir || LinkFileEntryType("a.strm", plugin.FileEntry_FileTypeFile) != plugin.FileEntry_FileTypeFile {
+		t.Fatal("unexpected file type")
+	}
+}
@@ -0,0 +1,129 @@
+package util
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+// SearchDir is virtual dir of cloud plugin,open "/search/<keyword>" to search file,
+// use "/search/<keyword>?category=video" to only search video
+const SearchDir = "/search"
+
+const (
+	CategoryVideo = "video"
+	CategoryAudio = "audio"
+	CategoryImage = "image"
+	CategoryDoc   = "doc"
+)
+
+var categoryExts = map[string][]string{
+	CategoryVideo: {".mp4", ".mkv", ".avi", ".mov", ".wmv", ".flv", ".ts", ".m2ts", ".rmvb", ".webm", ".iso", ".m4v"},
+	CategoryAudio: {".mp3", ".flac", ".wav", ".aac", ".ape", ".m4a", ".ogg", ".dsf", ".dff"},
+	CategoryImage: {".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp", ".heic"},
+	CategoryDoc:   {".txt", ".pdf", ".doc", ".docx", ".epub", ".srt", ".ass", ".nfo"},
+}
+
+type SearchQuery struct {
+	Keyword  string
+	Category string // empty is all category
+}
+
+func IsSearchPath(dirPath string) bool {
+	return dirPath == SearchDir || strings.HasPrefix(dirPath, SearchDir+"/")
+}
+
+// ParseSearchQuery parse keyword and category of "/search/<keyword>?category=video"
+func ParseSearchQuery(dirPath string) (*SearchQuery, error) {
+	keyword := strings.TrimPrefix(strings.TrimPrefix(dirPath, SearchDir), "/")
+	query := &SearchQuery{}
+	if i := strings.LastIndex(keyword, "?"); i >= 0 {
+		values, err := url.ParseQuery(keyword[i+1:])
+		if err == nil {
+			query.Category = values.Get("category")
+			keyword = keyword[:i]
+		}
+	}
+	query.Keyword = strings.TrimSpace(keyword)
+	if query.Keyword == "" {
+		return nil, errors.New("search keyword is empty")
+	}
+	if _, ok := categoryExts[query.Category]; query.Category != "" && !ok {
+		return nil, errors.New("unsupported search category " + query.Category)
+	}
+	return query, nil
+}
+
+// Match check name contains keyword and is in category
+func (q *SearchQuery) Match(name string, isDir bool) bool {
+	if !strings.Contains(strings.ToLower(name), strings.ToLower(q.Keyword)) {
+		return false
+	}
+	return q.MatchCategory(name, isDir)
+}
+
+func (q *SearchQuery) MatchCategory(name string, isDir bool) bool {
+	if q.Category == "" {
+		return true
+	}
+	if isDir {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(name))
+	for _, categoryExt := range categoryExts[q.Category] {
+		if ext == categoryExt {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchFileEntry is virtual dir entry of SearchDir
+func SearchFileEntry() *plugin.FileEntry {
+	return &plugin.FileEntry{
+		Name:     strings.TrimPrefix(SearchDir, "/"),
+		FileType: plugin.FileEntry_FileTypeDir,
+	}
+}
+
+const (
+	walkSearchMaxDirs    = 200
+	walkSearchMaxResults = 100
+)
+
+// WalkSearch search by recursive walk for driver without server search,
+// walk at most 200 dirs and return at most 100 results,result name is full path
+func WalkSearch(query *SearchQuery, root string, listDir func(dirPath string) ([]*plugin.FileEntry, error)) ([]*plugin.FileEntry, error) {
+	results := []*plugin.FileEntry{}
+	dirs := []string{root}
+	for walked := 0; len(dirs) > 0 && walked < walkSearchMaxDirs; walked++ {
+		dirPath := dirs[0]
+		dirs = dirs[1:]
+		fileEntries, err := listDir(dirPath)
+		if err != nil {
+			if dirPath == root {
+				return nil, err
+			}
+			continue
+		}
+		for _, fileEntry := range fileEntries {
+			isDir := fileEntry.FileType == plugin.FileEntry_FileTypeDir
+			filePath := path.Join(dirPath, fileEntry.Name)
+			if isDir {
+				dirs = append(dirs, filePath)
+			}
+			if !query.Match(fileEntry.Name, isDir) {
+				continue
+			}
+			fileEntry.Name = strings.TrimPrefix(filePath, "/")
+			results = append(results, fileEntry)
+			if len(results) >= walkSearchMaxResults {
+				return results, nil
+			}
+		}
+	}
+	return results, nil
+}
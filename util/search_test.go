@@ -0,0 +1,54 @@
+package util
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	query, err := ParseSearchQuery("/search/Movie 2024?category=video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Keyword != "Movie 2024" || query.Category != CategoryVideo {
+		t.Fatalf("unexpected query %+v", query)
+	}
+	if !query.Match("MOVIE 2024.mkv", false) || query.Match("movie 2024.srt", false) || query.Match("movie 2024", true) {
+		t.Fatal("unexpected match")
+	}
+	for _, dirPath := range []string{"/search", "/search/?category=video", "/search/a?category=unknown"} {
+		if _, err := ParseSearchQuery(dirPath); err == nil {
+			t.Fatalf("%s expect error", dirPath)
+		}
+	}
+}
+
+func TestWalkSearch(t *testing.T) {
+	tree := map[string][]*plugin.FileEntry{
+		"/": {
+			{Name: "movie", FileType: plugin.FileEntry_FileTypeDir},
+			{Name: "movie.mkv", FileType: plugin.FileEntry_FileTypeFile},
+			{Name: "broken", FileType: plugin.FileEntry_FileTypeDir},
+		},
+		"/movie": {
+			{Name: "Movie 2.mp4", FileType: plugin.FileEntry_FileTypeFile},
+			{Name: "note.txt", FileType: plugin.FileEntry_FileTypeFile},
+		},
+	}
+	query := &SearchQuery{Keyword: "movie", Category: CategoryVideo}
+	results, err := WalkSearch(query, "/", func(dirPath string) ([]*plugin.FileEntry, error) {
+		fileEntries, ok := tree[dirPath]
+		if !ok {
+			return nil, errors.New("list failed")
+		}
+		return fileEntries, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Name != "movie.mkv" || results[1].Name != "movie/Movie 2.mp4" {
+		t.Fatalf("unexpected results %v", results)
+	}
+}
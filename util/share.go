@@ -0,0 +1,117 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+// SharesDir is virtual dir of cloud plugin,open "/shares/<share link>" to browse share
+const SharesDir = "/shares"
+
+var (
+	ErrShareNotPlayable = errors.New("share file can not play,save it to your drive first")
+
+	shareIdRegexp = regexp.MustCompile(`/s/([0-9A-Za-z_-]+)`)
+)
+
+type ShareLink struct {
+	Id  string // id in share link,like xxx of https://pan.example.com/s/xxx
+	Pwd string // passcode
+}
+
+func IsSharesPath(dirPath string) bool {
+	return dirPath == SharesDir || strings.HasPrefix(dirPath, SharesDir+"/")
+}
+
+// IsShareEntry return whether entry is in virtual SharesDir,
+// entry of share has shareKey in raw data,real dir named shares has raw data of drive file
+func IsShareEntry(dirPath string, fileEntry *plugin.FileEntry, shareKey string) bool {
+	if !IsSharesPath(dirPath) {
+		return false
+	}
+	if fileEntry == nil || fileEntry.RawData == nil {
+		return true
+	}
+	rawData := map[string]json.RawMessage{}
+	if err := json.Unmarshal(fileEntry.RawData, &rawData); err != nil {
+		return false
+	}
+	_, ok := rawData[shareKey]
+	return ok
+}
+
+// ParseShareLink parse link of "/shares/<link>",passcode can set by pwd/password query or after space
+// https://pan.example.com/s/xxx?pwd=1234
+// https://pan.example.com/s/xxx 1234
+func ParseShareLink(dirPath string) (*ShareLink, error) {
+	link := strings.TrimPrefix(strings.TrimPrefix(dirPath, SharesDir), "/")
+	if link == "" {
+		return nil, errors.New("share link is empty")
+	}
+	shareLink := &ShareLink{}
+	if i := strings.LastIndex(link, " "); i > 0 {
+		shareLink.Pwd = strings.TrimSpace(link[i+1:])
+		link = strings.TrimSpace(link[:i])
+	}
+	if i := strings.Index(link, "?"); i >= 0 {
+		query, err := url.ParseQuery(strings.SplitN(link[i+1:], "#", 2)[0])
+		if err == nil {
+			for _, key := range []string{"pwd", "password"} {
+				if query.Get(key) != "" {
+					shareLink.Pwd = query.Get(key)
+				}
+			}
+			// baidu pan share/init?surl=xxx
+			if query.Get("surl") != "" {
+				shareLink.Id = "1" + query.Get("surl")
+			}
+		}
+		link = link[:i]
+	}
+	if shareLink.Id == "" {
+		match := shareIdRegexp.FindStringSubmatch(link)
+		if match == nil {
+			return nil, errors.New("invalid share link")
+		}
+		shareLink.Id = match[1]
+	}
+	return shareLink, nil
+}
+
+// Shares remember opened share root entry,list them in SharesDir
+type Shares struct {
+	entries sync.Map
+}
+
+func (s *Shares) Store(fileEntry *plugin.FileEntry) {
+	s.entries.Store(fileEntry.Name, fileEntry)
+}
+
+func (s *Shares) DirEntry() *plugin.DirEntry {
+	dirEntry := &plugin.DirEntry{
+		FileEntries: []*plugin.FileEntry{},
+	}
+	s.entries.Range(func(key, value any) bool {
+		dirEntry.FileEntries = append(dirEntry.FileEntries, value.(*plugin.FileEntry))
+		return true
+	})
+	sort.Slice(dirEntry.FileEntries, func(i, j int) bool {
+		return dirEntry.FileEntries[i].Name < dirEntry.FileEntries[j].Name
+	})
+	return dirEntry
+}
+
+// SharesFileEntry is virtual dir entry of SharesDir
+func SharesFileEntry() *plugin.FileEntry {
+	return &plugin.FileEntry{
+		Name:     strings.TrimPrefix(SharesDir, "/"),
+		FileType: plugin.FileEntry_FileTypeDir,
+	}
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+func TestParseShareLink(t *testing.T) {
+	for dirPath, expect := range map[string]ShareLink{
+		"/shares/https://pan.baidu.com/s/1abcDEF?pwd=1234":            {Id: "1abcDEF", Pwd: "1234"},
+		"/shares/https://pan.baidu.com/share/init?surl=abcDEF":        {Id: "1abcDEF"},
+		"/shares/https://115.com/s/sw3abc?password=x1y2#":             {Id: "sw3abc", Pwd: "x1y2"},
+		"/shares/https://www.alipan.com/s/AbC_d-1":                    {Id: "AbC_d-1"},
+		"/shares/https://pan.quark.cn/s/0a1b2c3d 5678":                {Id: "0a1b2c3d", Pwd: "5678"},
+		"/shares/https:/pan.quark.cn/s/0a1b2c3d#/list/share?pwd=5678": {Id: "0a1b2c3d", Pwd: "5678"},
+	} {
+		shareLink, err := ParseShareLink(dirPath)
+		if err != nil {
+			t.Fatal(dirPath, err)
+		}
+		if *shareLink != expect {
+			t.Fatalf("%s expect %+v,got %+v", dirPath, expect, *shareLink)
+		}
+	}
+	for _, dirPath := range []string{"/shares", "/shares/https://pan.quark.cn/list"} {
+		if _, err := ParseShareLink(dirPath); err == nil {
+			t.Fatalf("%s expect error", dirPath)
+		}
+	}
+	if !IsSharesPath("/shares/a") || IsSharesPath("/sharesa") {
+		t.Fatal("unexpected shares path")
+	}
+}
+
+func TestIsShareEntry(t *testing.T) {
+	for _, c := range []struct {
+		dirPath string
+		rawData string
+		share   bool
+	}{
+		{"/shares", "", true},
+		{"/shares/https://pan.example.com/s/abc", "", true},
+		{"/shares/abc/video.mkv", `{"share_id":"abc","file_id":"1"}`, true},
+		{"/shares/video.mkv", `{"file_id":"1","name":"video.mkv"}`, false},
+		{"/movie/video.mkv", `{"share_id":"abc"}`, false},
+	} {
+		fileEntry := &plugin.FileEntry{}
+		if c.rawData != "" {
+			fileEntry.RawData = []byte(c.rawData)
+		}
+		if IsShareEntry(c.dirPath, fileEntry, "share_id") != c.share {
+			t.Fatalf("%s %s expect share %v", c.dirPath, c.rawData, c.share)
+		}
+	}
+}
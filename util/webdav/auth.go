@@ -0,0 +1,132 @@
+package webdav
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	wasi_net "github.com/labulakalia/wazero_net/wasi/net"
+	"github.com/medianexapp/gowebdav"
+)
+
+// auth type of webdav,empty is auth data of old version which negotiate basic or digest by server
+const (
+	AuthTypeBasic  = "basic"
+	AuthTypeDigest = "digest"
+	AuthTypeBearer = "bearer"
+)
+
+var ErrInvalidCACert = errors.New("no certificate found in ca certificate")
+
+// NewAuthorizer create authorizer of auth type,password is token of bearer
+func NewAuthorizer(authType, user, password string) (gowebdav.Authorizer, error) {
+	switch strings.ToLower(strings.TrimSpace(authType)) {
+	case "":
+		return gowebdav.NewAutoAuth(user, password), nil
+	case AuthTypeBasic:
+		return gowebdav.NewPreemptiveAuth(&headerAuth{
+			value: "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password)),
+		}), nil
+	case AuthTypeDigest:
+		authorizer := gowebdav.NewEmptyAuth()
+		authorizer.AddAuthenticator(AuthTypeDigest, func(c *http.Client, rs *http.Response, path string) (gowebdav.Authenticator, error) {
+			return gowebdav.NewDigestAuth(user, password, rs)
+		})
+		return authorizer, nil
+	case AuthTypeBearer:
+		return gowebdav.NewPreemptiveAuth(&headerAuth{value: "Bearer " + password}), nil
+	default:
+		return nil, fmt.Errorf("unsupported auth type %s", authType)
+	}
+}
+
+// headerAuth set fixed Authorization header to every request,
+// so it is also in header of file resource
+type headerAuth struct {
+	value string
+}
+
+func (a *headerAuth) Authorize(c *http.Client, rq *http.Request, path string) error {
+	rq.Header.Set("Authorization", a.value)
+	return nil
+}
+
+func (a *headerAuth) Verify(c *http.Client, rs *http.Response, path string) (bool, error) {
+	if rs.StatusCode == http.StatusUnauthorized {
+		return false, gowebdav.NewPathError("Authorize", path, rs.StatusCode)
+	}
+	return false, nil
+}
+
+func (a *headerAuth) Clone() gowebdav.Authenticator {
+	return &headerAuth{value: a.value}
+}
+
+func (a *headerAuth) Close() error {
+	return nil
+}
+
+func (a *headerAuth) String() string {
+	return "HeaderAuth"
+}
+
+// ParseHeaders parse extra headers,one per line,like
+// X-Auth-User: alice
+func ParseHeaders(text string) (http.Header, error) {
+	header := http.Header{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("invalid header %s", line)
+		}
+		header.Add(key, strings.TrimSpace(value))
+	}
+	return header, nil
+}
+
+// NewTLSConfig create tls config of ca certificate in pem and insecure skip verify,
+// it is nil if both are not set,then request is send by host.
+// it only apply to request of plugin,url of file is played by host which does not trust it
+func NewTLSConfig(caCert string, insecureSkipVerify bool) (*tls.Config, error) {
+	if strings.TrimSpace(caCert) == "" && !insecureSkipVerify {
+		return nil, nil
+	}
+	config := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+	if strings.TrimSpace(caCert) != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, ErrInvalidCACert
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// NewTLSClient create http client which do tls handshake in plugin by tls config,
+// host can not verify self-signed certificate
+func NewTLSClient(config *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return wasi_net.Dial(network, addr)
+			},
+			TLSClientConfig:     config,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
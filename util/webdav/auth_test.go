@@ -0,0 +1,102 @@
+package webdav
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/medianexapp/gowebdav"
+)
+
+func TestAuthorizer(t *testing.T) {
+	for authType, want := range map[string]string{
+		AuthTypeBasic:  "Basic YWxpY2U6c2VjcmV0",
+		AuthTypeBearer: "Bearer secret",
+		"":             "",
+		AuthTypeDigest: "",
+	} {
+		authorizer, err := NewAuthorizer(authType, "alice", "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := gowebdav.NewAuthClient("https://dav.example.com/remote.php/dav", authorizer)
+		client.SetHeader("X-Remote-User", "alice")
+		req, err := client.GetPathRequest("/Movies/a.mkv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.Header.Get("Authorization") != want || req.Header.Get("X-Remote-User") != "alice" {
+			t.Fatalf("%s unexpected header %v", authType, req.Header)
+		}
+	}
+	if _, err := NewAuthorizer("ntlm", "alice", "secret"); err == nil {
+		t.Fatal("ntlm is not supported")
+	}
+
+	auth := &headerAuth{value: "Bearer secret"}
+	if _, err := auth.Verify(nil, &http.Response{StatusCode: http.StatusUnauthorized}, "/"); err == nil {
+		t.Fatal("401 should fail")
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	header, err := ParseHeaders("X-Auth-User: alice\n\n Cookie: a=1 \nCookie: b=2\nX-Empty:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("X-Auth-User") != "alice" || len(header.Values("Cookie")) != 2 || header.Values("X-Empty")[0] != "" {
+		t.Fatalf("unexpected header %v", header)
+	}
+	for _, text := range []string{"no colon", ": value", "Bad Key: value"} {
+		if _, err := ParseHeaders(text); err == nil {
+			t.Fatalf("%q should be invalid", text)
+		}
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	config, err := NewTLSConfig(" ", false)
+	if err != nil || config != nil {
+		t.Fatal(config, err)
+	}
+	config, err = NewTLSConfig("", true)
+	if err != nil || !config.InsecureSkipVerify || config.RootCAs != nil {
+		t.Fatal(config, err)
+	}
+	_, err = NewTLSConfig("not pem", false)
+	if !errors.Is(err, ErrInvalidCACert) {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"nas.local"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err = NewTLSConfig(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), false)
+	if err != nil || config.InsecureSkipVerify || config.RootCAs == nil {
+		t.Fatal(config, err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: config.RootCAs, DNSName: "nas.local"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,201 @@
+// Package webdav list and play files of webdav server,it is shared by webdav and nextcloud plugin
+package webdav
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"plugins/util"
+
+	"github.com/medianexapp/gowebdav"
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+// PreviewTitle is title of preview image resource of file
+const PreviewTitle = "preview"
+
+type Driver struct {
+	Client         *gowebdav.Client
+	ShowDiscFolder bool
+	// PreviewURL return url of preview image of file which has preview,
+	// it is returned as resource of file with header of file
+	PreviewURL func(rawData *RawData) string
+
+	propfind *PropfindRecorder
+	changes  util.ChangeFeed
+}
+
+// NewDriver create driver of client,request of client is send by do
+func NewDriver(client *gowebdav.Client, do func(*http.Request) (*http.Response, error)) *Driver {
+	propfind := NewPropfindRecorder(do)
+	client.SetClientDo(propfind.Do)
+	return &Driver{
+		Client:   client,
+		propfind: propfind,
+	}
+}
+
+// Do send request by http client of driver
+func (d *Driver) Do(req *http.Request) (*http.Response, error) {
+	return d.propfind.Do(req)
+}
+
+// GetDirEntry list dir,changes and playlist
+func (d *Driver) GetDirEntry(req *plugin.GetDirEntryRequest) (*plugin.DirEntry, error) {
+	dirPath := RealPath(req.Path, req.FileEntry)
+	page := req.Page
+	pageSize := req.PageSize
+	if util.IsChangesPath(req) {
+		return d.changes.DirEntry(req, util.ListDir(d.GetDirEntry), Fingerprint)
+	}
+	if dirEntry, ok, err := util.PlaylistDirEntry(dirPath, page, pageSize, d.ReadFile, d.IsFile); ok {
+		return dirEntry, err
+	}
+	var fileInfos []os.FileInfo
+	resources, err := d.propfind.Record(func() (err error) {
+		fileInfos, err = d.Client.ReadDir(dirPath)
+		return err
+	})
+	if err != nil {
+		slog.Error("read dir failed", "err", err, "dir", dirPath, "fileInfos", fileInfos)
+		return nil, err
+	}
+	dirEntry := &plugin.DirEntry{
+		FileEntries: make([]*plugin.FileEntry, 0, len(fileInfos)),
+	}
+
+	start := int((page - 1) * pageSize)
+	end := start + int(pageSize)
+
+	if len(fileInfos) <= start {
+		return dirEntry, nil
+	} else if len(fileInfos) >= end {
+		fileInfos = fileInfos[start:end]
+	} else {
+		fileInfos = fileInfos[start:]
+	}
+	for _, fileinfo := range fileInfos {
+		fileEntry := &plugin.FileEntry{
+			Name:         fileinfo.Name(),
+			Size:         uint64(fileinfo.Size()),
+			ModifiedTime: uint64(fileinfo.ModTime().Unix()),
+			AccessedTime: uint64(fileinfo.ModTime().Unix()),
+			CreatedTime:  uint64(fileinfo.ModTime().Unix()),
+		}
+		if fileinfo.IsDir() {
+			fileEntry.FileType = plugin.FileEntry_FileTypeDir
+		} else {
+			fileEntry.FileType = plugin.FileEntry_FileTypeFile
+		}
+
+		if resource, ok := resources[fileEntry.Name]; ok {
+			resource.SetMetadata(fileEntry)
+		} else if file, ok := fileinfo.(gowebdav.File); ok && file.ETag() != "" {
+			fileEntry.RawData, _ = json.Marshal(&RawData{ETag: file.ETag(), ContentType: file.ContentType()})
+		}
+		fileEntry.FileType = util.LinkFileEntryType(fileEntry.Name, fileEntry.FileType)
+		dirEntry.FileEntries = append(dirEntry.FileEntries, fileEntry)
+	}
+	if !d.ShowDiscFolder {
+		dirEntry.FileEntries = util.DiscEntries(dirPath, dirEntry.FileEntries)
+	}
+	return dirEntry, nil
+}
+
+// GetFileResource return url of file,.strm,playlist item and disc
+func (d *Driver) GetFileResource(req *plugin.GetFileResourceRequest) (*plugin.FileResource, error) {
+	filePath := RealPath(req.FilePath, req.FileEntry)
+	if target, isPath, ok, err := util.ResolveLinkFile(filePath, d.ReadFile, d.IsFile); ok {
+		if err != nil {
+			return nil, err
+		}
+		if isPath {
+			return d.GetFileResource(&plugin.GetFileResourceRequest{FilePath: target})
+		}
+		return util.URLFileResource(target), nil
+	}
+	files, ok, err := util.DiscMainFeature(filePath, util.ListDir(d.GetDirEntry), d.ReadFile)
+	if ok {
+		if err != nil {
+			return nil, err
+		}
+		urls := make([]string, 0, len(files))
+		header := map[string]string{}
+		for _, file := range files {
+			url, fileHeader, err := d.FileURL(file)
+			if err != nil {
+				return nil, err
+			}
+			urls = append(urls, url)
+			header = fileHeader
+		}
+		return &plugin.FileResource{
+			FileResourceData: []*plugin.FileResource_FileResourceData{
+				{
+					Url:          util.DiscURL(urls),
+					Header:       header,
+					ResourceType: plugin.FileResource_Video,
+					Resolution:   plugin.FileResource_Original,
+				},
+			},
+		}, nil
+	}
+	fileInfo, err := d.Client.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	resourceType := plugin.FileResource_Video
+	if file, ok := fileInfo.(*gowebdav.File); ok && file != nil {
+		resourceType = ContentResourceType(file.ContentType())
+	}
+	url, header, err := d.FileURL(filePath)
+	if err != nil {
+		return nil, err
+	}
+	fileResource := &plugin.FileResource{
+		FileResourceData: []*plugin.FileResource_FileResourceData{
+			{
+				Url:          url,
+				Header:       header,
+				ResourceType: resourceType,
+				Resolution:   plugin.FileResource_Original,
+			},
+		},
+	}
+	// preview image is not played,it is requested with auth header of file
+	if rawData := ParseRawData(req.FileEntry); d.PreviewURL != nil && rawData != nil && rawData.HasPreview {
+		fileResource.FileResourceData = append(fileResource.FileResourceData, &plugin.FileResource_FileResourceData{
+			Url:          d.PreviewURL(rawData),
+			Header:       header,
+			Title:        PreviewTitle,
+			ResourceType: plugin.FileResource_ResourceTypeUNSPECIFIED,
+		})
+	}
+	return fileResource, nil
+}
+
+// FileURL return url and header to request file
+func (d *Driver) FileURL(filePath string) (string, map[string]string, error) {
+	pathReq, err := d.Client.GetPathRequest(filePath)
+	if err != nil {
+		return "", nil, err
+	}
+	return pathReq.URL.String(), HeaderMap(pathReq.Header), nil
+}
+
+// IsFile check path is file
+func (d *Driver) IsFile(filePath string) bool {
+	fileInfo, err := d.Client.Stat(filePath)
+	return err == nil && !fileInfo.IsDir()
+}
+
+// ReadFile read small file like .strm and playlist
+func (d *Driver) ReadFile(filePath string, maxSize int64) ([]byte, error) {
+	rc, err := d.Client.ReadStream(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return util.ReadLimit(rc, maxSize)
+}
@@ -0,0 +1,95 @@
+package webdav
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/medianexapp/gowebdav"
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+const testStatMultistatus = `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:">
+	<d:response>
+		<d:href>/remote.php/dav/files/alice/Movies/Heat%20(1995).srt</d:href>
+		<d:propstat>
+			<d:prop><d:resourcetype/><d:getcontentlength>10</d:getcontentlength><d:getcontenttype>application/x-subrip</d:getcontenttype></d:prop>
+			<d:status>HTTP/1.1 200 OK</d:status>
+		</d:propstat>
+	</d:response>
+</d:multistatus>`
+
+func newTestDriver(t *testing.T) *Driver {
+	authorizer, err := NewAuthorizer(AuthTypeBasic, "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := gowebdav.NewAuthClient("https://cloud.example.com/remote.php/dav/files/alice", authorizer)
+	client.SetHeader("X-Extra", "1")
+	return NewDriver(client, func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Authorization") != "Basic YWxpY2U6c2VjcmV0" || req.Header.Get("X-Extra") != "1" {
+			t.Fatalf("unexpected header %v", req.Header)
+		}
+		body := testMultistatus
+		if req.Header.Get("Depth") == "0" {
+			body = testStatMultistatus
+		}
+		return &http.Response{
+			StatusCode: http.StatusMultiStatus,
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+}
+
+func TestDriver(t *testing.T) {
+	driver := newTestDriver(t)
+	driver.PreviewURL = func(rawData *RawData) string {
+		return "https://cloud.example.com/index.php/core/preview?fileId=" + rawData.FileId
+	}
+	dirEntry, err := driver.GetDirEntry(&plugin.GetDirEntryRequest{Path: "/Movies", Page: 1, PageSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirEntry.FileEntries) != 2 {
+		t.Fatalf("unexpected entries %v", dirEntry.FileEntries)
+	}
+	rawData := ParseRawData(dirEntry.FileEntries[0])
+	if rawData == nil || !rawData.HasPreview || rawData.FileId != "4242" {
+		t.Fatalf("unexpected raw data %+v", rawData)
+	}
+	if dirEntry.FileEntries[1].CreatedTime != 1714550400 || dirEntry.FileEntries[1].ModifiedTime != 1717236000 {
+		t.Fatalf("unexpected entry %v", dirEntry.FileEntries[1])
+	}
+
+	fileResource, err := driver.GetFileResource(&plugin.GetFileResourceRequest{FilePath: "/Movies/Heat (1995).srt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fileResource.FileResourceData[0]
+	if data.ResourceType != plugin.FileResource_Subtitle || data.Url != "https://cloud.example.com/remote.php/dav/files/alice/Movies/Heat%20%281995%29.srt" {
+		t.Fatalf("unexpected resource %v", data)
+	}
+	if data.Header["Authorization"] != "Basic YWxpY2U6c2VjcmV0" || data.Header["X-Extra"] != "1" {
+		t.Fatalf("unexpected header %v", data.Header)
+	}
+	if len(fileResource.FileResourceData) != 1 {
+		t.Fatalf("unexpected resources %v", fileResource.FileResourceData)
+	}
+
+	fileResource, err = driver.GetFileResource(&plugin.GetFileResourceRequest{FilePath: "/Movies/Heat (1995).srt", FileEntry: dirEntry.FileEntries[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileResource.FileResourceData) != 2 {
+		t.Fatalf("unexpected resources %v", fileResource.FileResourceData)
+	}
+	preview := fileResource.FileResourceData[1]
+	if preview.Title != PreviewTitle || preview.Url != "https://cloud.example.com/index.php/core/preview?fileId=4242" {
+		t.Fatalf("unexpected preview %v", preview)
+	}
+	if preview.Header["Authorization"] != "Basic YWxpY2U6c2VjcmV0" {
+		t.Fatalf("unexpected preview header %v", preview.Header)
+	}
+}
@@ -0,0 +1,264 @@
+package webdav
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"plugins/util"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+// propfindBody request props which gowebdav parse and metadata of creation date,
+// nextcloud/owncloud file id and preview
+const propfindBody = `<?xml version="1.0" encoding="UTF-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:oc="http://owncloud.org/ns" xmlns:nc="http://nextcloud.org/ns">
+	<d:prop>
+		<d:displayname/>
+		<d:resourcetype/>
+		<d:getcontentlength/>
+		<d:getcontenttype/>
+		<d:getetag/>
+		<d:getlastmodified/>
+		<d:creationdate/>
+		<oc:fileid/>
+		<nc:has-preview/>
+	</d:prop>
+</d:propfind>`
+
+// RawData is raw data of file entry
+type RawData struct {
+	Path        string `json:"path,omitempty"` // path of search result
+	ETag        string `json:"etag,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	FileId      string `json:"file_id,omitempty"`
+	HasPreview  bool   `json:"has_preview,omitempty"`
+}
+
+// ParseRawData return raw data of file entry,nil if it has no raw data
+func ParseRawData(fileEntry *plugin.FileEntry) *RawData {
+	if fileEntry == nil || fileEntry.RawData == nil {
+		return nil
+	}
+	rawData := &RawData{}
+	if err := json.Unmarshal(fileEntry.RawData, rawData); err != nil {
+		return nil
+	}
+	return rawData
+}
+
+// RealPath return path in raw data,path of search result is not real path
+func RealPath(filePath string, fileEntry *plugin.FileEntry) string {
+	rawData := ParseRawData(fileEntry)
+	if rawData == nil || rawData.Path == "" {
+		return filePath
+	}
+	return rawData.Path
+}
+
+// Fingerprint use getetag of server as fingerprint of change feed,
+// fall back to size and modified time if server has no etag
+func Fingerprint(fileEntry *plugin.FileEntry) string {
+	if rawData := ParseRawData(fileEntry); rawData != nil && rawData.ETag != "" {
+		return rawData.ETag
+	}
+	return util.EntryFingerprint(fileEntry)
+}
+
+type davMultistatus struct {
+	Responses []*davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href      string         `xml:"DAV: href"`
+	Propstats []*davPropstat `xml:"DAV: propstat"`
+}
+
+type davPropstat struct {
+	Status string  `xml:"DAV: status"`
+	Prop   davProp `xml:"DAV: prop"`
+}
+
+type davProp struct {
+	DisplayName   string    `xml:"DAV: displayname"`
+	Collection    *struct{} `xml:"DAV: resourcetype>collection"`
+	ContentLength string    `xml:"DAV: getcontentlength"`
+	LastModified  string    `xml:"DAV: getlastmodified"`
+	ContentType   string    `xml:"DAV: getcontenttype"`
+	ETag          string    `xml:"DAV: getetag"`
+	CreationDate  string    `xml:"DAV: creationdate"`
+	FileId        string    `xml:"http://owncloud.org/ns fileid"`
+	HasPreview    string    `xml:"http://nextcloud.org/ns has-preview"`
+}
+
+// Resource is file in PROPFIND or SEARCH response
+type Resource struct {
+	Href     string // unescaped href
+	Name     string
+	IsDir    bool
+	Size     int64
+	Modified time.Time
+	Created  time.Time // zero if server has no creationdate
+	RawData  RawData
+}
+
+// ParseMultistatus parse resources of multistatus response,resource without 200 props is skipped
+func ParseMultistatus(data []byte) ([]*Resource, error) {
+	multistatus := &davMultistatus{}
+	if err := xml.Unmarshal(data, multistatus); err != nil {
+		return nil, err
+	}
+	resources := make([]*Resource, 0, len(multistatus.Responses))
+	for _, response := range multistatus.Responses {
+		var prop *davProp
+		for _, propstat := range response.Propstats {
+			if strings.Contains(propstat.Status, "200") {
+				prop = &propstat.Prop
+				break
+			}
+		}
+		if prop == nil {
+			continue
+		}
+		href, err := url.PathUnescape(response.Href)
+		if err != nil {
+			href = response.Href
+		}
+		resource := &Resource{
+			Href:  href,
+			Name:  path.Base(strings.TrimSuffix(href, "/")),
+			IsDir: prop.Collection != nil,
+			RawData: RawData{
+				ETag:        strings.TrimSpace(prop.ETag),
+				ContentType: strings.TrimSpace(prop.ContentType),
+				FileId:      strings.TrimSpace(prop.FileId),
+				HasPreview:  strings.TrimSpace(prop.HasPreview) == "true",
+			},
+		}
+		resource.Size, _ = strconv.ParseInt(strings.TrimSpace(prop.ContentLength), 10, 64)
+		resource.Modified, _ = http.ParseTime(strings.TrimSpace(prop.LastModified))
+		if creationDate := strings.TrimSpace(prop.CreationDate); creationDate != "" {
+			resource.Created, _ = time.Parse(time.RFC3339, creationDate)
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// SetMetadata set creation time and raw data to file entry,created time fall back to modified time
+func (r *Resource) SetMetadata(fileEntry *plugin.FileEntry) {
+	if !r.Created.IsZero() {
+		fileEntry.CreatedTime = uint64(r.Created.Unix())
+	}
+	if r.RawData != (RawData{}) {
+		fileEntry.RawData, _ = json.Marshal(&r.RawData)
+	}
+}
+
+// FileEntry convert resource to file entry
+func (r *Resource) FileEntry() *plugin.FileEntry {
+	fileEntry := &plugin.FileEntry{
+		Name:         r.Name,
+		FileType:     plugin.FileEntry_FileTypeFile,
+		Size:         uint64(r.Size),
+		ModifiedTime: uint64(r.Modified.Unix()),
+		AccessedTime: uint64(r.Modified.Unix()),
+		CreatedTime:  uint64(r.Modified.Unix()),
+	}
+	if r.IsDir {
+		fileEntry.FileType = plugin.FileEntry_FileTypeDir
+		fileEntry.Size = 0
+	}
+	r.SetMetadata(fileEntry)
+	return fileEntry
+}
+
+// PropfindRecorder request metadata in PROPFIND of gowebdav and record it,
+// gowebdav still parse the same response
+type PropfindRecorder struct {
+	do        func(*http.Request) (*http.Response, error)
+	mu        sync.Mutex
+	resources map[string]*Resource
+}
+
+func NewPropfindRecorder(do func(*http.Request) (*http.Response, error)) *PropfindRecorder {
+	return &PropfindRecorder{do: do}
+}
+
+func (r *PropfindRecorder) Do(req *http.Request) (*http.Response, error) {
+	if req.Method != "PROPFIND" {
+		return r.do(req)
+	}
+	req.Body = io.NopCloser(strings.NewReader(propfindBody))
+	req.ContentLength = int64(len(propfindBody))
+	resp, err := r.do(req)
+	if err != nil || resp.StatusCode != http.StatusMultiStatus {
+		return resp, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resources, err := ParseMultistatus(data)
+	if err == nil {
+		r.resources = make(map[string]*Resource, len(resources))
+		for _, resource := range resources {
+			r.resources[resource.Name] = resource
+		}
+	}
+	return resp, nil
+}
+
+// Record call fn and return resources of the last PROPFIND in it,key is file name
+func (r *PropfindRecorder) Record(fn func() error) (map[string]*Resource, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resources = nil
+	err := fn()
+	resources := r.resources
+	r.resources = nil
+	if resources == nil {
+		resources = map[string]*Resource{}
+	}
+	return resources, err
+}
+
+// ContentResourceType return resource type of content type,unknown type is video
+func ContentResourceType(contentType string) plugin.FileResource_ResourceType {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return plugin.FileResource_Video
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "audio/"):
+		return plugin.FileResource_Audio
+	case mediaType == "text/vtt" || mediaType == "application/x-subrip" || mediaType == "text/x-ssa" || mediaType == "text/x-ass":
+		return plugin.FileResource_Subtitle
+	default:
+		return plugin.FileResource_Video
+	}
+}
+
+// HeaderMap convert header to header of file resource,multiple values are joined
+func HeaderMap(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for key, values := range header {
+		sep := ", "
+		if key == "Cookie" {
+			sep = "; "
+		}
+		headers[key] = strings.Join(values, sep)
+	}
+	return headers
+}
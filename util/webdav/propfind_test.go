@@ -0,0 +1,142 @@
+package webdav
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/medianexapp/gowebdav"
+	"github.com/medianexapp/plugin_api/plugin"
+)
+
+const testMultistatus = `<?xml version="1.0"?>
+<d:multistatus xmlns:d="DAV:" xmlns:oc="http://owncloud.org/ns" xmlns:nc="http://nextcloud.org/ns">
+	<d:response>
+		<d:href>/remote.php/dav/files/alice/Movies/</d:href>
+		<d:propstat>
+			<d:prop><d:resourcetype><d:collection/></d:resourcetype><d:getetag>"dir"</d:getetag></d:prop>
+			<d:status>HTTP/1.1 200 OK</d:status>
+		</d:propstat>
+	</d:response>
+	<d:response>
+		<d:href>/remote.php/dav/files/alice/Movies/Heat%20(1995).mkv</d:href>
+		<d:propstat>
+			<d:prop>
+				<d:resourcetype/>
+				<d:getcontentlength>1024</d:getcontentlength>
+				<d:getcontenttype>video/x-matroska</d:getcontenttype>
+				<d:getetag>"5f3a"</d:getetag>
+				<d:getlastmodified>Sat, 01 Jun 2024 10:00:00 GMT</d:getlastmodified>
+				<oc:fileid>4242</oc:fileid>
+				<nc:has-preview>true</nc:has-preview>
+			</d:prop>
+			<d:status>HTTP/1.1 200 OK</d:status>
+		</d:propstat>
+		<d:propstat>
+			<d:prop><d:creationdate/></d:prop>
+			<d:status>HTTP/1.1 404 Not Found</d:status>
+		</d:propstat>
+	</d:response>
+	<d:response>
+		<d:href>/remote.php/dav/files/alice/Movies/Heat%20(1995).srt</d:href>
+		<d:propstat>
+			<d:prop>
+				<d:resourcetype/>
+				<d:getcontentlength>10</d:getcontentlength>
+				<d:getlastmodified>Sat, 01 Jun 2024 10:00:00 GMT</d:getlastmodified>
+				<d:creationdate>2024-05-01T08:00:00Z</d:creationdate>
+			</d:prop>
+			<d:status>HTTP/1.1 200 OK</d:status>
+		</d:propstat>
+	</d:response>
+</d:multistatus>`
+
+func TestPropfindRecorder(t *testing.T) {
+	recorder := NewPropfindRecorder(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		if !strings.Contains(string(body), "<oc:fileid/>") || req.ContentLength != int64(len(body)) {
+			t.Fatalf("unexpected propfind body %s", body)
+		}
+		return &http.Response{
+			StatusCode: http.StatusMultiStatus,
+			Body:       io.NopCloser(strings.NewReader(testMultistatus)),
+		}, nil
+	})
+	client := gowebdav.NewClient("https://cloud.example.com/remote.php/dav/files/alice", "", "")
+	client.SetClientDo(recorder.Do)
+
+	var fileInfos []os.FileInfo
+	resources, err := recorder.Record(func() (err error) {
+		fileInfos, err = client.ReadDir("/Movies")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileInfos) != 2 || fileInfos[0].Name() != "Heat (1995).mkv" || fileInfos[0].Size() != 1024 {
+		t.Fatalf("gowebdav should parse the same response,got %v", fileInfos)
+	}
+
+	fileEntry := &plugin.FileEntry{Name: "Heat (1995).mkv", CreatedTime: 100}
+	resources[fileEntry.Name].SetMetadata(fileEntry)
+	rawData := ParseRawData(fileEntry)
+	if *rawData != (RawData{ETag: `"5f3a"`, ContentType: "video/x-matroska", FileId: "4242", HasPreview: true}) || fileEntry.CreatedTime != 100 {
+		t.Fatalf("unexpected metadata %+v %d", rawData, fileEntry.CreatedTime)
+	}
+	if Fingerprint(fileEntry) != `"5f3a"` {
+		t.Fatal(Fingerprint(fileEntry))
+	}
+
+	fileEntry = &plugin.FileEntry{Name: "Heat (1995).srt"}
+	resources[fileEntry.Name].SetMetadata(fileEntry)
+	if fileEntry.CreatedTime != 1714550400 || fileEntry.RawData != nil {
+		t.Fatalf("unexpected entry %v", fileEntry)
+	}
+}
+
+func TestParseMultistatus(t *testing.T) {
+	resources, err := ParseMultistatus([]byte(testMultistatus))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 3 || !resources[0].IsDir || resources[0].Name != "Movies" || resources[1].IsDir {
+		t.Fatalf("unexpected resources %+v", resources)
+	}
+	fileEntry := resources[1].FileEntry()
+	if fileEntry.Name != "Heat (1995).mkv" || fileEntry.Size != 1024 || fileEntry.ModifiedTime != 1717236000 || fileEntry.FileType != plugin.FileEntry_FileTypeFile {
+		t.Fatalf("unexpected entry %v", fileEntry)
+	}
+	if RealPath("/search/heat/Movies/Heat (1995).mkv", &plugin.FileEntry{RawData: []byte(`{"path":"/Movies/Heat (1995).mkv"}`)}) != "/Movies/Heat (1995).mkv" {
+		t.Fatal("path of search result should be in raw data")
+	}
+}
+
+func TestContentResourceType(t *testing.T) {
+	for contentType, want := range map[string]plugin.FileResource_ResourceType{
+		"video/mp4":                plugin.FileResource_Video,
+		"audio/flac":               plugin.FileResource_Audio,
+		"text/vtt; charset=utf-8":  plugin.FileResource_Subtitle,
+		"application/x-subrip":     plugin.FileResource_Subtitle,
+		"application/octet-stream": plugin.FileResource_Video,
+		"":                         plugin.FileResource_Video,
+	} {
+		if got := ContentResourceType(contentType); got != want {
+			t.Fatalf("%s got %v,want %v", contentType, got, want)
+		}
+	}
+}
+
+func TestHeaderMap(t *testing.T) {
+	header := http.Header{}
+	header.Add("Cookie", "a=1")
+	header.Add("Cookie", "b=2")
+	header.Add("X-Forwarded-For", "10.0.0.1")
+	header.Add("X-Forwarded-For", "10.0.0.2")
+	header.Set("Authorization", "Bearer secret")
+	headers := HeaderMap(header)
+	if headers["Cookie"] != "a=1; b=2" || headers["X-Forwarded-For"] != "10.0.0.1, 10.0.0.2" || headers["Authorization"] != "Bearer secret" {
+		t.Fatalf("unexpected headers %v", headers)
+	}
+}
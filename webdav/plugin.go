@@ -1,11 +1,11 @@
-package main
-
-import (
-	"github.com/medianexapp/plugin_api"
-)
-
-func init() {
-	plugin_api.RegistryPlugin(NewPluginImpl())
-}
-
-func main() {}
+package main
+
+import (
+	"github.com/medianexapp/plugin_api"
+)
+
+func init() {
+	plugin_api.RegistryPlugin(NewPluginImpl())
+}
+
+func main() {}